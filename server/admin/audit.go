@@ -0,0 +1,62 @@
+package admin
+
+import (
+	"flappy-bird-server/audit"
+	"flappy-bird-server/lib"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// getAuditLogs filters by actorId, action, targetType, targetId and an
+// RFC 3339 from/to range, paginated with page and limit.
+func getAuditLogs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := audit.Filter{
+		ActorId:    query.Get("actorId"),
+		Action:     query.Get("action"),
+		TargetType: query.Get("targetType"),
+		TargetId:   query.Get("targetId"),
+	}
+
+	for key, target := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := query.Get(key); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				lib.ErrorJson(w, http.StatusBadRequest, key+" should be an RFC 3339 timestamp", "")
+				return
+			}
+			*target = &parsed
+		}
+	}
+	for key, target := range map[string]*int{"page": &filter.Page, "limit": &filter.Limit} {
+		if value := query.Get(key); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 {
+				lib.ErrorJson(w, http.StatusBadRequest, key+" should be a positive number", "")
+				return
+			}
+			*target = parsed
+		}
+	}
+	if filter.Page == 0 {
+		filter.Page = 1
+	}
+	if filter.Limit == 0 || filter.Limit > audit.MaxLimit {
+		filter.Limit = audit.MaxLimit
+	}
+
+	events, total, err := audit.List(r.Context(), filter)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "success",
+		"data":    events,
+		"page":    filter.Page,
+		"limit":   filter.Limit,
+		"total":   total,
+	})
+}
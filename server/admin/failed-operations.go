@@ -0,0 +1,71 @@
+package admin
+
+import (
+	"errors"
+	"flappy-bird-server/audit"
+	gameManager "flappy-bird-server/game-manager"
+	"flappy-bird-server/lib"
+	"flappy-bird-server/middleware"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+func getFailedOperations(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", "pending", "replaying", "resolved":
+	default:
+		lib.ErrorJson(w, http.StatusBadRequest, "status should be pending, replaying or resolved", "")
+		return
+	}
+
+	limit := 100
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 100 {
+			lib.ErrorJson(w, http.StatusBadRequest, "limit should be between 1 and 100", "")
+			return
+		}
+		limit = parsed
+	}
+
+	operations, err := gameManager.ListFailedOperations(r.Context(), status, limit)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "success",
+		"data":    operations,
+	})
+}
+
+func replayFailedOperation(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.GetUser(r)
+	id := mux.Vars(r)["id"]
+
+	operation, err := gameManager.ReplayFailedOperation(r.Context(), &gameManager.GetInstance().DbQueue, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, gameManager.ErrOperationNotFound):
+			lib.ErrorJson(w, http.StatusNotFound, "Failed operation not found", "")
+		case errors.Is(err, gameManager.ErrOperationNotPending):
+			lib.ErrorJson(w, http.StatusConflict, err.Error(), "")
+		default:
+			lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		}
+		return
+	}
+
+	event := audit.FromRequest(r, user.Id, "failed-operation.replay", "failed-operation", operation.Id)
+	event.Details = map[string]interface{}{"type": operation.Type, "payload": operation.Payload, "attempts": operation.Attempts}
+	audit.Log(r.Context(), event)
+
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Operation queued for replay",
+		"data":    operation,
+	})
+}
@@ -0,0 +1,128 @@
+package admin
+
+import (
+	"errors"
+	"flappy-bird-server/audit"
+	gameManager "flappy-bird-server/game-manager"
+	"flappy-bird-server/lib"
+	"flappy-bird-server/middleware"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type EndGameRequestBody struct {
+	WinnerId string `json:"winnerId"`
+}
+
+type KickPlayerRequestBody struct {
+	UserId string `json:"userId"`
+}
+
+func writeGameError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, gameManager.ErrGameNotFound):
+		lib.ErrorJson(w, http.StatusNotFound, "Game not found", "")
+	case errors.Is(err, gameManager.ErrGameNotOngoing), errors.Is(err, gameManager.ErrNotParticipant):
+		lib.ErrorJson(w, http.StatusConflict, err.Error(), "")
+	default:
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+	}
+}
+
+func getGame(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.GetUser(r)
+	gameId := mux.Vars(r)["id"]
+
+	state, err := gameManager.GetInstance().InspectGame(r.Context(), gameId)
+	if err != nil {
+		writeGameError(w, err)
+		return
+	}
+
+	audit.Log(r.Context(), audit.FromRequest(r, user.Id, "game.inspect", "game", gameId))
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "success",
+		"data":    state,
+	})
+}
+
+func endGame(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.GetUser(r)
+	gameId := mux.Vars(r)["id"]
+
+	var body EndGameRequestBody
+	err := lib.ReadJsonFromBody(r, w, &body)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusBadRequest, err.Error(), "")
+		return
+	}
+	if body.WinnerId == "" {
+		lib.ErrorJson(w, http.StatusBadRequest, "winnerId is required", "")
+		return
+	}
+
+	state, err := gameManager.GetInstance().ForceEndGame(r.Context(), gameId, body.WinnerId)
+	if err != nil {
+		writeGameError(w, err)
+		return
+	}
+
+	event := audit.FromRequest(r, user.Id, "game.force-end", "game", gameId)
+	event.Before = map[string]interface{}{"status": state.Status}
+	event.After = map[string]interface{}{"status": "completed", "winnerId": body.WinnerId}
+	event.Details = map[string]interface{}{"amount": state.WinningAmount}
+	audit.Log(r.Context(), event)
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Game ended successfully",
+	})
+}
+
+func abortGame(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.GetUser(r)
+	gameId := mux.Vars(r)["id"]
+
+	state, err := gameManager.GetInstance().AdminAbortGame(r.Context(), gameId)
+	if err != nil {
+		writeGameError(w, err)
+		return
+	}
+
+	event := audit.FromRequest(r, user.Id, "game.abort", "game", gameId)
+	event.Before = map[string]interface{}{"status": state.Status}
+	event.After = map[string]interface{}{"status": "aborted"}
+	event.Details = map[string]interface{}{"participants": state.Participants, "refunded": state.EntryCollected}
+	audit.Log(r.Context(), event)
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Game aborted successfully",
+	})
+}
+
+func kickPlayer(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.GetUser(r)
+	gameId := mux.Vars(r)["id"]
+
+	var body KickPlayerRequestBody
+	err := lib.ReadJsonFromBody(r, w, &body)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusBadRequest, err.Error(), "")
+		return
+	}
+	if body.UserId == "" {
+		lib.ErrorJson(w, http.StatusBadRequest, "userId is required", "")
+		return
+	}
+
+	state, err := gameManager.GetInstance().KickPlayer(r.Context(), gameId, body.UserId)
+	if err != nil {
+		writeGameError(w, err)
+		return
+	}
+
+	event := audit.FromRequest(r, user.Id, "game.kick", "game", gameId)
+	event.Details = map[string]interface{}{"userId": body.UserId, "status": state.Status}
+	audit.Log(r.Context(), event)
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Player kicked successfully",
+	})
+}
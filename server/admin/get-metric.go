@@ -3,7 +3,6 @@ package admin
 import (
 	gameManager "flappy-bird-server/game-manager"
 	"flappy-bird-server/lib"
-	"flappy-bird-server/middleware"
 	"net/http"
 )
 
@@ -14,35 +13,24 @@ type Game struct {
 }
 
 func GetMetrics(w http.ResponseWriter, r *http.Request) {
-	user, err := middleware.CheckAccess(w, r)
-	if err != nil {
-		lib.ErrorJson(w, http.StatusUnauthorized, "Unauthorized", "")
-		return
-	}
-
-	if !user.IsAdmin {
-		lib.ErrorJson(w, http.StatusUnauthorized, "Unauthorized", "")
-		return
-	}
-
 	ongoingGames := []Game{}
-	for gameId, game := range gameManager.GetInstance().StartedGames {
+	for _, game := range gameManager.GetInstance().ListGames() {
 		users := make([]string, 0, len(game.Users))
 		for k := range game.Users {
 			users = append(users, k)
 		}
 
 		ongoingGames = append(ongoingGames, Game{
-			Id:     gameId,
+			Id:     game.Id,
 			Status: game.Status,
 			Users:  users,
 		})
 	}
 
-	activeUsers := make([]string, 0, len(gameManager.GetInstance().Users))
-	for k := range gameManager.GetInstance().Users {
-		activeUsers = append(activeUsers, k)
-	}
+	activeUsers := []string{}
+	gameManager.GetInstance().RangeUsers(func(user gameManager.User) {
+		activeUsers = append(activeUsers, user.Id)
+	})
 
 	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
 		"message": "success",
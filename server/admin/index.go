@@ -1,10 +1,28 @@
 package admin
 
 import (
+	"flappy-bird-server/middleware"
+	"net/http"
+
 	"github.com/gorilla/mux"
 )
 
 func Handler(r *mux.Router) {
-	r.HandleFunc("/metric", GetMetrics).Methods("GET")
-	r.HandleFunc("/maintenance", UpdateUnderMaintenance).Methods("GET")
+	r.Handle("/metric", middleware.RequirePermission("metrics:read")(http.HandlerFunc(GetMetrics))).Methods("GET")
+	r.Handle("/maintenance", middleware.RequirePermission("maintenance:write")(http.HandlerFunc(GetMaintenance))).Methods("GET")
+	r.Handle("/maintenance", middleware.RequirePermission("maintenance:write")(http.HandlerFunc(StartMaintenance))).Methods("POST")
+	r.Handle("/maintenance", middleware.RequirePermission("maintenance:write")(http.HandlerFunc(EndMaintenance))).Methods("DELETE")
+	r.Handle("/audit", middleware.RequirePermission("audit:read")(http.HandlerFunc(getAuditLogs))).Methods("GET")
+	r.Handle("/failed-operations", middleware.RequirePermission("operations:read")(http.HandlerFunc(getFailedOperations))).Methods("GET")
+	r.Handle("/failed-operations/{id}/replay", middleware.RequirePermission("operations:write")(http.HandlerFunc(replayFailedOperation))).Methods("POST")
+	r.Handle("/games/{id}", middleware.RequirePermission("games:read")(http.HandlerFunc(getGame))).Methods("GET")
+	r.Handle("/games/{id}/end", middleware.RequirePermission("games:write")(http.HandlerFunc(endGame))).Methods("POST")
+	r.Handle("/games/{id}/abort", middleware.RequirePermission("games:write")(http.HandlerFunc(abortGame))).Methods("POST")
+	r.Handle("/games/{id}/kick", middleware.RequirePermission("games:write")(http.HandlerFunc(kickPlayer))).Methods("POST")
+	r.Handle("/leaderboards/rebuild", middleware.RequirePermission("leaderboards:write")(http.HandlerFunc(rebuildLeaderboards))).Methods("POST")
+	r.Handle("/tournaments", middleware.RequirePermission("tournaments:write")(http.HandlerFunc(createTournament))).Methods("POST")
+	r.Handle("/tournaments/{id}/cancel", middleware.RequirePermission("tournaments:write")(http.HandlerFunc(cancelTournament))).Methods("POST")
+	r.Handle("/roles", middleware.RequirePermission("roles:write")(http.HandlerFunc(getRoles))).Methods("GET")
+	r.Handle("/roles/grant", middleware.RequirePermission("roles:write")(http.HandlerFunc(grantRole))).Methods("POST")
+	r.Handle("/roles/revoke", middleware.RequirePermission("roles:write")(http.HandlerFunc(revokeRole))).Methods("POST")
 }
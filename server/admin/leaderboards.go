@@ -0,0 +1,51 @@
+package admin
+
+import (
+	"errors"
+	"flappy-bird-server/audit"
+	gameManager "flappy-bird-server/game-manager"
+	"flappy-bird-server/lib"
+	"flappy-bird-server/middleware"
+	"net/http"
+)
+
+type RebuildLeaderboardsRequestBody struct {
+	Period string `json:"period"`
+}
+
+// rebuildLeaderboards recomputes the boards of one period, or of all of
+// them when no period is given, from Postgres.
+func rebuildLeaderboards(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.GetUser(r)
+
+	var body RebuildLeaderboardsRequestBody
+	if r.ContentLength > 0 {
+		if err := lib.ReadJsonFromBody(r, w, &body); err != nil {
+			lib.ErrorJson(w, http.StatusBadRequest, err.Error(), "")
+			return
+		}
+	}
+	periods := gameManager.LeaderboardPeriods
+	if body.Period != "" {
+		periods = []string{body.Period}
+	}
+
+	for _, period := range periods {
+		err := gameManager.GetInstance().RebuildLeaderboards(r.Context(), period)
+		if errors.Is(err, gameManager.ErrUnknownLeaderboard) {
+			lib.ErrorJson(w, http.StatusBadRequest, "period should be daily, weekly or alltime", "")
+			return
+		}
+		if err != nil {
+			lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+			return
+		}
+	}
+
+	event := audit.FromRequest(r, user.Id, "leaderboard.rebuild", "leaderboard", body.Period)
+	event.Details = map[string]interface{}{"periods": periods}
+	audit.Log(r.Context(), event)
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Leaderboards rebuilt successfully",
+	})
+}
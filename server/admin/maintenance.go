@@ -0,0 +1,83 @@
+package admin
+
+import (
+	"flappy-bird-server/audit"
+	gameManager "flappy-bird-server/game-manager"
+	"flappy-bird-server/lib"
+	"flappy-bird-server/middleware"
+	"net/http"
+	"time"
+)
+
+type MaintenanceRequestBody struct {
+	Message  string     `json:"message"`
+	StartsAt *time.Time `json:"startsAt"`
+	EndsAt   *time.Time `json:"endsAt"`
+}
+
+func GetMaintenance(w http.ResponseWriter, r *http.Request) {
+	maintenance := gameManager.GetInstance().GetMaintenance()
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message":       "success",
+		"data":          maintenance.Payload(time.Now()),
+		"currentStatus": maintenance.IsActive(time.Now()),
+	})
+}
+
+// StartMaintenance starts maintenance now, or schedules it when startsAt
+// is in the future. Running games are left to finish while new joins are
+// refused.
+func StartMaintenance(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.GetUser(r)
+
+	var body MaintenanceRequestBody
+	err := lib.ReadJsonFromBody(r, w, &body)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusBadRequest, err.Error(), "")
+		return
+	}
+
+	startsAt := time.Time{}
+	if body.StartsAt != nil {
+		startsAt = *body.StartsAt
+	}
+
+	before := gameManager.GetInstance().GetMaintenance()
+	maintenance, err := gameManager.GetInstance().ScheduleMaintenance(r.Context(), body.Message, startsAt, body.EndsAt, user.Id)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusBadRequest, err.Error(), "")
+		return
+	}
+
+	event := audit.FromRequest(r, user.Id, "maintenance.start", "maintenance", maintenance.Id)
+	event.Before = before
+	event.After = maintenance
+	audit.Log(r.Context(), event)
+
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message":       "Maintenance status updated successfully",
+		"data":          maintenance.Payload(time.Now()),
+		"currentStatus": maintenance.IsActive(time.Now()),
+	})
+}
+
+func EndMaintenance(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.GetUser(r)
+	before := gameManager.GetInstance().GetMaintenance()
+	err := gameManager.GetInstance().EndMaintenance(r.Context())
+	if err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	if before != nil {
+		event := audit.FromRequest(r, user.Id, "maintenance.end", "maintenance", before.Id)
+		event.Before = before
+		audit.Log(r.Context(), event)
+	}
+
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message":       "Maintenance status updated successfully",
+		"currentStatus": false,
+	})
+}
@@ -0,0 +1,150 @@
+package admin
+
+import (
+	"flappy-bird-server/audit"
+	"flappy-bird-server/lib"
+	"flappy-bird-server/middleware"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type Role struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type RoleRequestBody struct {
+	// UserId accepts either the user id or the wallet public key.
+	UserId string `json:"userId"`
+	Role   string `json:"role"`
+}
+
+func getRoles(w http.ResponseWriter, r *http.Request) {
+	rows, err := lib.Pool.Query(r.Context(), `SELECT r.name, COALESCE(r.description, ''), COALESCE(rp.permission, '') FROM public.roles r LEFT JOIN public.role_permissions rp ON rp.role = r.name ORDER BY r.name, rp.permission`)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	defer rows.Close()
+
+	roles := []Role{}
+	for rows.Next() {
+		var name, description, permission string
+		if err := rows.Scan(&name, &description, &permission); err != nil {
+			lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+			return
+		}
+		if len(roles) == 0 || roles[len(roles)-1].Name != name {
+			roles = append(roles, Role{Name: name, Description: description, Permissions: []string{}})
+		}
+		if permission != "" {
+			roles[len(roles)-1].Permissions = append(roles[len(roles)-1].Permissions, permission)
+		}
+	}
+
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "success",
+		"data":    roles,
+	})
+}
+
+func readRoleRequest(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	var body RoleRequestBody
+	err := lib.ReadJsonFromBody(r, w, &body)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusBadRequest, err.Error(), "")
+		return "", "", false
+	}
+	if body.UserId == "" || body.Role == "" {
+		lib.ErrorJson(w, http.StatusBadRequest, "userId and role are required", "")
+		return "", "", false
+	}
+
+	var userId string
+	err = lib.Pool.QueryRow(r.Context(), `SELECT id FROM public.users WHERE id = $1 OR email = $1`, body.UserId).Scan(&userId)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			lib.ErrorJson(w, http.StatusNotFound, "User not found", "")
+			return "", "", false
+		}
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return "", "", false
+	}
+
+	var role string
+	err = lib.Pool.QueryRow(r.Context(), `SELECT name FROM public.roles WHERE name = $1`, body.Role).Scan(&role)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			lib.ErrorJson(w, http.StatusBadRequest, "Invalid role", "")
+			return "", "", false
+		}
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return "", "", false
+	}
+	return userId, role, true
+}
+
+func grantRole(w http.ResponseWriter, r *http.Request) {
+	actor, _ := middleware.GetUser(r)
+	userId, role, ok := readRoleRequest(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := lib.Pool.Exec(r.Context(), `INSERT INTO public.user_roles ("userId", role, "grantedBy") VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`, userId, role, actor.Id)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	if result.RowsAffected() > 0 {
+		event := audit.FromRequest(r, actor.Id, "role.grant", "user", userId)
+		event.After = map[string]interface{}{"role": role}
+		audit.Log(r.Context(), event)
+	}
+
+	// Roles travel in the access token, so the user signs in again to pick
+	// up the change.
+	if err := middleware.RevokeAllTokens(r.Context(), userId); err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Role granted successfully",
+	})
+}
+
+func revokeRole(w http.ResponseWriter, r *http.Request) {
+	actor, _ := middleware.GetUser(r)
+	userId, role, ok := readRoleRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if userId == actor.Id && role == lib.RoleAdmin {
+		lib.ErrorJson(w, http.StatusBadRequest, "You can not revoke your own admin role", "")
+		return
+	}
+
+	result, err := lib.Pool.Exec(r.Context(), `DELETE FROM public.user_roles WHERE "userId" = $1 AND role = $2`, userId, role)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	if result.RowsAffected() > 0 {
+		event := audit.FromRequest(r, actor.Id, "role.revoke", "user", userId)
+		event.Before = map[string]interface{}{"role": role}
+		audit.Log(r.Context(), event)
+	}
+
+	if err := middleware.RevokeAllTokens(r.Context(), userId); err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Role revoked successfully",
+	})
+}
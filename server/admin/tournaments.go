@@ -0,0 +1,91 @@
+package admin
+
+import (
+	"errors"
+	"flappy-bird-server/audit"
+	gameManager "flappy-bird-server/game-manager"
+	"flappy-bird-server/lib"
+	"flappy-bird-server/middleware"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type CreateTournamentRequestBody struct {
+	Title      string    `json:"title"`
+	GameTypeId string    `json:"gameTypeId"`
+	StartsAt   time.Time `json:"startsAt"`
+	Capacity   int       `json:"capacity"`
+	BuyIn      int       `json:"buyIn"`
+	PrizeTable []int     `json:"prizeTable"`
+	TableSize  int       `json:"tableSize"`
+	Advance    int       `json:"advance"`
+}
+
+func createTournament(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.GetUser(r)
+
+	var body CreateTournamentRequestBody
+	if err := lib.ReadJsonFromBody(r, w, &body); err != nil {
+		lib.ErrorJson(w, http.StatusBadRequest, err.Error(), "")
+		return
+	}
+
+	tournament, err := gameManager.GetInstance().CreateTournament(r.Context(), gameManager.Tournament{
+		Title:      body.Title,
+		GameTypeId: body.GameTypeId,
+		StartsAt:   body.StartsAt,
+		Capacity:   body.Capacity,
+		BuyIn:      body.BuyIn,
+		PrizeTable: body.PrizeTable,
+		TableSize:  body.TableSize,
+		Advance:    body.Advance,
+		CreatedBy:  user.Id,
+	})
+	if errors.Is(err, gameManager.ErrInvalidTournament) {
+		lib.ErrorJson(w, http.StatusBadRequest, err.Error(), "")
+		return
+	}
+	if err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	event := audit.FromRequest(r, user.Id, "tournament.create", "tournament", tournament.Id)
+	event.After = map[string]interface{}{"tournament": tournament}
+	audit.Log(r.Context(), event)
+	lib.WriteJson(w, http.StatusCreated, map[string]interface{}{
+		"message": "Tournament created successfully",
+		"data":    tournament,
+	})
+}
+
+// cancelTournament stops a tournament that hasn't finished and refunds
+// every buy-in.
+func cancelTournament(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.GetUser(r)
+	tournamentId := mux.Vars(r)["id"]
+
+	tournament, err := gameManager.GetInstance().CancelTournament(r.Context(), tournamentId)
+	switch {
+	case errors.Is(err, gameManager.ErrTournamentNotFound):
+		lib.ErrorJson(w, http.StatusNotFound, "Tournament not found", "")
+		return
+	case errors.Is(err, gameManager.ErrInvalidTournament):
+		lib.ErrorJson(w, http.StatusConflict, err.Error(), "")
+		return
+	case err != nil:
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	event := audit.FromRequest(r, user.Id, "tournament.cancel", "tournament", tournamentId)
+	event.Before = map[string]interface{}{"status": tournament.Status}
+	event.After = map[string]interface{}{"status": "cancelled"}
+	event.Details = map[string]interface{}{"entrants": tournament.Entrants, "refunded": tournament.Pool}
+	audit.Log(r.Context(), event)
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Tournament cancelled successfully",
+	})
+}
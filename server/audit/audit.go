@@ -0,0 +1,117 @@
+package audit
+
+import (
+	"context"
+	"flappy-bird-server/lib"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Event is one row of the append-only audit_logs table. ActorId is empty
+// for actions the server takes on its own, like paying out a prize.
+type Event struct {
+	Id         string                 `json:"id"`
+	ActorId    string                 `json:"actorId"`
+	Action     string                 `json:"action"`
+	TargetType string                 `json:"targetType"`
+	TargetId   string                 `json:"targetId"`
+	Before     interface{}            `json:"before"`
+	After      interface{}            `json:"after"`
+	Details    map[string]interface{} `json:"details"`
+	Ip         string                 `json:"ip"`
+	RequestId  string                 `json:"requestId"`
+	CreatedAt  time.Time              `json:"createdAt"`
+}
+
+// Execer is satisfied by both lib.Pool and a pgx.Tx, so an event can be
+// written in the same transaction as the change it describes.
+type Execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+// FromRequest starts an event for an action taken through the API.
+func FromRequest(r *http.Request, actorId string, action string, targetType string, targetId string) Event {
+	return Event{
+		ActorId:    actorId,
+		Action:     action,
+		TargetType: targetType,
+		TargetId:   targetId,
+		Ip:         ClientIp(r),
+		RequestId:  r.Header.Get("X-Request-Id"),
+	}
+}
+
+// ClientIp returns the address of the client behind a request. Forwarding
+// headers are only believed when the request comes from a trusted proxy,
+// anyone else could write whatever they like into them. X-Forwarded-For is
+// read from the right, past the trusted proxies, to the first hop they
+// didn't add themselves.
+func ClientIp(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !trusted(host) {
+		return host
+	}
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if i == 0 || !trusted(hop) {
+				return hop
+			}
+		}
+	}
+	if realIp := strings.TrimSpace(r.Header.Get("X-Real-Ip")); realIp != "" {
+		return realIp
+	}
+	return host
+}
+
+func trusted(address string) bool {
+	ip := net.ParseIP(address)
+	return ip != nil && lib.TrustedProxy(ip)
+}
+
+func nullable(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+func Record(ctx context.Context, db Execer, event Event) error {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(ctx, `INSERT INTO public.audit_logs (id, "actorId", action, "targetType", "targetId", before, after, details, ip, "requestId") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`, id.String(), nullable(event.ActorId), event.Action, event.TargetType, event.TargetId, event.Before, event.After, event.Details, nullable(event.Ip), nullable(event.RequestId))
+	return err
+}
+
+// Log records an event for an action that already happened, so a failure
+// is only logged.
+func Log(ctx context.Context, event Event) {
+	if err := Record(ctx, lib.Pool, event); err != nil {
+		slog.ErrorContext(ctx, "error recording audit event", "action", event.Action, "targetType", event.TargetType, "targetId", event.TargetId, "error", err)
+	}
+}
+
+// BalanceChange describes a change of delta to a user's solana balance
+// that left it at balance.
+func BalanceChange(action string, userId string, balance int, delta int) Event {
+	return Event{
+		Action:     action,
+		TargetType: "user",
+		TargetId:   userId,
+		Before:     map[string]interface{}{"solanaBalance": balance - delta},
+		After:      map[string]interface{}{"solanaBalance": balance},
+	}
+}
@@ -0,0 +1,44 @@
+package audit
+
+import (
+	"flappy-bird-server/config"
+	"flappy-bird-server/lib"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIp(t *testing.T) {
+	lib.Configure(config.Config{TrustedProxies: "10.0.0.0/8, 192.168.1.1"})
+	t.Cleanup(func() { lib.Configure(config.Config{}) })
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		realIp     string
+		want       string
+	}{
+		{"direct client", "203.0.113.7:5000", "", "", "203.0.113.7"},
+		{"untrusted peer can't forge", "203.0.113.7:5000", "1.2.3.4", "5.6.7.8", "203.0.113.7"},
+		{"trusted proxy", "10.0.0.2:5000", "198.51.100.9", "", "198.51.100.9"},
+		{"spoofed hop left of the real client", "10.0.0.2:5000", "1.2.3.4, 198.51.100.9", "", "198.51.100.9"},
+		{"chain of trusted proxies", "10.0.0.2:5000", "198.51.100.9, 192.168.1.1, 10.0.0.3", "", "198.51.100.9"},
+		{"real ip from trusted proxy", "192.168.1.1:5000", "", "198.51.100.9", "198.51.100.9"},
+		{"trusted proxy without headers", "10.0.0.2:5000", "", "", "10.0.0.2"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = test.remoteAddr
+			if test.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", test.forwarded)
+			}
+			if test.realIp != "" {
+				r.Header.Set("X-Real-Ip", test.realIp)
+			}
+			if got := ClientIp(r); got != test.want {
+				t.Errorf("ClientIp() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"flappy-bird-server/lib"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const MaxLimit = 100
+
+type Filter struct {
+	ActorId    string
+	Action     string
+	TargetType string
+	TargetId   string
+	From       *time.Time
+	To         *time.Time
+	Page       int
+	Limit      int
+}
+
+// List returns the events matching filter, newest first, together with
+// the total number of matches for pagination.
+func List(ctx context.Context, filter Filter) ([]Event, int, error) {
+	conditions := []string{}
+	args := []interface{}{}
+	where := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.ActorId != "" {
+		where(`"actorId" = $%d`, filter.ActorId)
+	}
+	if filter.Action != "" {
+		// A trailing dot matches a whole family, e.g. "balance."
+		if strings.HasSuffix(filter.Action, ".") {
+			where(`starts_with(action, $%d)`, filter.Action)
+		} else {
+			where(`action = $%d`, filter.Action)
+		}
+	}
+	if filter.TargetType != "" {
+		where(`"targetType" = $%d`, filter.TargetType)
+	}
+	if filter.TargetId != "" {
+		where(`"targetId" = $%d`, filter.TargetId)
+	}
+	if filter.From != nil {
+		where(`"createdAt" >= $%d`, *filter.From)
+	}
+	if filter.To != nil {
+		where(`"createdAt" < $%d`, *filter.To)
+	}
+
+	sql := ""
+	if len(conditions) > 0 {
+		sql = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := lib.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM public.audit_logs`+sql, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	if filter.Limit <= 0 || filter.Limit > MaxLimit {
+		filter.Limit = MaxLimit
+	}
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	args = append(args, filter.Limit, (filter.Page-1)*filter.Limit)
+	rows, err := lib.Pool.Query(ctx, fmt.Sprintf(`SELECT id, COALESCE("actorId", ''), action, "targetType", "targetId", COALESCE(before, 'null'::jsonb), COALESCE(after, 'null'::jsonb), COALESCE(details, 'null'::jsonb), COALESCE(ip, ''), COALESCE("requestId", ''), "createdAt" FROM public.audit_logs%s ORDER BY "createdAt" DESC, id LIMIT $%d OFFSET $%d`, sql, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		var event Event
+		var before, after json.RawMessage
+		if err := rows.Scan(&event.Id, &event.ActorId, &event.Action, &event.TargetType, &event.TargetId, &before, &after, &event.Details, &event.Ip, &event.RequestId, &event.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		event.Before = before
+		event.After = after
+		events = append(events, event)
+	}
+	return events, total, rows.Err()
+}
@@ -7,4 +7,9 @@ import (
 func Handler(r *mux.Router) {
 	r.HandleFunc("/register", register).Methods("POST")
 	r.HandleFunc("/login", login).Methods("POST")
+	r.HandleFunc("/siws/nonce", siwsNonce).Methods("POST")
+	r.HandleFunc("/siws/login", siwsLogin).Methods("POST")
+	r.HandleFunc("/refresh", refresh).Methods("POST")
+	r.HandleFunc("/logout", logout).Methods("POST")
+	r.HandleFunc("/logout-all", logoutAll).Methods("POST")
 }
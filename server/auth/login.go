@@ -4,10 +4,8 @@ import (
 	gameManager "flappy-bird-server/game-manager"
 	"flappy-bird-server/lib"
 	"flappy-bird-server/model"
-	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
-	"time"
 
 	"github.com/jackc/pgx/v5"
 )
@@ -18,26 +16,21 @@ type LoginRequestBody struct {
 }
 
 func login(w http.ResponseWriter, r *http.Request) {
-	log.Println("Login")
 	var body LoginRequestBody
 	err := lib.ReadJsonFromBody(r, w, &body)
 	if err != nil {
 		lib.ErrorJson(w, http.StatusBadRequest, err.Error(), "")
 		return
 	}
-	if len(body.Password) < 7 {
-		lib.ErrorJson(w, http.StatusBadRequest, "password length should be more than 7", "")
-		return
-	}
-	if len(body.Password) > 15 {
-		lib.ErrorJson(w, http.StatusBadRequest, "password length should be less then 16", "")
+	if err := lib.ValidatePassword(body.Password); err != nil {
+		lib.ErrorJson(w, http.StatusBadRequest, err.Error(), "")
 		return
 	}
 
 	var user model.User
 	var passwordHash string
 
-	getUserDetailsQuery := `SELECT id, name, email, "inrBalance", "solanaBalance", password  FROM public.users WHERE email = $1`
+	getUserDetailsQuery := `SELECT id, name, email, "inrBalance", "solanaBalance", COALESCE(password, '')  FROM public.users WHERE email = $1`
 	err = lib.Pool.QueryRow(r.Context(), getUserDetailsQuery, body.Identifier).Scan(&user.Id, &user.Name, &user.Email, &user.INRBalance, &user.SolanaBalance, &passwordHash)
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -47,23 +40,43 @@ func login(w http.ResponseWriter, r *http.Request) {
 		lib.ErrorJson(w, http.StatusBadRequest, err.Error(), "")
 		return
 	}
-	currentPasswordHash := lib.HashString(body.Password)
-	token, err := lib.GenerateToken(user.Id)
-	if err != nil {
-		lib.ErrorJson(w, http.StatusBadRequest, err.Error(), "")
+	if passwordHash == "" {
+		lib.ErrorJson(w, http.StatusBadRequest, "Password login is not enabled for this account, sign in with your wallet", "")
 		return
 	}
 
-	if passwordHash != currentPasswordHash {
+	valid, needsRehash, err := lib.VerifyPassword(body.Password, passwordHash)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	if !valid {
 		lib.ErrorJson(w, http.StatusBadRequest, "invalid password", "")
 		return
 	}
 
-	gameManager.GetInstance().RedisClient.Set(r.Context(), fmt.Sprintf("mr-balance-%s", user.Id), user.SolanaBalance, 24*time.Hour)
+	if needsRehash {
+		upgradedHash, err := lib.HashPassword(body.Password)
+		if err == nil {
+			_, err = lib.Pool.Exec(r.Context(), `UPDATE public.users SET password = $2 WHERE id = $1 AND password = $3`, user.Id, upgradedHash, passwordHash)
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error upgrading password hash", "userId", user.Id, "error", err)
+		}
+	}
+
+	token, refreshToken, err := issueSession(r.Context(), r, user.Id)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusBadRequest, err.Error(), "")
+		return
+	}
+
+	gameManager.GetInstance().SetBalance(user.Id, int(user.SolanaBalance))
 
 	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
-		"message": "Login successfully",
-		"token":   token,
-		"data":    user,
+		"message":      "Login successfully",
+		"token":        token,
+		"refreshToken": refreshToken,
+		"data":         user,
 	})
 }
@@ -25,19 +25,15 @@ func register(w http.ResponseWriter, r *http.Request) {
 		lib.ErrorJson(w, http.StatusBadRequest, err.Error(), "")
 		return
 	}
-	if len(body.Password) < 7 {
-		lib.ErrorJson(w, http.StatusBadRequest, "password length should be more than 7", "")
-		return
-	}
-	if len(body.Password) > 15 {
-		lib.ErrorJson(w, http.StatusBadRequest, "password length should be less then 16", "")
+	if err := lib.ValidatePassword(body.Password); err != nil {
+		lib.ErrorJson(w, http.StatusBadRequest, err.Error(), "")
 		return
 	}
 
 	var user model.User
 	var passwordHash string
 
-	getUserDetailsQuery := `SELECT id, name, email, "inrBalance", "solanaBalance", password  FROM public.users WHERE email = $1`
+	getUserDetailsQuery := `SELECT id, name, email, "inrBalance", "solanaBalance", COALESCE(password, '')  FROM public.users WHERE email = $1`
 	err = lib.Pool.QueryRow(r.Context(), getUserDetailsQuery, body.Identifier).Scan(&user.Id, &user.Name, &user.Email, &user.INRBalance, &user.SolanaBalance, &passwordHash)
 	if err == nil {
 		lib.ErrorJson(w, http.StatusBadRequest, "User already exist", "")
@@ -69,21 +65,26 @@ func register(w http.ResponseWriter, r *http.Request) {
 		lib.ErrorJson(w, http.StatusBadRequest, err.Error(), "")
 		return
 	}
-	passwordHash = lib.HashString(body.Password)
+	passwordHash, err = lib.HashPassword(body.Password)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
 	err = lib.Pool.QueryRow(r.Context(), "INSERT INTO public.users (id, name, email, password) VALUES ($1, $2, $3, $4) RETURNING id, name, email", newUserId.String(), body.Identifier, body.Identifier, passwordHash).Scan(&user.Id, &user.Name, &user.Email)
 	if err != nil {
 		lib.ErrorJson(w, http.StatusBadRequest, err.Error(), "")
 		return
 	}
-	token, err := lib.GenerateToken(user.Id)
+	token, refreshToken, err := issueSession(r.Context(), r, user.Id)
 	if err != nil {
 		lib.ErrorJson(w, http.StatusBadRequest, err.Error(), "")
 		return
 	}
 	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
-		"message": "Registered successfully",
-		"token":   token,
-		"data":    user,
+		"message":      "Registered successfully",
+		"token":        token,
+		"refreshToken": refreshToken,
+		"data":         user,
 	})
 
 	// currentPasswordHash := lib.HashString(body.Password)
@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"context"
+	"flappy-bird-server/lib"
+	"flappy-bird-server/middleware"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type RefreshRequestBody struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type refreshTokenRow struct {
+	Id        string
+	UserId    string
+	FamilyId  string
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+}
+
+func insertRefreshToken(ctx context.Context, tx pgx.Tx, r *http.Request, userId string, familyId string) (string, string, error) {
+	refreshToken, refreshTokenHash, err := lib.GenerateRefreshToken()
+	if err != nil {
+		return "", "", err
+	}
+	refreshTokenId, err := uuid.NewRandom()
+	if err != nil {
+		return "", "", err
+	}
+	_, err = tx.Exec(ctx, `INSERT INTO public.refresh_tokens (id, "userId", "tokenHash", "familyId", "userAgent", "ipAddress", "expiresAt") VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		refreshTokenId.String(), userId, refreshTokenHash, familyId, r.UserAgent(), r.RemoteAddr, time.Now().Add(lib.RefreshTokenTTL))
+	if err != nil {
+		return "", "", err
+	}
+	return refreshTokenId.String(), refreshToken, nil
+}
+
+func generateAccessToken(ctx context.Context, userId string) (string, error) {
+	roles, permissions, err := lib.GetUserRoles(ctx, userId)
+	if err != nil {
+		return "", err
+	}
+	return lib.GenerateToken(userId, roles, permissions)
+}
+
+// issueSession creates an access token and starts a new refresh token
+// family for the user.
+func issueSession(ctx context.Context, r *http.Request, userId string) (string, string, error) {
+	token, err := generateAccessToken(ctx, userId)
+	if err != nil {
+		return "", "", err
+	}
+
+	familyId, err := uuid.NewRandom()
+	if err != nil {
+		return "", "", err
+	}
+
+	tx, err := lib.Pool.Begin(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	defer tx.Rollback(ctx)
+
+	_, refreshToken, err := insertRefreshToken(ctx, tx, r, userId, familyId.String())
+	if err != nil {
+		return "", "", err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return "", "", err
+	}
+	return token, refreshToken, nil
+}
+
+func refresh(w http.ResponseWriter, r *http.Request) {
+	var body RefreshRequestBody
+	err := lib.ReadJsonFromBody(r, w, &body)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusBadRequest, err.Error(), "")
+		return
+	}
+	if body.RefreshToken == "" {
+		lib.ErrorJson(w, http.StatusBadRequest, "Refresh token is required", "")
+		return
+	}
+
+	var current refreshTokenRow
+	err = lib.Pool.QueryRow(r.Context(), `SELECT id, "userId", "familyId", "expiresAt", "revokedAt" FROM public.refresh_tokens WHERE "tokenHash" = $1`, lib.HashRefreshToken(body.RefreshToken)).Scan(&current.Id, &current.UserId, &current.FamilyId, &current.ExpiresAt, &current.RevokedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			lib.ErrorJson(w, http.StatusUnauthorized, "Invalid refresh token", "")
+			return
+		}
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	if current.RevokedAt != nil {
+		// A rotated token being presented again means it leaked, so the
+		// whole family is burned and the user has to sign in again.
+		_, err = lib.Pool.Exec(r.Context(), `UPDATE public.refresh_tokens SET "revokedAt" = NOW() WHERE "familyId" = $1 AND "revokedAt" IS NULL`, current.FamilyId)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error revoking refresh token family", "familyId", current.FamilyId, "error", err)
+		}
+		lib.ErrorJson(w, http.StatusUnauthorized, "Refresh token has been revoked", "")
+		return
+	}
+
+	if time.Now().After(current.ExpiresAt) {
+		lib.ErrorJson(w, http.StatusUnauthorized, "Refresh token has expired", "")
+		return
+	}
+
+	tx, err := lib.Pool.Begin(r.Context())
+	if err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	nextId, refreshToken, err := insertRefreshToken(r.Context(), tx, r, current.UserId, current.FamilyId)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	result, err := tx.Exec(r.Context(), `UPDATE public.refresh_tokens SET "revokedAt" = NOW(), "replacedById" = $2 WHERE id = $1 AND "revokedAt" IS NULL`, current.Id, nextId)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	if result.RowsAffected() == 0 {
+		lib.ErrorJson(w, http.StatusUnauthorized, "Refresh token has been revoked", "")
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	token, err := generateAccessToken(r.Context(), current.UserId)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message":      "Token refreshed successfully",
+		"token":        token,
+		"refreshToken": refreshToken,
+	})
+}
+
+func logout(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseToken(r)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusUnauthorized, "Unauthorized", "")
+		return
+	}
+
+	var body RefreshRequestBody
+	if r.ContentLength != 0 {
+		if err := lib.ReadJsonFromBody(r, w, &body); err != nil {
+			lib.ErrorJson(w, http.StatusBadRequest, err.Error(), "")
+			return
+		}
+	}
+
+	if body.RefreshToken != "" {
+		_, err = lib.Pool.Exec(r.Context(), `UPDATE public.refresh_tokens SET "revokedAt" = NOW() WHERE "tokenHash" = $1 AND "userId" = $2 AND "revokedAt" IS NULL`, lib.HashRefreshToken(body.RefreshToken), claims.Id)
+		if err != nil {
+			lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+			return
+		}
+	}
+
+	if err := middleware.RevokeToken(r.Context(), claims); err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Logged out successfully",
+	})
+}
+
+func logoutAll(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.ParseToken(r)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusUnauthorized, "Unauthorized", "")
+		return
+	}
+
+	if err := middleware.RevokeAllTokens(r.Context(), claims.Id); err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	if err := middleware.RevokeToken(r.Context(), claims); err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Logged out from all sessions",
+	})
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+	gameManager "flappy-bird-server/game-manager"
+	"flappy-bird-server/lib"
+	"flappy-bird-server/model"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/mr-tron/base58/base58"
+	"github.com/redis/go-redis/v9"
+)
+
+type SiwsNonceRequestBody struct {
+	Identifier string `json:"identifier"`
+}
+
+type SiwsLoginRequestBody struct {
+	Identifier string  `json:"identifier"`
+	Nonce      string  `json:"nonce"`
+	Signature  []uint8 `json:"signature"`
+}
+
+type siwsChallenge struct {
+	Address   string `json:"address"`
+	Message   string `json:"message"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+func siwsNonceKey(nonce string) string {
+	return fmt.Sprintf("mr-siws-nonce-%s", nonce)
+}
+
+func siwsNonce(w http.ResponseWriter, r *http.Request) {
+	var body SiwsNonceRequestBody
+	err := lib.ReadJsonFromBody(r, w, &body)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusBadRequest, err.Error(), "")
+		return
+	}
+
+	if _, err := base58.Decode(body.Identifier); err != nil || body.Identifier == "" {
+		lib.ErrorJson(w, http.StatusBadRequest, "Invalid public key", "")
+		return
+	}
+
+	nonce, err := lib.GenerateNonce()
+	if err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, "Something went wrong while generating nonce", "")
+		return
+	}
+
+	message := lib.NewSiwsMessage(body.Identifier, nonce)
+	challenge := siwsChallenge{
+		Address:   body.Identifier,
+		Message:   message.String(),
+		ExpiresAt: message.ExpirationTime.Unix(),
+	}
+
+	err = gameManager.GetInstance().RedisClient.Set(r.Context(), siwsNonceKey(nonce), lib.Stringify(challenge), lib.SiwsNonceTTL).Err()
+	if err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, "Something went wrong while storing nonce", "")
+		return
+	}
+
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "success",
+		"data": map[string]interface{}{
+			"nonce":     nonce,
+			"message":   challenge.Message,
+			"expiresAt": challenge.ExpiresAt,
+		},
+	})
+}
+
+func siwsLogin(w http.ResponseWriter, r *http.Request) {
+	var body SiwsLoginRequestBody
+	err := lib.ReadJsonFromBody(r, w, &body)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusBadRequest, err.Error(), "")
+		return
+	}
+
+	if body.Nonce == "" {
+		lib.ErrorJson(w, http.StatusBadRequest, "Nonce is required", "")
+		return
+	}
+
+	// GetDel makes the nonce single-use even if the signature turns out to
+	// be invalid, so a failed attempt always needs a fresh challenge.
+	stored, err := gameManager.GetInstance().RedisClient.GetDel(r.Context(), siwsNonceKey(body.Nonce)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			lib.ErrorJson(w, http.StatusUnauthorized, "Invalid or expired nonce", "")
+			return
+		}
+		lib.ErrorJson(w, http.StatusInternalServerError, "Something went wrong while reading nonce", "")
+		return
+	}
+
+	var challenge siwsChallenge
+	if err := gameManager.Parse(stored, &challenge); err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, "Something went wrong while reading nonce", "")
+		return
+	}
+
+	if challenge.Address != body.Identifier {
+		lib.ErrorJson(w, http.StatusUnauthorized, "Nonce was issued for a different public key", "")
+		return
+	}
+
+	if time.Now().Unix() > challenge.ExpiresAt {
+		lib.ErrorJson(w, http.StatusUnauthorized, "Invalid or expired nonce", "")
+		return
+	}
+
+	if !lib.VerifySiwsSignature(challenge.Address, challenge.Message, body.Signature) {
+		lib.ErrorJson(w, http.StatusUnauthorized, "Invalid signature", "")
+		return
+	}
+
+	var user model.User
+	getUserDetailsQuery := `SELECT id, name, email, "inrBalance", "solanaBalance" FROM public.users WHERE email = $1`
+	err = lib.Pool.QueryRow(r.Context(), getUserDetailsQuery, body.Identifier).Scan(&user.Id, &user.Name, &user.Email, &user.INRBalance, &user.SolanaBalance)
+	if err == pgx.ErrNoRows {
+		newUserId, err := uuid.NewRandom()
+		if err != nil {
+			lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+			return
+		}
+		err = lib.Pool.QueryRow(r.Context(), "INSERT INTO public.users (id, name, email) VALUES ($1, $2, $3) RETURNING id, name, email", newUserId.String(), body.Identifier, body.Identifier).Scan(&user.Id, &user.Name, &user.Email)
+		if err != nil {
+			lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+			return
+		}
+	} else if err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	token, refreshToken, err := issueSession(r.Context(), r, user.Id)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	gameManager.GetInstance().SetBalance(user.Id, int(user.SolanaBalance))
+
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message":      "Login successfully",
+		"token":        token,
+		"refreshToken": refreshToken,
+		"data":         user,
+	})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"flappy-bird-server/audit"
+	"flappy-bird-server/config"
+	gameManager "flappy-bird-server/game-manager"
+	"flappy-bird-server/lib"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+const failedOpsUsage = `usage:
+  failed-ops list [pending|replaying|resolved]
+  failed-ops replay <id>...`
+
+// runFailedOps lists and replays journaled operations from the command line,
+// e.g. "go run . failed-ops replay <id>". A running server picks the
+// replayed tasks up from the queue.
+func runFailedOps(cfg config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, failedOpsUsage)
+		return 2
+	}
+
+	lib.ConnectDB(cfg.DatabaseUrl)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	switch args[0] {
+	case "list":
+		status := "pending"
+		if len(args) > 1 {
+			status = args[1]
+		}
+		operations, err := gameManager.ListFailedOperations(ctx, status, 1000)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error listing failed operations:", err)
+			return 1
+		}
+		out := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(out, "ID\tTYPE\tSTATUS\tATTEMPTS\tCREATED\tERROR")
+		for _, operation := range operations {
+			fmt.Fprintf(out, "%s\t%s\t%s\t%d\t%s\t%s\n", operation.Id, operation.Type, operation.Status, operation.Attempts, operation.CreatedAt.Format(time.RFC3339), operation.Error)
+		}
+		out.Flush()
+		return 0
+	case "replay":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, failedOpsUsage)
+			return 2
+		}
+		client := gameManager.NewRedisClient(cfg)
+		defer client.Close()
+		queue := gameManager.NewDbQueue(client, cfg.QueueTimeout)
+
+		code := 0
+		for _, id := range args[1:] {
+			operation, err := gameManager.ReplayFailedOperation(ctx, &queue, id)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", id, err)
+				code = 1
+				continue
+			}
+			audit.Log(ctx, audit.Event{
+				Action:     "failed-operation.replay",
+				TargetType: "failed-operation",
+				TargetId:   operation.Id,
+				Details:    map[string]interface{}{"type": operation.Type, "payload": operation.Payload, "attempts": operation.Attempts, "source": "cli"},
+			})
+			fmt.Printf("%s: queued %s (attempt %d)\n", operation.Id, operation.Type, operation.Attempts)
+		}
+		return code
+	default:
+		fmt.Fprintln(os.Stderr, failedOpsUsage)
+		return 2
+	}
+}
@@ -0,0 +1,296 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// Config holds every setting the server reads at startup. Each field is
+// filled from, in increasing priority: its default, the config file, the
+// environment variable named by `env` and the command line flag named by
+// `flag`.
+type Config struct {
+	ListenAddr      string        `env:"LISTEN_ADDR" flag:"addr" default:":8080"`
+	FrontendUrl     string        `env:"FRONTEND_URL" required:"true"`
+	DatabaseUrl     string        `env:"DATABASE_URL" required:"true" secret:"true"`
+	RedisAddress    string        `env:"REDIS_ADDRESS" required:"true"`
+	RedisPassword   string        `env:"REDIS_PASSWORD" secret:"true"`
+	Secret          string        `env:"SECRET" required:"true" secret:"true"`
+	HeliusApiKey    string        `env:"HELIUS_API_KEY" required:"true" secret:"true"`
+	HeliusSecret    string        `env:"HELIUS_WEBHOOK_SECRET" required:"true" secret:"true"`
+	MetricsToken    string        `env:"METRICS_TOKEN" secret:"true"`
+	LogLevel        string        `env:"LOG_LEVEL" flag:"log-level" default:"info"`
+	QueueTimeout    time.Duration `env:"QUEUE_TIMEOUT" default:"10s"`
+	BalanceTTL      time.Duration `env:"BALANCE_TTL" default:"24h"`
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" default:"60s"`
+	Argon2Memory    uint32        `env:"ARGON2_MEMORY" default:"65536"`
+	Argon2Time      uint32        `env:"ARGON2_TIME" default:"3"`
+	Argon2Threads   uint8         `env:"ARGON2_THREADS" default:"2"`
+	// Matchmaking rating bands, see gameManager.RatingBand.
+	MatchmakingBand       uint32 `env:"MATCHMAKING_BAND" default:"100"`
+	MatchmakingBandGrowth uint32 `env:"MATCHMAKING_BAND_GROWTH" default:"200"`
+	MatchmakingMaxBand    uint32 `env:"MATCHMAKING_MAX_BAND" default:"1000"`
+	SpectatorLimit        uint32 `env:"SPECTATOR_LIMIT" default:"50"`
+	// ScoreboardInterval is the shortest gap between two scoreboard events
+	// of a game.
+	ScoreboardInterval time.Duration `env:"SCOREBOARD_INTERVAL" default:"500ms"`
+	// ReconnectGrace is how long a dropped player's seat is held for them to
+	// resume with their session token, valid for SessionTTL.
+	ReconnectGrace time.Duration `env:"RECONNECT_GRACE" default:"15s"`
+	SessionTTL     time.Duration `env:"SESSION_TTL" default:"24h"`
+	// TournamentRoundTimeout ends a tournament game that is still running
+	// with its current standings.
+	TournamentRoundTimeout time.Duration `env:"TOURNAMENT_ROUND_TIMEOUT" default:"10m"`
+	// TrustedProxies lists the reverse proxies, as CIDRs or addresses, whose
+	// X-Forwarded-For and X-Real-Ip headers are believed, comma separated.
+	TrustedProxies string `env:"TRUSTED_PROXIES"`
+}
+
+// DefaultFile is read when it exists and no other file was asked for.
+const DefaultFile = ".env"
+
+var logLevels = map[string]bool{"debug": true, "info": true, "warn": true, "error": true}
+
+// ValidationError lists every setting that is missing or could not be used,
+// so all of them can be fixed in one go.
+type ValidationError struct {
+	Missing []string
+	Invalid []string
+}
+
+func (err *ValidationError) Error() string {
+	problems := []string{}
+	if len(err.Missing) > 0 {
+		problems = append(problems, "missing required settings: "+strings.Join(err.Missing, ", "))
+	}
+	if len(err.Invalid) > 0 {
+		problems = append(problems, "invalid settings: "+strings.Join(err.Invalid, ", "))
+	}
+	return strings.Join(problems, "; ")
+}
+
+// Load builds the configuration from args (without the program name), the
+// environment and the file given by -config or CONFIG_FILE. It returns the
+// arguments left after the flags, e.g. a subcommand. A missing default file
+// is fine, a missing file that was asked for is not.
+func Load(args []string) (Config, []string, error) {
+	var cfg Config
+	fields := reflect.TypeOf(cfg)
+
+	flagSet := flag.NewFlagSet("server", flag.ContinueOnError)
+	flagSet.SetOutput(io.Discard)
+	configFile := flagSet.String("config", os.Getenv("CONFIG_FILE"), "path to a KEY=value config file")
+	flagValues := map[string]*string{}
+	for i := 0; i < fields.NumField(); i++ {
+		field := fields.Field(i)
+		if name := field.Tag.Get("flag"); name != "" {
+			flagValues[name] = flagSet.String(name, "", field.Tag.Get("env"))
+		}
+	}
+	if err := flagSet.Parse(args); err != nil {
+		return cfg, nil, err
+	}
+	setFlags := map[string]bool{}
+	flagSet.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+
+	fileValues := map[string]string{}
+	path := *configFile
+	if path == "" {
+		path = DefaultFile
+	}
+	values, err := godotenv.Read(path)
+	if err == nil {
+		fileValues = values
+	} else if *configFile != "" || !errors.Is(err, os.ErrNotExist) {
+		return cfg, nil, fmt.Errorf("reading config file %s: %w", path, err)
+	}
+
+	validation := &ValidationError{}
+	target := reflect.ValueOf(&cfg).Elem()
+	for i := 0; i < fields.NumField(); i++ {
+		field := fields.Field(i)
+		key := field.Tag.Get("env")
+
+		value := field.Tag.Get("default")
+		if fileValue, ok := fileValues[key]; ok {
+			value = fileValue
+		}
+		if envValue, ok := os.LookupEnv(key); ok {
+			value = envValue
+		}
+		if name := field.Tag.Get("flag"); setFlags[name] {
+			value = *flagValues[name]
+		}
+
+		value = strings.TrimSpace(value)
+		if value == "" {
+			if field.Tag.Get("required") == "true" {
+				validation.Missing = append(validation.Missing, key)
+			}
+			continue
+		}
+		if err := setField(target.Field(i), value); err != nil {
+			validation.Invalid = append(validation.Invalid, fmt.Sprintf("%s (%s)", key, err))
+		}
+	}
+
+	cfg.LogLevel = strings.ToLower(cfg.LogLevel)
+	validation.Invalid = append(validation.Invalid, cfg.invalid()...)
+	if len(validation.Missing) > 0 || len(validation.Invalid) > 0 {
+		return cfg, flagSet.Args(), validation
+	}
+	return cfg, flagSet.Args(), nil
+}
+
+func setField(field reflect.Value, value string) error {
+	if field.Type() == reflect.TypeOf(time.Duration(0)) {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return errors.New("not a duration")
+		}
+		field.SetInt(int64(duration))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Uint8, reflect.Uint32:
+		number, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if errors.Is(err, strconv.ErrRange) {
+			return fmt.Errorf("at most %d", uint64(1)<<field.Type().Bits()-1)
+		}
+		if err != nil {
+			return errors.New("not a number")
+		}
+		field.SetUint(number)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+// invalid checks the values that parsed but can't be used.
+func (cfg Config) invalid() []string {
+	invalid := []string{}
+	if !logLevels[cfg.LogLevel] {
+		invalid = append(invalid, "LOG_LEVEL (one of debug, info, warn, error)")
+	}
+	durations := []struct {
+		key   string
+		value time.Duration
+	}{
+		{"QUEUE_TIMEOUT", cfg.QueueTimeout},
+		{"BALANCE_TTL", cfg.BalanceTTL},
+		{"SHUTDOWN_TIMEOUT", cfg.ShutdownTimeout},
+		{"SCOREBOARD_INTERVAL", cfg.ScoreboardInterval},
+		{"RECONNECT_GRACE", cfg.ReconnectGrace},
+		{"SESSION_TTL", cfg.SessionTTL},
+		{"TOURNAMENT_ROUND_TIMEOUT", cfg.TournamentRoundTimeout},
+	}
+	for _, duration := range durations {
+		if duration.value <= 0 {
+			invalid = append(invalid, duration.key+" (must be positive)")
+		}
+	}
+	if _, err := cfg.ProxyNetworks(); err != nil {
+		invalid = append(invalid, "TRUSTED_PROXIES ("+err.Error()+")")
+	}
+	if cfg.Argon2Memory == 0 || cfg.Argon2Time == 0 || cfg.Argon2Threads == 0 {
+		invalid = append(invalid, "ARGON2_* (must be positive)")
+	}
+	return invalid
+}
+
+// ProxyNetworks parses TrustedProxies. A bare address is taken as a single
+// host.
+func (cfg Config) ProxyNetworks() ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+	for _, entry := range strings.Split(cfg.TrustedProxies, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("%s is not an address or CIDR", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not an address or CIDR", entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+type setting struct {
+	key   string
+	value string
+}
+
+// settings lists every field by its env name in declaration order, with
+// secrets masked. Unset secrets stay empty so it is still visible that they
+// are missing.
+func (cfg Config) settings() []setting {
+	fields := reflect.TypeOf(cfg)
+	values := reflect.ValueOf(cfg)
+	settings := make([]setting, 0, fields.NumField())
+	for i := 0; i < fields.NumField(); i++ {
+		field := fields.Field(i)
+		value := fmt.Sprint(values.Field(i).Interface())
+		if field.Tag.Get("secret") == "true" && value != "" {
+			value = "********"
+		}
+		settings = append(settings, setting{field.Tag.Get("env"), value})
+	}
+	return settings
+}
+
+// Redacted returns the settings keyed by env name with secrets masked.
+func (cfg Config) Redacted() map[string]string {
+	redacted := map[string]string{}
+	for _, setting := range cfg.settings() {
+		redacted[setting.key] = setting.value
+	}
+	return redacted
+}
+
+// String prints the redacted settings, one KEY=value per line.
+func (cfg Config) String() string {
+	var builder strings.Builder
+	for _, setting := range cfg.settings() {
+		fmt.Fprintf(&builder, "%s=%s\n", setting.key, setting.value)
+	}
+	return builder.String()
+}
+
+// LogValue keeps secrets out of the logs when the config is logged as an
+// attribute.
+func (cfg Config) LogValue() slog.Value {
+	attrs := []slog.Attr{}
+	for _, setting := range cfg.settings() {
+		attrs = append(attrs, slog.String(setting.key, setting.value))
+	}
+	return slog.GroupValue(attrs...)
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func setRequired(t *testing.T) {
+	t.Helper()
+	for _, key := range []string{"FRONTEND_URL", "DATABASE_URL", "REDIS_ADDRESS", "SECRET", "HELIUS_API_KEY", "HELIUS_WEBHOOK_SECRET"} {
+		t.Setenv(key, "set")
+	}
+}
+
+func TestLoadRejectsOutOfRangeArgon2Threads(t *testing.T) {
+	setRequired(t)
+	for value, want := range map[string]string{
+		"256": "ARGON2_THREADS (at most 255)",
+		"0":   "ARGON2_* (must be positive)",
+	} {
+		t.Setenv("ARGON2_THREADS", value)
+		_, _, err := Load([]string{"-config", "/dev/null"})
+		var validation *ValidationError
+		if !errors.As(err, &validation) {
+			t.Fatalf("ARGON2_THREADS=%s: expected a validation error, got %v", value, err)
+		}
+		if !strings.Contains(strings.Join(validation.Invalid, "; "), want) {
+			t.Errorf("ARGON2_THREADS=%s: invalid settings %v, want %q", value, validation.Invalid, want)
+		}
+	}
+}
+
+func TestLoadAcceptsMaxArgon2Threads(t *testing.T) {
+	setRequired(t)
+	t.Setenv("ARGON2_THREADS", "255")
+	cfg, _, err := Load([]string{"-config", "/dev/null"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Argon2Threads != 255 {
+		t.Errorf("Argon2Threads = %d, want 255", cfg.Argon2Threads)
+	}
+}
@@ -0,0 +1,254 @@
+package gameManager
+
+import (
+	"context"
+	"errors"
+	"flappy-bird-server/lib"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrGameNotFound = errors.New("game not found")
+var ErrGameNotOngoing = errors.New("game is not ongoing")
+var ErrNotParticipant = errors.New("user is not a participant of this game")
+
+type GameState struct {
+	Id             string    `json:"id"`
+	GameTypeId     string    `json:"gameTypeId"`
+	Status         string    `json:"status"`
+	EntryFee       int       `json:"entryFee"`
+	WinningAmount  int       `json:"winningAmount"`
+	MaxPlayer      int       `json:"maxPlayer"`
+	WinnerId       *string   `json:"winnerId"`
+	Participants   []string  `json:"participants"`
+	EntryCollected int       `json:"entryCollected"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+	// InMemory is this instance's copy of a running game, Staging the lobby
+	// stored in Redis while it is still filling up.
+	InMemory *Game `json:"inMemory"`
+	Staging  *Game `json:"staging"`
+}
+
+// InspectGame merges what Postgres, Redis and this instance's memory know
+// about a game.
+func (gameManager *GameManager) InspectGame(ctx context.Context, gameId string) (GameState, error) {
+	var state GameState
+	err := lib.Pool.QueryRow(ctx, `SELECT id, "gameTypeId", status, "entryFee", "winningAmount", "maxPlayer", "winnerId", "createdAt", "updatedAt" FROM public.games WHERE id = $1`, gameId).Scan(&state.Id, &state.GameTypeId, &state.Status, &state.EntryFee, &state.WinningAmount, &state.MaxPlayer, &state.WinnerId, &state.CreatedAt, &state.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return state, ErrGameNotFound
+	}
+	if err != nil {
+		return state, err
+	}
+
+	state.Participants, err = gameParticipants(ctx, gameId)
+	if err != nil {
+		return state, err
+	}
+	if state.Status != "staging" {
+		state.EntryCollected = state.EntryFee * len(state.Participants)
+	}
+
+	if game, exist := gameManager.GetGame(gameId); exist {
+		state.InMemory = game
+	}
+	if lobby, err := gameManager.GetLobby(ctx, state.GameTypeId, gameId); err == nil {
+		state.Staging = &lobby
+	}
+	return state, nil
+}
+
+func gameParticipants(ctx context.Context, gameId string) ([]string, error) {
+	participants := []string{}
+	rows, err := lib.Pool.Query(ctx, `SELECT "userId" FROM public.participants WHERE "gameId" = $1`, gameId)
+	if err != nil {
+		return participants, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var userId string
+		if err := rows.Scan(&userId); err != nil {
+			return participants, err
+		}
+		participants = append(participants, userId)
+	}
+	return participants, rows.Err()
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ForceEndGame settles an ongoing game with the chosen winner and tells
+// every instance to wrap it up.
+func (gameManager *GameManager) ForceEndGame(ctx context.Context, gameId string, winnerId string) (GameState, error) {
+	state, err := gameManager.InspectGame(ctx, gameId)
+	if err != nil {
+		return state, err
+	}
+	if state.Status != "ongoing" {
+		return state, ErrGameNotOngoing
+	}
+	if !contains(state.Participants, winnerId) {
+		return state, ErrNotParticipant
+	}
+
+	settled, err := SettleGame(ctx, gameId, winnerId, state.WinningAmount)
+	if err != nil {
+		return state, err
+	}
+	if !settled {
+		return state, ErrGameNotOngoing
+	}
+	// The instances holding the game wrap it up through finishGame, which
+	// must not settle it a second time.
+	gameManager.claimGameTask(ctx, gameId, "settle")
+	gameManager.RedisClient.Del(ctx, fmt.Sprintf("mr-balance-%s", winnerId))
+	gameManager.closeReplay(ctx, gameId, "force-ended", winnerId)
+
+	return state, gameManager.RedisClient.Publish(ctx, gameId, lib.Stringify(map[string]interface{}{
+		"type": "force-ended",
+		"data": map[string]interface{}{
+			"winnerId": winnerId,
+		},
+	})).Err()
+}
+
+// AdminAbortGame cancels a game. Ongoing games are refunded, lobbies that
+// never started are simply dissolved since no entry was collected yet.
+func (gameManager *GameManager) AdminAbortGame(ctx context.Context, gameId string) (GameState, error) {
+	state, err := gameManager.InspectGame(ctx, gameId)
+	if err != nil {
+		return state, err
+	}
+
+	switch state.Status {
+	case "ongoing":
+		err = RefundGame(ctx, map[string]interface{}{"gameId": gameId})
+		gameManager.closeReplay(ctx, gameId, "aborted", "")
+	case "staging":
+		_, err = lib.Pool.Exec(ctx, `UPDATE public.games SET status = $2, "updatedAt" = NOW() WHERE id = $1 AND status = $3`, gameId, "aborted", "staging")
+		if err == nil && state.Staging != nil {
+			err = gameManager.DeleteLobby(ctx, state.GameTypeId, gameId)
+			gameManager.clearUserLobby(ctx, lobbyUserIds(*state.Staging)...)
+		}
+	default:
+		return state, ErrGameNotOngoing
+	}
+	if err != nil {
+		return state, err
+	}
+
+	return state, gameManager.RedisClient.Publish(ctx, gameId, lib.Stringify(map[string]interface{}{
+		"type": "game-aborted",
+		"data": map[string]interface{}{
+			"gameId": gameId,
+		},
+	})).Err()
+}
+
+// KickPlayer eliminates a player from a running game, or takes them out of
+// the lobby if it hasn't started yet.
+func (gameManager *GameManager) KickPlayer(ctx context.Context, gameId string, userId string) (GameState, error) {
+	state, err := gameManager.InspectGame(ctx, gameId)
+	if err != nil {
+		return state, err
+	}
+	if !contains(state.Participants, userId) {
+		return state, ErrNotParticipant
+	}
+
+	switch state.Status {
+	case "ongoing":
+	case "staging":
+		if err := gameManager.RemoveFromLobby(ctx, state.GameTypeId, gameId, userId); err != nil {
+			return state, err
+		}
+	default:
+		return state, ErrGameNotOngoing
+	}
+
+	return state, gameManager.RedisClient.Publish(ctx, gameId, lib.Stringify(map[string]interface{}{
+		"type": "player-kicked",
+		"data": map[string]interface{}{
+			"userId": userId,
+		},
+	})).Err()
+}
+
+// RemoveFromLobby takes a user out of a staging lobby in Redis and drops
+// their participant row. A lobby left empty is closed, a private one left by
+// its host gets a new host.
+func (gameManager *GameManager) RemoveFromLobby(ctx context.Context, gameTypeId string, gameId string, userId string) error {
+	lobby, err := gameManager.GetLobby(ctx, gameTypeId, gameId)
+	if err == nil && lobby.Users[userId] {
+		delete(lobby.Users, userId)
+		delete(lobby.ScoreBoard, userId)
+		delete(lobby.Ratings, userId)
+		lobby.CurrentUserCount -= 1
+		if lobby.HostId == userId {
+			for remaining := range lobby.Users {
+				lobby.HostId = remaining
+				break
+			}
+		}
+		if lobby.CurrentUserCount <= 0 {
+			err = gameManager.closeLobby(ctx, lobby, "empty")
+		} else {
+			err = gameManager.SaveLobby(ctx, lobby)
+			gameManager.publishLobbyStatus(ctx, lobby)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	gameManager.clearUserLobby(ctx, userId)
+
+	_, err = lib.Pool.Exec(ctx, `DELETE FROM public.participants WHERE "gameId" = $1 AND "userId" = $2`, gameId, userId)
+	return err
+}
+
+// EndLocalGame wraps up a force-ended game like one that finished on its
+// own, with the winner the admin picked.
+func (gameManager *GameManager) EndLocalGame(gameId string, winnerId string) {
+	targetGame, exist := gameManager.GetGame(gameId)
+	if !exist {
+		return
+	}
+	gameManager.finishGame(targetGame, winnerId, "force-ended")
+}
+
+// PlayerKicked eliminates a kicked player from a running game like a normal
+// game over, or drops them from the local copy of a lobby.
+func (gameManager *GameManager) PlayerKicked(gameId string, userId string) {
+	if participant, exist := gameManager.GetUser(userId); exist && participant.CurrentGameId == gameId {
+		participant.SendMessage("kicked", map[string]interface{}{
+			"gameId": gameId,
+		})
+	}
+
+	targetGame, exist := gameManager.GetGame(gameId)
+	if exist && targetGame.Status == "ongoing" {
+		gameManager.GameOver(gameId, userId)
+		return
+	}
+
+	if exist {
+		delete(targetGame.Users, userId)
+		delete(targetGame.ScoreBoard, userId)
+		delete(targetGame.Ratings, userId)
+		targetGame.CurrentUserCount -= 1
+		gameManager.SetGame(*targetGame)
+	}
+	if participant, exist := gameManager.GetUser(userId); exist && participant.CurrentGameId == gameId {
+		gameManager.SetCurrentGame(userId, "")
+	}
+}
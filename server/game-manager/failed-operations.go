@@ -0,0 +1,172 @@
+package gameManager
+
+import (
+	"context"
+	"errors"
+	"flappy-bird-server/lib"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// failedOperationKey is added to the payload of a replayed task so the
+// worker can mark the journal row once the task has run.
+const failedOperationKey = "failedOperationId"
+
+var ErrOperationNotFound = errors.New("failed operation not found")
+var ErrOperationNotPending = errors.New("failed operation is not pending")
+
+// journaledTasks move money. When one of them fails it is moved out of the
+// queue into failed_operations so an admin can replay it.
+var journaledTasks = map[string]bool{
+	"collect-entry":  true,
+	"update-balance": true,
+	"settle-game":    true,
+	"refund-game":    true,
+}
+
+type FailedOperation struct {
+	Id         string                 `json:"id"`
+	Type       string                 `json:"type"`
+	Payload    map[string]interface{} `json:"payload"`
+	Error      string                 `json:"error"`
+	Source     string                 `json:"source"`
+	Status     string                 `json:"status"`
+	Attempts   int                    `json:"attempts"`
+	CreatedAt  time.Time              `json:"createdAt"`
+	UpdatedAt  time.Time              `json:"updatedAt"`
+	ResolvedAt *time.Time             `json:"resolvedAt"`
+}
+
+const failedOperationColumns = `id, type, payload, error, source, status::text, attempts, "createdAt", "updatedAt", "resolvedAt"`
+
+func scanFailedOperation(row pgx.Row) (FailedOperation, error) {
+	var operation FailedOperation
+	err := row.Scan(&operation.Id, &operation.Type, &operation.Payload, &operation.Error, &operation.Source, &operation.Status, &operation.Attempts, &operation.CreatedAt, &operation.UpdatedAt, &operation.ResolvedAt)
+	return operation, err
+}
+
+// RecordFailedOperation journals a task that could not run. When even that
+// fails the payload is logged so it can be recovered by hand.
+func RecordFailedOperation(ctx context.Context, taskType string, payload map[string]interface{}, source string, cause error) error {
+	id, err := uuid.NewRandom()
+	if err == nil {
+		_, err = lib.Pool.Exec(ctx, `INSERT INTO public.failed_operations (id, type, payload, error, source) VALUES ($1, $2, $3, $4, $5)`, id.String(), taskType, payload, cause.Error(), source)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error journaling failed task", "task", taskType, "payload", payload, "cause", cause, "error", err)
+		return err
+	}
+	slog.WarnContext(ctx, "journaled failed task", "task", taskType, "failedOperationId", id.String(), "error", cause)
+	return nil
+}
+
+func ListFailedOperations(ctx context.Context, status string, limit int) ([]FailedOperation, error) {
+	rows, err := lib.Pool.Query(ctx, `SELECT `+failedOperationColumns+` FROM public.failed_operations WHERE $1::text = '' OR status::text = $1 ORDER BY "createdAt" DESC LIMIT $2`, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	operations := []FailedOperation{}
+	for rows.Next() {
+		operation, err := scanFailedOperation(rows)
+		if err != nil {
+			return nil, err
+		}
+		operations = append(operations, operation)
+	}
+	return operations, rows.Err()
+}
+
+// ReplayFailedOperation puts a pending operation back on queue. The row
+// stays "replaying" until the worker resolves it or records a new error.
+func ReplayFailedOperation(ctx context.Context, queue *Queue, id string) (FailedOperation, error) {
+	operation, err := scanFailedOperation(lib.Pool.QueryRow(ctx, `UPDATE public.failed_operations SET status = 'replaying', attempts = attempts + 1, "updatedAt" = NOW() WHERE id = $1 AND status = 'pending' RETURNING `+failedOperationColumns, id))
+	if err == pgx.ErrNoRows {
+		var exists bool
+		if err := lib.Pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM public.failed_operations WHERE id = $1)`, id).Scan(&exists); err != nil {
+			return operation, err
+		}
+		if exists {
+			return operation, ErrOperationNotPending
+		}
+		return operation, ErrOperationNotFound
+	}
+	if err != nil {
+		return operation, err
+	}
+
+	data := map[string]interface{}{}
+	for key, value := range operation.Payload {
+		data[key] = value
+	}
+	data[failedOperationKey] = operation.Id
+	err = queue.Enqueue(ctx, map[string]interface{}{
+		"type": operation.Type,
+		"data": data,
+	})
+	if err != nil {
+		failOperation(ctx, operation.Id, err)
+		return operation, err
+	}
+	return operation, nil
+}
+
+func resolveOperation(ctx context.Context, id string) {
+	_, err := lib.Pool.Exec(ctx, `UPDATE public.failed_operations SET status = 'resolved', "resolvedAt" = NOW(), "updatedAt" = NOW() WHERE id = $1`, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "error resolving failed operation", "failedOperationId", id, "error", err)
+	}
+}
+
+// ResetStuckOperations puts operations back to pending that are still
+// "replaying" although their task is gone from the queue, because the
+// worker died before it could resolve or fail them. It runs after
+// RetryFailedTasks, which puts the tasks of live operations back on the
+// queue.
+func ResetStuckOperations(ctx context.Context, queue *Queue) error {
+	rows, err := lib.Pool.Query(ctx, `SELECT id FROM public.failed_operations WHERE status = 'replaying' AND "updatedAt" < $1`, time.Now().Add(-queue.timeout))
+	if err != nil {
+		return err
+	}
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		queued, err := queue.holds(ctx, id)
+		if err != nil {
+			return err
+		}
+		if queued {
+			continue
+		}
+		_, err = lib.Pool.Exec(ctx, `UPDATE public.failed_operations SET status = 'pending', error = $2, "updatedAt" = NOW() WHERE id = $1 AND status = 'replaying'`, id, "replay was lost before it finished")
+		if err != nil {
+			return err
+		}
+		slog.WarnContext(ctx, "reset stuck failed operation", "failedOperationId", id)
+	}
+	return nil
+}
+
+func failOperation(ctx context.Context, id string, cause error) error {
+	_, err := lib.Pool.Exec(ctx, `UPDATE public.failed_operations SET status = 'pending', error = $2, "updatedAt" = NOW() WHERE id = $1`, id, cause.Error())
+	if err != nil {
+		slog.ErrorContext(ctx, "error updating failed operation", "failedOperationId", id, "error", err)
+	}
+	return err
+}
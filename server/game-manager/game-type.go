@@ -0,0 +1,61 @@
+package gameManager
+
+import (
+	"context"
+	"flappy-bird-server/lib"
+	"flappy-bird-server/model"
+	"sync"
+	"time"
+)
+
+const gameTypeCacheTTL = 10 * time.Hour
+
+type GameTypeMap struct {
+	LastUpdated int
+	GameType    model.GameType
+}
+
+var gameTypeMap = map[string]GameTypeMap{}
+var gameTypeMapMu sync.RWMutex
+
+// GetGameType returns a game type from the in-process cache, loading it
+// from Postgres when missing or stale. Archived types come back inactive.
+func (gameManager *GameManager) GetGameType(gameTypeId string) (model.GameType, error) {
+	gameTypeMapMu.RLock()
+	cached, exist := gameTypeMap[gameTypeId]
+	gameTypeMapMu.RUnlock()
+	if exist && time.Since(time.Unix(int64(cached.LastUpdated), 0)) < gameTypeCacheTTL {
+		return cached.GameType, nil
+	}
+
+	var gameType model.GameType
+	err := lib.Pool.QueryRow(gameManager.Context, `SELECT id, title, currency, "maxPlayer", "minPlayer", "lobbyTimeout", winner, entry, active AND "archivedAt" IS NULL, "sortOrder" FROM public.gametypes WHERE id = $1`, gameTypeId).Scan(&gameType.Id, &gameType.Title, &gameType.Currency, &gameType.MaxPlayer, &gameType.MinPlayer, &gameType.LobbyTimeout, &gameType.Winner, &gameType.Entry, &gameType.Active, &gameType.SortOrder)
+	if err != nil {
+		return model.GameType{}, err
+	}
+
+	gameTypeMapMu.Lock()
+	gameTypeMap[gameTypeId] = GameTypeMap{
+		LastUpdated: int(time.Now().Unix()),
+		GameType:    gameType,
+	}
+	gameTypeMapMu.Unlock()
+	return gameType, nil
+}
+
+func (gameManager *GameManager) forgetGameType(gameTypeId string) {
+	gameTypeMapMu.Lock()
+	defer gameTypeMapMu.Unlock()
+	delete(gameTypeMap, gameTypeId)
+}
+
+// InvalidateGameType drops the cached game type on every instance.
+func (gameManager *GameManager) InvalidateGameType(ctx context.Context, gameTypeId string) error {
+	gameManager.forgetGameType(gameTypeId)
+	return gameManager.RedisClient.Publish(ctx, "mari-arena-global", lib.Stringify(map[string]interface{}{
+		"type": "gametype-updated",
+		"data": map[string]interface{}{
+			"gameTypeId": gameTypeId,
+		},
+	})).Err()
+}
@@ -1,8 +1,12 @@
 package gameManager
 
+import "time"
+
 type Score struct {
 	IsAlive bool `json:"isAlive"`
 	Points  int  `json:"points"`
+	// EliminatedAt is in unix milliseconds, it ranks players level on points.
+	EliminatedAt int64 `json:"eliminatedAt,omitempty"`
 }
 
 type Game struct {
@@ -15,6 +19,18 @@ type Game struct {
 	Users            map[string]bool
 	Status           string
 	ScoreBoard       map[string]Score
+	Ratings          map[string]float64
+	CreatedAt        time.Time
+	// Private lobbies are only joined through InviteCode and started by
+	// their host.
+	Private    bool
+	HostId     string
+	InviteCode string
+	// TournamentId is set on the round games of a tournament.
+	TournamentId string
+	// Seed is handed to every client at the start so they all generate the
+	// same course, and kept in the replay.
+	Seed int64
 }
 
 func (game *Game) UpdateScore(userId string) {
@@ -29,6 +45,13 @@ func (game *Game) GameOver(userId string) {
 	userScoreCard, exist := game.ScoreBoard[userId]
 	if exist && userScoreCard.IsAlive {
 		userScoreCard.IsAlive = false
+		userScoreCard.EliminatedAt = time.Now().UnixMilli()
 		game.ScoreBoard[userId] = userScoreCard
 	}
 }
+
+// ProRatePrize scales the prize down to the players actually seated, for
+// games that start before they are full.
+func (game *Game) ProRatePrize() {
+	game.WinnerPrice = game.WinnerPrice * game.CurrentUserCount / game.MaxUserCount
+}
@@ -0,0 +1,83 @@
+package gameManager
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGameOverSettlesWinnerConnectedElsewhere(t *testing.T) {
+	first, _ := newTestManager(t)
+	second := managerOn(first.RedisClient)
+	first.RedisClient.Set(context.Background(), "mr-balance-winner", 100, 0)
+
+	// Only the loser is connected, to the second instance. The winner's
+	// instance went away.
+	loserConn := connectUser(t, second, "loser")
+	second.SetCurrentGame("loser", "game")
+
+	for _, instance := range []*GameManager{first, second} {
+		game := ongoingGame("game", "winner", "loser")
+		game.ScoreBoard["winner"] = Score{Points: 3, IsAlive: true}
+		instance.SetGame(game)
+		instance.GameOver("game", "winner")
+		instance.GameOver("game", "loser")
+	}
+
+	settlements := queuedTasks(t, &first.DbQueue, "settle-game")
+	if len(settlements) != 1 {
+		t.Fatalf("%d settlements enqueued, want 1", len(settlements))
+	}
+	if settlements[0]["winnerId"] != "winner" {
+		t.Errorf("settled %v, want winner", settlements[0]["winnerId"])
+	}
+
+	for userId, want := range map[string]float64{"winner": 8, "loser": -10} {
+		net, err := first.RedisClient.ZScore(context.Background(), leaderboardKey("type", "alltime", "winnings"), userId).Result()
+		if err != nil || net != want {
+			t.Errorf("winnings of %s = %v (%v), want %v", userId, net, err, want)
+		}
+	}
+
+	types := readMessageTypes(t, loserConn)
+	if len(types) == 0 || types[len(types)-1] != "loser" {
+		t.Errorf("loser got %v, want a loser frame last", types)
+	}
+}
+
+func TestForceEndedGameFinishesLikeAnyOther(t *testing.T) {
+	gameManager, server := newTestManager(t)
+
+	game := ongoingGame("round", "leader", "chosen")
+	game.TournamentId = "cup"
+	game.ScoreBoard["leader"] = Score{Points: 5, IsAlive: true}
+	gameManager.SetGame(game)
+	if err := gameManager.saveGameSnapshot(context.Background(), game); err != nil {
+		t.Fatal(err)
+	}
+
+	// ForceEndGame settled the game before telling the instances.
+	gameManager.claimGameTask(context.Background(), "round", "settle")
+	gameManager.EndLocalGame("round", "chosen")
+
+	finished := queuedTasks(t, &gameManager.DbQueue, "tournament-game-finished")
+	if len(finished) != 1 {
+		t.Fatalf("%d tournament results enqueued, want 1", len(finished))
+	}
+	if results, _ := finished[0]["results"].([]interface{}); len(results) != 2 || results[0] != "chosen" {
+		t.Errorf("results = %v, want the admin's winner first", finished[0]["results"])
+	}
+	if settlements := queuedTasks(t, &gameManager.DbQueue, "settle-game"); len(settlements) != 0 {
+		t.Errorf("%d settlements enqueued after the admin settled", len(settlements))
+	}
+	for _, taskType := range []string{"update-ratings", "record-scores"} {
+		if tasks := queuedTasks(t, &gameManager.DbQueue, taskType); len(tasks) != 1 {
+			t.Errorf("%d %s tasks enqueued, want 1", len(tasks), taskType)
+		}
+	}
+	if server.Exists(gameSnapshotKey("round")) {
+		t.Error("snapshot of the force-ended game was kept")
+	}
+	if _, exist := gameManager.GetGame("round"); exist {
+		t.Error("force-ended game is still held in memory")
+	}
+}
@@ -0,0 +1,14 @@
+package gameManager
+
+// QueueWorkerCount is how many queue workers InitiateInstance starts.
+const QueueWorkerCount = 2
+
+// GlobalPubSubAlive reports whether the mari-arena-global subscription is
+// still receiving messages.
+func (gameManager *GameManager) GlobalPubSubAlive() bool {
+	return gameManager.globalPubSub.Load()
+}
+
+func (gameManager *GameManager) RunningQueueWorkers() int {
+	return int(gameManager.runningWorkers.Load())
+}
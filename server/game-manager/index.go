@@ -2,19 +2,21 @@ package gameManager
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"flappy-bird-server/config"
 	"flappy-bird-server/lib"
 	"flappy-bird-server/model"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/redis/go-redis/v9"
 	"github.com/robfig/cron"
 	// "github.com/robfig/cron/v3"
@@ -25,22 +27,39 @@ type NewGame struct {
 	GameType model.GameType
 }
 
-type GameTypeMap struct {
-	LastUpdated int
-	GameType    model.GameType
-}
-
-var gameTypeMap = map[string]GameTypeMap{}
-
 type GameManager struct {
+	// Users and UserConnectionMap are written by websocket goroutines and
+	// read by pub/sub handlers, queue workers and tickers. Go through the
+	// helpers in user.go, they hold usersMu.
 	UserConnectionMap map[*websocket.Conn]string
 	Users             map[string]User
-	Subscriptions     map[string]bool
+	usersMu           sync.RWMutex
+	Subscriptions     sync.Map
 	StartedGames      map[string]Game
 	DbQueue           Queue
 	GameQueue         Queue
 	RedisClient       *redis.Client
 	Context           context.Context
+	Config            config.Config
+
+	maintenanceMu       sync.RWMutex
+	maintenance         *Maintenance
+	maintenanceNotified string
+
+	gamesMu      sync.RWMutex
+	draining     atomic.Bool
+	queueCancel  context.CancelFunc
+	queueWorkers sync.WaitGroup
+
+	runningWorkers atomic.Int32
+	globalPubSub   atomic.Bool
+
+	scoreboardsMu    sync.Mutex
+	dirtyScoreboards map[string]bool
+
+	spectatorsMu sync.Mutex
+	spectated    map[string]*spectatedGame
+	spectating   map[*websocket.Conn]string
 }
 
 type RedisGame struct {
@@ -51,13 +70,9 @@ type RedisGame struct {
 var instance *GameManager
 var once sync.Once
 
-func InitiateInstance(ctx context.Context, wg sync.WaitGroup) {
+func InitiateInstance(ctx context.Context, wg *sync.WaitGroup, cfg config.Config) {
 	once.Do(func() {
-		client := redis.NewClient(&redis.Options{
-			Addr:     os.Getenv("REDIS_ADDRESS"),
-			Password: os.Getenv("REDIS_PASSWORD"),
-			DB:       0,
-		})
+		client := NewRedisClient(cfg)
 
 		// opt, err := redis.ParseURL(os.Getenv("REDIS_URL"))
 		// if err != nil {
@@ -66,17 +81,12 @@ func InitiateInstance(ctx context.Context, wg sync.WaitGroup) {
 		// }
 
 		// client := redis.NewClient(opt)
-		dbQueue := Queue{
-			client:        client,
-			queueName:     "mari-arena-db-queue",
-			processingKey: "mari-arena-db-queue:processing",
-			timeout:       10 * time.Second,
-		}
+		dbQueue := NewDbQueue(client, cfg.QueueTimeout)
 		gameQueue := Queue{
 			client:        client,
 			queueName:     "mari-arena-queue",
 			processingKey: "mari-arena-queue:processing",
-			timeout:       10 * time.Second,
+			timeout:       cfg.QueueTimeout,
 		}
 		instance = &GameManager{
 			UserConnectionMap: make(map[*websocket.Conn]string),
@@ -85,71 +95,178 @@ func InitiateInstance(ctx context.Context, wg sync.WaitGroup) {
 			DbQueue:           dbQueue,
 			GameQueue:         gameQueue,
 			RedisClient:       client,
-			Subscriptions:     map[string]bool{},
 			Context:           ctx,
+			Config:            cfg,
 		}
 
+		prometheus.MustRegister(collector{gameManager: instance})
+
 		for i := 0; i < 3; i++ {
-			log.Println("Checking redis connection")
+			slog.Info("checking redis connection")
 			r := client.Ping(ctx)
 			if r.Err() == nil {
-				log.Println("Redis connected successfully")
+				slog.Info("redis connected")
 				break
 			}
 			if r.Err() != nil && i > 1 {
-				log.Fatal("Error connecting redis: ", r.Err().Error())
-				time.Sleep(1 * time.Second)
+				slog.Error("error connecting redis", "error", r.Err())
+				os.Exit(1)
 			}
 		}
 
-		c := cron.New()
+		c := cron.NewWithLocation(time.UTC)
 		c.AddFunc("@hourly", func() {
-			log.Println("Retrying failed tasks")
-			dbQueue.RetryFailedTasks(ctx)
-			gameQueue.RetryFailedTasks(ctx)
+			slog.Info("retrying failed tasks")
+			if err := dbQueue.RetryFailedTasks(ctx); err != nil {
+				slog.Error("error retrying failed tasks", "queue", dbQueue.queueName, "error", err)
+			}
+			if err := gameQueue.RetryFailedTasks(ctx); err != nil {
+				slog.Error("error retrying failed tasks", "queue", gameQueue.queueName, "error", err)
+			}
+			if err := ResetStuckOperations(ctx, &dbQueue); err != nil {
+				slog.Error("error resetting stuck failed operations", "error", err)
+			}
 		})
+		c.AddFunc("@daily", func() {
+			if err := instance.ResetLeaderboards(ctx, "daily"); err != nil {
+				slog.Error("error resetting daily leaderboards", "error", err)
+			}
+		})
+		// Weeks start on Monday, see periodStart.
+		c.AddFunc("0 0 0 * * 1", func() {
+			if err := instance.ResetLeaderboards(ctx, "weekly"); err != nil {
+				slog.Error("error resetting weekly leaderboards", "error", err)
+			}
+		})
+		c.Start()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-ctx.Done()
+			c.Stop()
+		}()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			instance.WatchMaintenance(ctx)
+		}()
 
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			dbQueue.ProcessQueue(ctx)
+			instance.WatchLobbies(ctx)
 		}()
 
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			gameQueue.ProcessQueue(ctx)
+			instance.BroadcastScoreboards(ctx)
 		}()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			instance.WatchTournaments(ctx)
+		}()
+
+		// Queue workers outlive the main context so Shutdown can stop them
+		// only after refunds for unfinished games have been enqueued.
+		queueCtx, queueCancel := context.WithCancel(context.Background())
+		instance.queueCancel = queueCancel
+		instance.startQueueWorker(wg, queueCtx, &instance.DbQueue)
+		instance.startQueueWorker(wg, queueCtx, &instance.GameQueue)
 	})
 }
 
+func NewRedisClient(cfg config.Config) *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr:     cfg.RedisAddress,
+		Password: cfg.RedisPassword,
+		DB:       0,
+	})
+}
+
+// NewDbQueue returns the queue that persists games and balances. Tools that
+// only enqueue, like the failed-ops command, can use it without starting an
+// instance.
+func NewDbQueue(client *redis.Client, timeout time.Duration) Queue {
+	return Queue{
+		client:        client,
+		queueName:     "mari-arena-db-queue",
+		processingKey: "mari-arena-db-queue:processing",
+		timeout:       timeout,
+	}
+}
+
 func GetInstance() *GameManager {
 	return instance
 }
 
+func (gameManager *GameManager) startQueueWorker(wg *sync.WaitGroup, ctx context.Context, queue *Queue) {
+	wg.Add(1)
+	gameManager.queueWorkers.Add(1)
+	go func() {
+		defer wg.Done()
+		defer gameManager.queueWorkers.Done()
+		gameManager.runningWorkers.Add(1)
+		defer gameManager.runningWorkers.Add(-1)
+		queue.ProcessQueue(ctx)
+	}()
+}
+
 func (gameManager *GameManager) GetGame(gameId string) (*Game, bool) {
+	gameManager.gamesMu.RLock()
+	defer gameManager.gamesMu.RUnlock()
 	targetGame, exist := gameManager.StartedGames[gameId]
 	return &targetGame, exist
 }
 
-func (gameManager *GameManager) GetUser(userId string) (*User, bool) {
-	targetUser, exist := gameManager.Users[userId]
-	return &targetUser, exist
+func (gameManager *GameManager) SetGame(game Game) {
+	gameManager.gamesMu.Lock()
+	defer gameManager.gamesMu.Unlock()
+	gameManager.StartedGames[game.Id] = game
+}
+
+func (gameManager *GameManager) ListGames() []Game {
+	gameManager.gamesMu.RLock()
+	defer gameManager.gamesMu.RUnlock()
+	games := make([]Game, 0, len(gameManager.StartedGames))
+	for _, game := range gameManager.StartedGames {
+		games = append(games, game)
+	}
+	return games
 }
 
+// AddUser binds a socket to the user its access token was issued to and
+// sends them a resume token. A socket the user signed in on before stops
+// acting for them.
 func (gameManager *GameManager) AddUser(userId string, publicKey string, ws *websocket.Conn) {
-	gameManager.UserConnectionMap[ws] = userId
-	gameManager.Users[userId] = User{
+	newUser := User{
 		Id:        userId,
 		Ws:        ws,
 		PublicKey: publicKey,
 	}
+	if previous, exist := gameManager.GetUser(userId); exist && previous.Ws != ws {
+		gameManager.UnbindConnection(previous.Ws)
+	}
+	gameManager.BindConnection(ws, userId)
+	gameManager.SetUser(newUser)
+	if err := gameManager.IssueSession(gameManager.Context, newUser); err != nil {
+		slog.Warn("error issuing session", "userId", userId, "error", err)
+	}
+
+	maintenance := gameManager.GetMaintenance()
+	status := maintenance.Status(time.Now())
+	if status == "active" || status == "upcoming" {
+		newUser.SendMessage("maintenance", maintenance.Payload(time.Now()))
+	}
 }
 
-func (gameManager *GameManager) CreateGame(maxUserCount int, winnerPrice int, entry int, gameTypeId string) (*Game, error) {
+func (gameManager *GameManager) CreateGame(ctx context.Context, maxUserCount int, winnerPrice int, entry int, gameTypeId string) (*Game, error) {
 	newGameId, err := uuid.NewUUID()
 	if err != nil {
-		log.Println(err.Error())
+		slog.ErrorContext(ctx, "error creating game id", "error", err)
 		return &Game{}, errors.New("something went wrong while creating game id")
 	}
 	newGame := Game{
@@ -160,6 +277,8 @@ func (gameManager *GameManager) CreateGame(maxUserCount int, winnerPrice int, en
 		MaxUserCount:     maxUserCount,
 		CurrentUserCount: 0,
 		ScoreBoard:       make(map[string]Score),
+		Ratings:          make(map[string]float64),
+		CreatedAt:        time.Now(),
 		WinnerPrice:      winnerPrice,
 		Entry:            entry,
 	}
@@ -175,10 +294,9 @@ func (gameManager *GameManager) CreateGame(maxUserCount int, winnerPrice int, en
 		},
 	}
 
-	err = gameManager.DbQueue.Enqueue(gameManager.Context, item)
+	err = gameManager.DbQueue.Enqueue(lib.WithLogAttrs(ctx, "gameId", newGame.Id), item)
 
 	if err != nil {
-		log.Println(err.Error())
 		return &Game{}, errors.New("something went wrong while creating game")
 	}
 
@@ -198,7 +316,7 @@ func (gameManager *GameManager) GetBalance(userId string) (int, error) {
 }
 
 func (gameManager *GameManager) SetBalance(userId string, amount int) error {
-	red := gameManager.RedisClient.Set(gameManager.Context, fmt.Sprintf("mr-balance-%s", userId), amount, 24*time.Hour)
+	red := gameManager.RedisClient.Set(gameManager.Context, fmt.Sprintf("mr-balance-%s", userId), amount, gameManager.Config.BalanceTTL)
 	return red.Err()
 }
 
@@ -217,41 +335,72 @@ func (gameManager *GameManager) GetStagingGameFromRedis(gameKey string) (Game, e
 	return Game{}, err
 }
 
-func (gameManager *GameManager) JoinGame(userId string, gameTypeId string) {
+func (gameManager *GameManager) JoinGame(ctx context.Context, userId string, gameTypeId string) {
+	ctx = lib.WithLogAttrs(ctx, "userId", userId, "gameTypeId", gameTypeId)
 	// targetUser, exist := gameManager.GetUser(userId)
 	// if !exist {
 	// 	return
 	// }
-	gameKey := fmt.Sprintf("newGame:%s", gameTypeId)
-	newGame, err := gameManager.GetStagingGameFromRedis(gameKey)
+	if gameManager.IsDraining() {
+		gameManager.RedisClient.Publish(gameManager.Context, "mari-arena-global", lib.Stringify(map[string]interface{}{
+			"type": "user-error",
+			"data": map[string]string{
+				"userId":  userId,
+				"message": "Server is restarting, please try again in a moment",
+			},
+		}))
+		return
+	}
+
+	if gameManager.IsUnderMaintenance() {
+		gameManager.RedisClient.Publish(gameManager.Context, "mari-arena-global", lib.Stringify(map[string]interface{}{
+			"type": "user-error",
+			"data": map[string]string{
+				"userId":  userId,
+				"message": gameManager.GetMaintenance().Message,
+			},
+		}))
+		return
+	}
 
+	gameType, err := gameManager.GetGameType(gameTypeId)
+	if err != nil || !gameType.Active {
+		gameManager.RedisClient.Publish(gameManager.Context, "mari-arena-global", lib.Stringify(map[string]interface{}{
+			"type": "user-error",
+			"data": map[string]string{
+				"userId":  userId,
+				"message": "Invalid game type",
+			},
+		}))
+		return
+	}
+
+	if lobbyTypeId, lobbyId, waiting := gameManager.UserLobby(ctx, userId); waiting && lobbyTypeId != gameTypeId && gameManager.lobbyExists(ctx, lobbyTypeId, lobbyId) {
+		slog.InfoContext(ctx, "user already waiting in another lobby", "lobbyId", lobbyId)
+		gameManager.RedisClient.Publish(gameManager.Context, "mari-arena-global", lib.Stringify(map[string]interface{}{
+			"type": "user-error",
+			"data": map[string]string{
+				"userId":  userId,
+				"message": "Leave your current lobby before joining another one",
+			},
+		}))
+		return
+	}
+
+	// Players only land in a lobby within their rating band, otherwise they
+	// open a new one for others to find.
+	var newGame Game
+	found := false
+	rating, err := gameManager.GetRating(ctx, userId, gameTypeId)
+	if err == nil {
+		newGame, found, err = gameManager.FindLobby(ctx, gameTypeId, userId, rating)
+	}
 	if err != nil {
-		cacheGameTypeMap, cacheGameTypeMapExist := gameTypeMap[gameTypeId]
-
-		if !cacheGameTypeMapExist || cacheGameTypeMap.LastUpdated+36000 < int(time.Now().Unix()) {
-			var gameType model.GameType
-			err := lib.Pool.QueryRow(gameManager.Context, `SELECT id, title, currency, "maxPlayer", winner, entry FROM public.gametypes WHERE id = $1`, gameTypeId).Scan(&gameType.Id, &gameType.Title, &gameType.Currency, &gameType.MaxPlayer, &gameType.Winner, &gameType.Entry)
-			if err != nil {
-				gameManager.RedisClient.Publish(gameManager.Context, "mari-arena-global", lib.Stringify(map[string]interface{}{
-					"type": "user-error",
-					"data": map[string]string{
-						"userId":  userId,
-						"message": "Invalid game type",
-					},
-				}))
-				// targetUser.SendMessage("error", map[string]interface{}{
-				// 	"message": "Invalid game type",
-				// })
-				return
-			}
-			gameTypeMap[gameTypeId] = GameTypeMap{
-				LastUpdated: int(time.Now().Unix()),
-				GameType:    gameType,
-			}
-			cacheGameTypeMap = gameTypeMap[gameTypeId]
-		}
+		slog.WarnContext(ctx, "error finding lobby", "error", err)
+	}
 
-		_newGame, err := gameManager.CreateGame(cacheGameTypeMap.GameType.MaxPlayer, cacheGameTypeMap.GameType.Winner, cacheGameTypeMap.GameType.Entry, cacheGameTypeMap.GameType.Id)
+	if !found {
+		_newGame, err := gameManager.CreateGame(ctx, gameType.MaxPlayer, gameType.Winner, gameType.Entry, gameType.Id)
 		if err != nil {
 			gameManager.RedisClient.Publish(gameManager.Context, "mari-arena-global", lib.Stringify(map[string]interface{}{
 				"type": "user-error",
@@ -266,13 +415,7 @@ func (gameManager *GameManager) JoinGame(userId string, gameTypeId string) {
 			return
 		}
 		newGame = *_newGame
-		payload, err := json.Marshal(newGame)
-		if err == nil {
-			cmd := gameManager.RedisClient.Set(gameManager.Context, gameKey, string(payload), 365*24*time.Hour)
-			err = cmd.Err()
-		}
-
-		if err != nil {
+		if err := gameManager.SaveLobby(gameManager.Context, newGame); err != nil {
 			gameManager.RedisClient.Publish(gameManager.Context, "mari-arena-global", lib.Stringify(map[string]interface{}{
 				"type": "user-error",
 				"data": map[string]string{
@@ -287,10 +430,18 @@ func (gameManager *GameManager) JoinGame(userId string, gameTypeId string) {
 		}
 	}
 
-	log.Printf("Join game %s by user %s", newGame.Id, userId)
+	gameManager.joinLobby(ctx, userId, newGame, rating)
+}
+
+// joinLobby seats a player in a public or private lobby once they can pay
+// its entry, and starts a public lobby when it fills up. It reports whether
+// the player got a seat.
+func (gameManager *GameManager) joinLobby(ctx context.Context, userId string, newGame Game, rating float64) bool {
+	ctx = lib.WithLogAttrs(ctx, "gameId", newGame.Id)
+	slog.InfoContext(ctx, "user joining game")
 	if newGame.CurrentUserCount == newGame.MaxUserCount {
-		log.Println("Game is full")
-		return
+		slog.WarnContext(ctx, "game is full")
+		return false
 	}
 
 	currentBalance, err := gameManager.GetBalance(userId)
@@ -307,7 +458,7 @@ func (gameManager *GameManager) JoinGame(userId string, gameTypeId string) {
 		// targetUser.SendMessage("error", map[string]interface{}{
 		// 	"message": "Something went wrong while fetching current balance",
 		// })
-		return
+		return false
 
 	}
 
@@ -322,11 +473,11 @@ func (gameManager *GameManager) JoinGame(userId string, gameTypeId string) {
 		// targetUser.SendMessage("error", map[string]interface{}{
 		// 	"message": "Insufficient balance",
 		// })
-		return
+		return false
 	}
 
 	if !newGame.Users[userId] {
-		err := gameManager.DbQueue.Enqueue(gameManager.Context, map[string]interface{}{
+		err := gameManager.DbQueue.Enqueue(ctx, map[string]interface{}{
 			"type": "add-participant",
 			"data": map[string]interface{}{
 				"userId": userId,
@@ -345,7 +496,7 @@ func (gameManager *GameManager) JoinGame(userId string, gameTypeId string) {
 			// targetUser.SendMessage("error", map[string]interface{}{
 			// 	"message": "Something went wrong while adding participant in db",
 			// })
-			return
+			return false
 		}
 	}
 
@@ -368,6 +519,10 @@ func (gameManager *GameManager) JoinGame(userId string, gameTypeId string) {
 		IsAlive: true,
 		Points:  0,
 	}
+	if newGame.Ratings == nil {
+		newGame.Ratings = make(map[string]float64)
+	}
+	newGame.Ratings[userId] = rating
 
 	gameManager.RedisClient.Publish(gameManager.Context, "mari-arena-global", lib.Stringify(map[string]interface{}{
 		"type": "user-join-game",
@@ -393,68 +548,13 @@ func (gameManager *GameManager) JoinGame(userId string, gameTypeId string) {
 	// 	go gameManager.SubscribeGame(gameManager.Context, newGame.Id)
 	// }
 
-	if newGame.CurrentUserCount == newGame.MaxUserCount {
-		cmd := gameManager.RedisClient.Ping(gameManager.Context)
-		if cmd.Err() == nil {
-			keys = append(keys, userId)
-			ids := ""
-			for _, id := range keys {
-				balance, err := gameManager.GetBalance(id)
-				if err != nil {
-					gameManager.SetBalance(id, balance-newGame.Entry)
-				}
-				if ids == "" {
-					ids += fmt.Sprintf(`'%s'`, id)
-				} else {
-					ids += fmt.Sprintf(`, '%s'`, id)
-				}
-			}
-
-			err = gameManager.DbQueue.Enqueue(gameManager.Context, map[string]interface{}{
-				"type": "start-game",
-				"data": map[string]interface{}{
-					"gameId": newGame.Id,
-				},
-			})
-			if err == nil {
-				err = gameManager.DbQueue.Enqueue(gameManager.Context, map[string]interface{}{
-					"type": "collect-entry",
-					"data": map[string]interface{}{
-						"ids":   ids,
-						"entry": newGame.Entry,
-					},
-				})
-
-				if err == nil {
-					redisCmd := gameManager.RedisClient.Del(gameManager.Context, gameKey)
-					err = redisCmd.Err()
-					if err == nil {
-						jsonString, err := json.Marshal(map[string]interface{}{
-							"type": "start-game",
-							"data": newGame,
-						})
-						if err == nil {
-							redisCmd = gameManager.RedisClient.Publish(gameManager.Context, newGame.Id, string(jsonString))
-							err = redisCmd.Err()
-							log.Println(err)
-						}
-					}
-				}
-			}
-		}
-		if err != nil {
-			errorPayload, err := json.Marshal(map[string]interface{}{
-				"type": "error-starting-game",
-				"data": newGame,
-			})
-			if err != nil {
-				gameManager.RedisClient.Publish(gameManager.Context, newGame.Id, string(errorPayload))
-			}
-
+	if newGame.CurrentUserCount == newGame.MaxUserCount && !newGame.Private {
+		if err := gameManager.startLobby(ctx, newGame); err != nil {
+			slog.ErrorContext(ctx, "error starting game", "error", err)
+			gameManager.publishStartError(gameManager.Context, newGame)
 		}
 	} else {
-		payload, err := json.Marshal(newGame)
-		if err != nil {
+		if err := gameManager.SaveLobby(gameManager.Context, newGame); err != nil {
 			gameManager.RedisClient.Publish(gameManager.Context, "mari-arena-global", lib.Stringify(map[string]interface{}{
 				"type": "user-error",
 				"data": map[string]string{
@@ -465,70 +565,44 @@ func (gameManager *GameManager) JoinGame(userId string, gameTypeId string) {
 			// targetUser.SendMessage("error", map[string]interface{}{
 			// 	"message": "Error while setting new game",
 			// })
-			return
+			return false
 		}
-		cmd := gameManager.RedisClient.Set(gameManager.Context, gameKey, string(payload), 365*24*time.Hour)
-
-		if cmd.Err() != nil {
-			gameManager.RedisClient.Publish(gameManager.Context, "mari-arena-global", lib.Stringify(map[string]interface{}{
-				"type": "user-error",
-				"data": map[string]string{
-					"userId":  userId,
-					"message": "Error while setting new game",
-				},
-			}))
-			// targetUser.SendMessage("error", map[string]interface{}{
-			// 	"message": "Error while setting new game",
-			// })
-			return
+		if err := gameManager.setUserLobby(gameManager.Context, userId, newGame.GameTypeId, newGame.Id); err != nil {
+			slog.WarnContext(ctx, "error recording user lobby", "error", err)
 		}
+		gameManager.publishLobbyStatus(gameManager.Context, newGame)
 	}
+	return true
 }
 
 func (gameManager *GameManager) DeleteUser(targetUserId string) {
 	targetUser, userExist := gameManager.GetUser(targetUserId)
 	if userExist {
-		log.Println("Deleting user: ", targetUserId)
-		delete(gameManager.Users, targetUserId)
+		slog.Info("deleting user", "userId", targetUserId, "gameId", targetUser.CurrentGameId)
+		gameManager.RemoveUser(targetUserId)
 		if targetUser.CurrentGameId != "" {
 			targetGame, gameExist := gameManager.GetGame(targetUser.CurrentGameId)
-			if gameExist {
-				if targetGame.Status == "ongoing" && targetGame.ScoreBoard[targetUserId].IsAlive {
-					gameManager.GameOver(targetGame.Id, targetUserId)
-				} else if targetGame.Status == "staging" {
-					gameKey := fmt.Sprintf("newGame:%s", targetGame.GameTypeId)
-					inGameUsers := targetGame.Users
-					inGameScoreboard := targetGame.ScoreBoard
-
-					delete(inGameUsers, targetUserId)
-					delete(inGameScoreboard, targetUserId)
-
-					updatedGame := Game{
-						Id:               targetGame.Id,
-						GameTypeId:       targetGame.GameTypeId,
-						MaxUserCount:     targetGame.MaxUserCount,
-						CurrentUserCount: targetGame.CurrentUserCount - 1,
-						WinnerPrice:      targetGame.WinnerPrice,
-						Entry:            targetGame.Entry,
-						Users:            inGameUsers,
-						Status:           "staging",
-						ScoreBoard:       inGameScoreboard,
-					}
-
-					gameManager.StartedGames[targetGame.Id] = updatedGame
-					payload, err := json.Marshal(updatedGame)
-					if err == nil {
-						gameManager.RedisClient.Set(gameManager.Context, gameKey, string(payload), 365*24*time.Hour)
-					} else {
-						gameManager.RedisClient.Del(gameManager.Context, gameKey)
-					}
-				}
+			if gameExist && targetGame.Status == "ongoing" && targetGame.ScoreBoard[targetUserId].IsAlive {
+				gameManager.GameOver(targetGame.Id, targetUserId)
 			}
 		}
 	}
+
+	// Lobbies are only in Redis, so a disconnect leaves them through the
+	// same path as an explicit leave-lobby.
+	if _, _, waiting := gameManager.UserLobby(gameManager.Context, targetUserId); waiting {
+		gameManager.GameQueue.Enqueue(lib.WithLogAttrs(gameManager.Context, "userId", targetUserId), map[string]interface{}{
+			"type": "leave-lobby",
+			"data": map[string]interface{}{
+				"userId": targetUserId,
+			},
+		})
+	}
 }
 
 func (gameManager *GameManager) DeleteGame(gameId string) {
+	gameManager.gamesMu.Lock()
+	defer gameManager.gamesMu.Unlock()
 	delete(gameManager.StartedGames, gameId)
 }
 
@@ -536,9 +610,14 @@ func (gameManager *GameManager) UpdateBoard(gameId string, userId string) {
 	// if _, exist := gameManager.GetUser(userId); !exist {
 	// 	return
 	// }
-	targetGame, gameExist := gameManager.GetGame(gameId)
+	gameManager.gamesMu.Lock()
+	targetGame, gameExist := gameManager.StartedGames[gameId]
 	if gameExist {
 		targetGame.UpdateScore(userId)
+	}
+	gameManager.gamesMu.Unlock()
+	if gameExist {
+		gameManager.markScoreboard(gameId)
 		// oldBoard, exist := targetGame.ScoreBoard[userId]
 		// if exist {
 		// 	targetGame.ScoreBoard[userId] = Score{
@@ -552,7 +631,14 @@ func (gameManager *GameManager) UpdateBoard(gameId string, userId string) {
 func (gameManager *GameManager) GameOver(gameId string, userId string) {
 	targetGame, gameExist := gameManager.GetGame(gameId)
 	if gameExist {
+		gameManager.gamesMu.Lock()
+		eliminated := targetGame.ScoreBoard[userId].IsAlive
 		targetGame.GameOver(userId)
+		gameManager.gamesMu.Unlock()
+		gameManager.recordElimination(gameManager.Context, gameId, userId)
+		if eliminated {
+			gameManager.sendElimination(targetGame, userId)
+		}
 
 		var alivePlayers = 0
 		var winnerId = ""
@@ -572,59 +658,71 @@ func (gameManager *GameManager) GameOver(gameId string, userId string) {
 		}
 
 		if alivePlayers == 0 {
-			for k := range targetGame.Users {
-				participant, exist := gameManager.GetUser(k)
-				if exist {
-					gameManager.Users[k] = User{
-						Id:            participant.Id,
-						CurrentGameId: "",
-						PublicKey:     participant.PublicKey,
-						Ws:            participant.Ws,
-					}
-					if k == winnerId {
-						err := gameManager.DbQueue.Enqueue(gameManager.Context, map[string]interface{}{
-							"type": "end-game",
-							"data": map[string]string{
-								"gameId":   gameId,
-								"winnerId": winnerId,
-							},
-						})
-
-						if err != nil {
-							newLine := fmt.Sprintf("ERROR_UPDATING_GAME-gameId_%s-status_%s-userId_%s-amount-%d\n", gameId, "completed", userId, targetGame.WinnerPrice)
-							lib.ErrorLogger(newLine, "errors.txt")
-							return
-						}
-						if winnerId != "" {
-							err = gameManager.DbQueue.Enqueue(gameManager.Context, map[string]interface{}{
-								"type": "update-balance",
-								"data": map[string]interface{}{
-									"winnerId": winnerId,
-									"amount":   targetGame.WinnerPrice,
-								},
-							})
-							if err != nil {
-								log.Println(err.Error())
-								newLine := fmt.Sprintf("ERROR_UPDATING_USER_BALANCE-userId_%s-amount_%d\n", winnerId, targetGame.WinnerPrice)
-								lib.ErrorLogger(newLine, "errors.txt")
-								return
-							}
-						}
-						balance, err := gameManager.GetBalance(winnerId)
-						if err != nil {
-							gameManager.SetBalance(winnerId, balance+targetGame.WinnerPrice)
-						}
-						participant.SendMessage("winner", map[string]interface{}{
-							"amount": targetGame.WinnerPrice - targetGame.Entry,
-						})
-					} else {
-						participant.SendMessage("loser", map[string]interface{}{
-							"amount": targetGame.Entry,
-						})
-					}
-				}
+			if targetGame.TournamentId != "" {
+				winnerId = tournamentResults(*targetGame)[0]
 			}
-			gameManager.DeleteGame(gameId)
+			gameManager.finishGame(targetGame, winnerId, "finished")
+		}
+	}
+}
+
+// finishGame wraps up a game that ended, on every instance holding a copy
+// of it. The once-per-game tasks run on whichever instance claims them, the
+// local players get their result. reason goes into the replay.
+func (gameManager *GameManager) finishGame(targetGame *Game, winnerId string, reason string) {
+	gameId := targetGame.Id
+	ctx := lib.WithLogAttrs(gameManager.Context, "gameId", gameId, "winnerId", winnerId)
+	if targetGame.TournamentId != "" {
+		gameManager.finishTournamentGame(ctx, *targetGame, winnerId)
+	}
+	gameManager.finishSpectatedGame(ctx, gameId, winnerId)
+	gameManager.closeReplay(ctx, gameId, reason, winnerId)
+	// Every game counts, also one nobody scored in or whose winner
+	// isn't connected here.
+	if gameManager.claimGameTask(ctx, gameId, "ratings") {
+		gameManager.enqueueRatingUpdate(ctx, targetGame)
+	}
+	if gameManager.claimGameTask(ctx, gameId, "scores") {
+		gameManager.enqueueScores(ctx, targetGame)
+	}
+	if gameManager.claimGameTask(ctx, gameId, "leaderboards") {
+		gameManager.recordLeaderboards(ctx, targetGame, winnerId)
+	}
+	// The winner is settled from the scoreboard, they may be
+	// connected to another instance or not at all.
+	if winnerId != "" && gameManager.claimGameTask(ctx, gameId, "settle") {
+		settlement := map[string]interface{}{
+			"gameId":   gameId,
+			"winnerId": winnerId,
+			"amount":   targetGame.WinnerPrice,
+		}
+		err := gameManager.DbQueue.Enqueue(ctx, map[string]interface{}{
+			"type": "settle-game",
+			"data": settlement,
+		})
+		if err != nil {
+			RecordFailedOperation(ctx, "settle-game", settlement, "game-over", err)
+		}
+		balance, err := gameManager.GetBalance(winnerId)
+		if err != nil {
+			gameManager.SetBalance(winnerId, balance+targetGame.WinnerPrice)
+		}
+	}
+	for k := range targetGame.Users {
+		participant, exist := gameManager.GetUser(k)
+		if !exist {
+			continue
+		}
+		gameManager.SetCurrentGame(k, "")
+		if k == winnerId {
+			participant.SendMessage("winner", map[string]interface{}{
+				"amount": targetGame.WinnerPrice - targetGame.Entry,
+			})
+		} else {
+			participant.SendMessage("loser", map[string]interface{}{
+				"amount": targetGame.Entry,
+			})
 		}
 	}
+	gameManager.DeleteGame(gameId)
 }
@@ -0,0 +1,239 @@
+package gameManager
+
+import (
+	"context"
+	"errors"
+	"flappy-bird-server/lib"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Leaderboards are Redis sorted sets per scope, period and metric. The scope
+// is a game type id or GlobalScope. Daily and weekly boards are emptied by
+// the cron scheduler, all of them can be rebuilt from Postgres.
+const GlobalScope = "all"
+
+var LeaderboardPeriods = []string{"daily", "weekly", "alltime"}
+var LeaderboardMetrics = []string{"wins", "winnings", "score"}
+
+var ErrUnknownLeaderboard = errors.New("unknown leaderboard")
+
+type LeaderboardEntry struct {
+	Rank   int64   `json:"rank"`
+	UserId string  `json:"userId"`
+	Score  float64 `json:"score"`
+}
+
+func leaderboardKey(scope string, period string, metric string) string {
+	return fmt.Sprintf("mr-leaderboard:%s:%s:%s", scope, period, metric)
+}
+
+// ValidLeaderboard reports whether a board exists. Winnings are in the game
+// type's currency, so there is no global winnings board.
+func ValidLeaderboard(scope string, period string, metric string) bool {
+	if scope == GlobalScope && metric == "winnings" {
+		return false
+	}
+	return contains(LeaderboardPeriods, period) && contains(LeaderboardMetrics, metric)
+}
+
+// periodStart is when the current board of a period began, in UTC like
+// the cron resets.
+func periodStart(period string, now time.Time) time.Time {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	switch period {
+	case "daily":
+		return day
+	case "weekly":
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	default:
+		return time.Time{}
+	}
+}
+
+type leaderboardRow struct {
+	scope  string
+	userId string
+	wins   float64
+	net    float64
+	best   float64
+}
+
+func (row leaderboardRow) write(ctx context.Context, pipe redis.Pipeliner, period string, incr bool) {
+	metrics := map[string]float64{"wins": row.wins, "winnings": row.net}
+	for metric, value := range metrics {
+		if !ValidLeaderboard(row.scope, period, metric) {
+			continue
+		}
+		if incr {
+			pipe.ZIncrBy(ctx, leaderboardKey(row.scope, period, metric), value, row.userId)
+		} else {
+			pipe.ZAdd(ctx, leaderboardKey(row.scope, period, metric), redis.Z{Score: value, Member: row.userId})
+		}
+	}
+	pipe.ZAddGT(ctx, leaderboardKey(row.scope, period, "score"), redis.Z{Score: row.best, Member: row.userId})
+}
+
+// recordLeaderboards adds a finished public game to every board it counts
+// for. GameOver claims it so it runs once per game across instances.
+// Tournament games are played for the tournament's prizes and don't count.
+// Neither does a game nobody scored in, it is never settled and so never
+// completed, and rebuilding the boards wouldn't find it either.
+func (gameManager *GameManager) recordLeaderboards(ctx context.Context, game *Game, winnerId string) {
+	if game.Private || game.TournamentId != "" || winnerId == "" {
+		return
+	}
+	pipe := gameManager.RedisClient.TxPipeline()
+	for userId := range game.Users {
+		net, wins := float64(-game.Entry), 0.0
+		if userId == winnerId {
+			net, wins = float64(game.WinnerPrice-game.Entry), 1
+		}
+		best := float64(game.ScoreBoard[userId].Points)
+		for _, period := range LeaderboardPeriods {
+			for _, scope := range []string{game.GameTypeId, GlobalScope} {
+				leaderboardRow{scope: scope, userId: userId, wins: wins, net: net, best: best}.write(ctx, pipe, period, true)
+			}
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		slog.WarnContext(ctx, "error updating leaderboards", "error", err)
+	}
+}
+
+// GetLeaderboard returns one page of a board, best first, and its size.
+func (gameManager *GameManager) GetLeaderboard(ctx context.Context, scope string, period string, metric string, page int, limit int) ([]LeaderboardEntry, int64, error) {
+	if !ValidLeaderboard(scope, period, metric) {
+		return nil, 0, ErrUnknownLeaderboard
+	}
+	key := leaderboardKey(scope, period, metric)
+	total, err := gameManager.RedisClient.ZCard(ctx, key).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	start := int64((page - 1) * limit)
+	members, err := gameManager.RedisClient.ZRevRangeWithScores(ctx, key, start, start+int64(limit)-1).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	entries := make([]LeaderboardEntry, 0, len(members))
+	for i, member := range members {
+		entries = append(entries, LeaderboardEntry{
+			Rank:   start + int64(i) + 1,
+			UserId: member.Member.(string),
+			Score:  member.Score,
+		})
+	}
+	return entries, total, nil
+}
+
+// LeaderboardRank looks up a single player on a board.
+func (gameManager *GameManager) LeaderboardRank(ctx context.Context, scope string, period string, metric string, userId string) (LeaderboardEntry, bool, error) {
+	if !ValidLeaderboard(scope, period, metric) {
+		return LeaderboardEntry{}, false, ErrUnknownLeaderboard
+	}
+	key := leaderboardKey(scope, period, metric)
+	rank, err := gameManager.RedisClient.ZRevRank(ctx, key, userId).Result()
+	if errors.Is(err, redis.Nil) {
+		return LeaderboardEntry{}, false, nil
+	}
+	if err != nil {
+		return LeaderboardEntry{}, false, err
+	}
+	score, err := gameManager.RedisClient.ZScore(ctx, key, userId).Result()
+	if err != nil {
+		return LeaderboardEntry{}, false, err
+	}
+	return LeaderboardEntry{Rank: rank + 1, UserId: userId, Score: score}, true, nil
+}
+
+func (gameManager *GameManager) leaderboardKeys(ctx context.Context, period string) ([]string, error) {
+	keys := []string{}
+	iter := gameManager.RedisClient.Scan(ctx, 0, leaderboardKey("*", period, "*"), 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
+
+// ResetLeaderboards empties the boards of a period when it rolls over.
+// Every instance runs the cron, the lock lets one of them do the reset.
+func (gameManager *GameManager) ResetLeaderboards(ctx context.Context, period string) error {
+	lock := fmt.Sprintf("mr-leaderboard-reset:%s:%s", period, periodStart(period, time.Now()).Format(time.DateOnly))
+	acquired, err := gameManager.RedisClient.SetNX(ctx, lock, 1, time.Hour).Result()
+	if err != nil || !acquired {
+		return err
+	}
+	keys, err := gameManager.leaderboardKeys(ctx, period)
+	if err != nil || len(keys) == 0 {
+		return err
+	}
+	slog.InfoContext(ctx, "resetting leaderboards", "period", period, "boards", len(keys))
+	return gameManager.RedisClient.Del(ctx, keys...).Err()
+}
+
+// RebuildLeaderboards recomputes the boards of a period from the completed
+// public games in Postgres and swaps them in at once.
+func (gameManager *GameManager) RebuildLeaderboards(ctx context.Context, period string) error {
+	if !contains(LeaderboardPeriods, period) {
+		return ErrUnknownLeaderboard
+	}
+	rows, err := lib.Pool.Query(ctx, `SELECT g."gameTypeId", p."userId",
+		COUNT(*) FILTER (WHERE g."winnerId" = p."userId"),
+		SUM(CASE WHEN g."winnerId" = p."userId" THEN g."winningAmount" ELSE 0 END - g."entryFee"),
+		COALESCE(MAX(p.score), 0)
+		FROM public.participants p JOIN public.games g ON g.id = p."gameId"
+		WHERE g.status = 'completed' AND NOT g.private AND g."updatedAt" >= $1
+		AND NOT EXISTS (SELECT 1 FROM public.tournament_games t WHERE t."gameId" = g.id)
+		GROUP BY g."gameTypeId", p."userId"`, periodStart(period, time.Now()))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	boards := []leaderboardRow{}
+	global := map[string]*leaderboardRow{}
+	for rows.Next() {
+		var row leaderboardRow
+		var wins, net, best int
+		if err := rows.Scan(&row.scope, &row.userId, &wins, &net, &best); err != nil {
+			return err
+		}
+		row.wins, row.net, row.best = float64(wins), float64(net), float64(best)
+		boards = append(boards, row)
+
+		total, exist := global[row.userId]
+		if !exist {
+			total = &leaderboardRow{scope: GlobalScope, userId: row.userId}
+			global[row.userId] = total
+		}
+		total.wins += row.wins
+		if row.best > total.best {
+			total.best = row.best
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, total := range global {
+		boards = append(boards, *total)
+	}
+
+	keys, err := gameManager.leaderboardKeys(ctx, period)
+	if err != nil {
+		return err
+	}
+	pipe := gameManager.RedisClient.TxPipeline()
+	if len(keys) > 0 {
+		pipe.Del(ctx, keys...)
+	}
+	for _, row := range boards {
+		row.write(ctx, pipe, period, false)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
@@ -0,0 +1,366 @@
+package gameManager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flappy-bird-server/lib"
+	"flappy-bird-server/metrics"
+	"flappy-bird-server/model"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+)
+
+const lobbySweepInterval = 5 * time.Second
+
+var ErrNotInLobby = errors.New("user is not waiting in a lobby")
+
+// A player's lobby is kept in Redis rather than on the instance holding
+// their socket, so whichever instance handles a leave or a disconnect can
+// find it.
+func userLobbyKey(userId string) string {
+	return fmt.Sprintf("mr-lobby-%s", userId)
+}
+
+func (gameManager *GameManager) setUserLobby(ctx context.Context, userId string, gameTypeId string, gameId string) error {
+	return gameManager.RedisClient.Set(ctx, userLobbyKey(userId), gameTypeId+":"+gameId, 365*24*time.Hour).Err()
+}
+
+// UserLobby returns the game type and id of the lobby a player waits in.
+func (gameManager *GameManager) UserLobby(ctx context.Context, userId string) (string, string, bool) {
+	value, err := gameManager.RedisClient.Get(ctx, userLobbyKey(userId)).Result()
+	if err != nil {
+		return "", "", false
+	}
+	gameTypeId, gameId, ok := strings.Cut(value, ":")
+	return gameTypeId, gameId, ok
+}
+
+func (gameManager *GameManager) clearUserLobby(ctx context.Context, userIds ...string) error {
+	if len(userIds) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(userIds))
+	for _, userId := range userIds {
+		keys = append(keys, userLobbyKey(userId))
+	}
+	return gameManager.RedisClient.Del(ctx, keys...).Err()
+}
+
+func (gameManager *GameManager) lobbyExists(ctx context.Context, gameTypeId string, gameId string) bool {
+	exists, err := gameManager.RedisClient.Exists(ctx, lobbyKey(gameTypeId, gameId)).Result()
+	return err == nil && exists > 0
+}
+
+func lobbyUserIds(lobby Game) []string {
+	userIds := make([]string, 0, len(lobby.Users))
+	for userId := range lobby.Users {
+		userIds = append(userIds, userId)
+	}
+	return userIds
+}
+
+// LeaveLobby takes a player out of the lobby they are waiting in.
+func (gameManager *GameManager) LeaveLobby(ctx context.Context, userId string) error {
+	gameTypeId, gameId, ok := gameManager.UserLobby(ctx, userId)
+	if !ok {
+		return ErrNotInLobby
+	}
+	if err := gameManager.RemoveFromLobby(ctx, gameTypeId, gameId, userId); err != nil {
+		return err
+	}
+	return gameManager.RedisClient.Publish(ctx, gameId, lib.Stringify(map[string]interface{}{
+		"type": "player-left",
+		"data": map[string]interface{}{
+			"userId": userId,
+		},
+	})).Err()
+}
+
+// PlayerLeft confirms the leave to a local player and frees them to join
+// another game. Their CurrentGameId may already be cleared when leaving
+// closed the lobby.
+func (gameManager *GameManager) PlayerLeft(gameId string, userId string) {
+	participant, exist := gameManager.GetUser(userId)
+	if !exist || (participant.CurrentGameId != gameId && participant.CurrentGameId != "") {
+		return
+	}
+	participant.SendMessage("left-lobby", map[string]interface{}{
+		"gameId": gameId,
+	})
+	gameManager.SetCurrentGame(userId, "")
+}
+
+// LobbyStatus is what players waiting in a lobby are told about it.
+func LobbyStatus(lobby Game, gameType model.GameType, now time.Time) map[string]interface{} {
+	status := map[string]interface{}{
+		"gameId":     lobby.Id,
+		"players":    lobby.CurrentUserCount,
+		"maxPlayers": lobby.MaxUserCount,
+		"minPlayers": gameType.MinPlayer,
+		"prize":      lobby.WinnerPrice,
+	}
+	if lobby.Private {
+		status["private"] = true
+		status["hostId"] = lobby.HostId
+		status["inviteCode"] = lobby.InviteCode
+		status["expiresAt"] = lobby.CreatedAt.Add(privateLobbyTTL)
+		return status
+	}
+	if gameType.LobbyTimeout > 0 {
+		status["expiresAt"] = lobby.CreatedAt.Add(lobbyTimeout(gameType))
+	}
+	if wait, ok := estimatedWait(lobby, gameType, now); ok {
+		status["estimatedWait"] = int(wait.Seconds())
+	}
+	return status
+}
+
+func lobbyTimeout(gameType model.GameType) time.Duration {
+	return time.Duration(gameType.LobbyTimeout) * time.Second
+}
+
+// estimatedWait extrapolates how long the lobby took per player so far to
+// the seats still open. A lobby that can start early waits at most until
+// its timeout.
+func estimatedWait(lobby Game, gameType model.GameType, now time.Time) (time.Duration, bool) {
+	remaining := lobby.MaxUserCount - lobby.CurrentUserCount
+	if remaining <= 0 {
+		return 0, true
+	}
+
+	wait, known := time.Duration(0), false
+	if waited := now.Sub(lobby.CreatedAt); lobby.CurrentUserCount > 0 && waited > 0 {
+		wait, known = waited/time.Duration(lobby.CurrentUserCount)*time.Duration(remaining), true
+	}
+
+	if gameType.MinPlayer > 0 && lobby.CurrentUserCount >= gameType.MinPlayer {
+		untilTimeout := lobby.CreatedAt.Add(lobbyTimeout(gameType)).Sub(now)
+		if untilTimeout < 0 {
+			untilTimeout = 0
+		}
+		if !known || untilTimeout < wait {
+			wait, known = untilTimeout, true
+		}
+	}
+	return wait, known
+}
+
+func (gameManager *GameManager) publishLobbyStatus(ctx context.Context, lobby Game) {
+	gameType, err := gameManager.GetGameType(lobby.GameTypeId)
+	if err != nil {
+		slog.WarnContext(ctx, "error loading game type for lobby status", "error", err)
+		return
+	}
+	status := LobbyStatus(lobby, gameType, time.Now())
+	gameManager.RedisClient.Publish(ctx, lobby.Id, lib.Stringify(map[string]interface{}{
+		"type": "lobby-status",
+		"data": status,
+	}))
+}
+
+// SendLocal sends a message to the local players of a game, whether it is
+// running here or they are still waiting in its lobby.
+func (gameManager *GameManager) SendLocal(gameId string, messageType string, data map[string]interface{}) {
+	gameManager.RangeUsers(func(user User) {
+		if user.CurrentGameId == gameId {
+			user.SendMessage(messageType, data)
+		}
+	})
+}
+
+// startLobby collects the entries of a lobby's players and starts the game.
+// It runs when the lobby fills up, or when the sweeper starts it early.
+func (gameManager *GameManager) startLobby(ctx context.Context, lobby Game) error {
+	if err := gameManager.RedisClient.Ping(ctx).Err(); err != nil {
+		return err
+	}
+
+	ids := []string{}
+	for id := range lobby.Users {
+		balance, err := gameManager.GetBalance(id)
+		if err == nil {
+			gameManager.SetBalance(id, balance-lobby.Entry)
+		}
+		ids = append(ids, fmt.Sprintf(`'%s'`, id))
+	}
+
+	err := gameManager.DbQueue.Enqueue(ctx, map[string]interface{}{
+		"type": "start-game",
+		"data": map[string]interface{}{
+			"gameId":        lobby.Id,
+			"winningAmount": lobby.WinnerPrice,
+			"private":       lobby.Private,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	// Tournament games are paid for by the buy-in.
+	if lobby.Entry > 0 {
+		err = gameManager.DbQueue.Enqueue(ctx, map[string]interface{}{
+			"type": "collect-entry",
+			"data": map[string]interface{}{
+				"gameId": lobby.Id,
+				"ids":    strings.Join(ids, ", "),
+				"entry":  lobby.Entry,
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := gameManager.DeleteLobby(ctx, lobby.GameTypeId, lobby.Id); err != nil {
+		return err
+	}
+	gameManager.clearUserLobby(ctx, lobbyUserIds(lobby)...)
+	if lobby.InviteCode != "" {
+		gameManager.RedisClient.Del(ctx, inviteKey(lobby.InviteCode))
+	}
+	lobby.Seed = rand.Int63()
+	if err := gameManager.saveGameSnapshot(ctx, lobby); err != nil {
+		slog.WarnContext(ctx, "error saving game snapshot", "error", err)
+	}
+	gameManager.startReplay(ctx, lobby)
+
+	jsonString, err := json.Marshal(map[string]interface{}{
+		"type": "start-game",
+		"data": lobby,
+	})
+	if err != nil {
+		return err
+	}
+	if err := gameManager.RedisClient.Publish(ctx, lobby.Id, string(jsonString)).Err(); err != nil {
+		return err
+	}
+	metrics.GamesStarted.WithLabelValues(lobby.GameTypeId).Inc()
+	return nil
+}
+
+// closeLobby dissolves a lobby nobody can play in any more. No entry was
+// collected yet, so there is nothing to refund.
+func (gameManager *GameManager) closeLobby(ctx context.Context, lobby Game, reason string) error {
+	if err := gameManager.DeleteLobby(ctx, lobby.GameTypeId, lobby.Id); err != nil {
+		return err
+	}
+	gameManager.clearUserLobby(ctx, lobbyUserIds(lobby)...)
+	if lobby.InviteCode != "" {
+		gameManager.RedisClient.Del(ctx, inviteKey(lobby.InviteCode))
+	}
+	if _, err := lib.Pool.Exec(ctx, `UPDATE public.games SET status = $2, "updatedAt" = NOW() WHERE id = $1 AND status = $3`, lobby.Id, "aborted", "staging"); err != nil {
+		return err
+	}
+	return gameManager.RedisClient.Publish(ctx, lobby.Id, lib.Stringify(map[string]interface{}{
+		"type": "lobby-closed",
+		"data": map[string]interface{}{
+			"gameId": lobby.Id,
+			"reason": reason,
+		},
+	})).Err()
+}
+
+// LobbyClosed tells the local players of a dissolved lobby and frees them.
+func (gameManager *GameManager) LobbyClosed(gameId string, reason string) {
+	gameManager.RangeUsers(func(user User) {
+		if user.CurrentGameId != gameId {
+			return
+		}
+		user.SendMessage("lobby-closed", map[string]interface{}{
+			"gameId": gameId,
+			"reason": reason,
+		})
+		gameManager.SetCurrentGame(user.Id, "")
+	})
+}
+
+// WatchLobbies periodically refreshes every lobby's status and applies the
+// lobby timeout of its game type.
+func (gameManager *GameManager) WatchLobbies(ctx context.Context) {
+	ticker := time.NewTicker(lobbySweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			gameManager.sweepLobbies(ctx)
+		}
+	}
+}
+
+func (gameManager *GameManager) sweepLobbies(ctx context.Context) {
+	iter := gameManager.RedisClient.Scan(ctx, 0, lobbiesKey("*"), 100).Iterator()
+	for iter.Next(ctx) {
+		gameTypeId := strings.TrimPrefix(iter.Val(), lobbiesKey(""))
+		lobbies, err := gameManager.ListLobbies(ctx, gameTypeId)
+		if err != nil {
+			slog.WarnContext(ctx, "error listing lobbies", "gameTypeId", gameTypeId, "error", err)
+			continue
+		}
+		for _, lobby := range lobbies {
+			// Every instance sweeps, the lock makes sure one of them handles
+			// a given lobby per round.
+			locked, err := gameManager.RedisClient.SetNX(ctx, "mr-lobby-sweep-"+lobby.Id, os.Getpid(), lobbySweepInterval-time.Second).Result()
+			if err != nil || !locked {
+				continue
+			}
+			gameManager.sweepLobby(lib.WithLogAttrs(ctx, "gameId", lobby.Id, "gameTypeId", gameTypeId), lobby)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		slog.WarnContext(ctx, "error scanning lobbies", "error", err)
+	}
+}
+
+// sweepLobby starts a timed out lobby early with a prize pro-rated to the
+// players it has, or closes it when it is short of the minimum. Private
+// lobbies wait for their host until privateLobbyTTL.
+func (gameManager *GameManager) sweepLobby(ctx context.Context, lobby Game) {
+	if lobby.Private {
+		if time.Since(lobby.CreatedAt) < privateLobbyTTL {
+			gameManager.publishLobbyStatus(ctx, lobby)
+		} else if err := gameManager.closeLobby(ctx, lobby, "timeout"); err != nil {
+			slog.ErrorContext(ctx, "error closing lobby", "error", err)
+		}
+		return
+	}
+
+	gameType, err := gameManager.GetGameType(lobby.GameTypeId)
+	if err != nil {
+		slog.WarnContext(ctx, "error loading game type for lobby", "error", err)
+		return
+	}
+	if gameType.LobbyTimeout == 0 || time.Since(lobby.CreatedAt) < lobbyTimeout(gameType) {
+		gameManager.publishLobbyStatus(ctx, lobby)
+		return
+	}
+
+	if gameType.MinPlayer > 0 && lobby.CurrentUserCount >= gameType.MinPlayer {
+		lobby.ProRatePrize()
+		slog.InfoContext(ctx, "starting lobby early", "players", lobby.CurrentUserCount, "prize", lobby.WinnerPrice)
+		if err := gameManager.startLobby(ctx, lobby); err != nil {
+			slog.ErrorContext(ctx, "error starting lobby early", "error", err)
+			gameManager.publishStartError(ctx, lobby)
+		}
+		return
+	}
+
+	slog.InfoContext(ctx, "closing timed out lobby", "players", lobby.CurrentUserCount)
+	if err := gameManager.closeLobby(ctx, lobby, "timeout"); err != nil {
+		slog.ErrorContext(ctx, "error closing lobby", "error", err)
+	}
+}
+
+func (gameManager *GameManager) publishStartError(ctx context.Context, lobby Game) {
+	errorPayload, err := json.Marshal(map[string]interface{}{
+		"type": "error-starting-game",
+		"data": lobby,
+	})
+	if err == nil {
+		gameManager.RedisClient.Publish(ctx, lobby.Id, string(errorPayload))
+	}
+}
@@ -0,0 +1,249 @@
+package gameManager
+
+import (
+	"context"
+	"errors"
+	"flappy-bird-server/lib"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+const maintenanceKey = "mari-arena-maintenance"
+
+// MaintenanceNoticeLead is how long before a scheduled window players start
+// receiving maintenance events.
+const MaintenanceNoticeLead = 5 * time.Minute
+
+type Maintenance struct {
+	Id        string     `json:"id"`
+	Message   string     `json:"message"`
+	StartsAt  time.Time  `json:"startsAt"`
+	EndsAt    *time.Time `json:"endsAt"`
+	CreatedBy string     `json:"createdBy"`
+}
+
+func (maintenance *Maintenance) IsActive(now time.Time) bool {
+	if maintenance == nil || now.Before(maintenance.StartsAt) {
+		return false
+	}
+	return maintenance.EndsAt == nil || now.Before(*maintenance.EndsAt)
+}
+
+func (maintenance *Maintenance) Status(now time.Time) string {
+	if maintenance == nil {
+		return "none"
+	}
+	if maintenance.IsActive(now) {
+		return "active"
+	}
+	if now.Before(maintenance.StartsAt) {
+		if maintenance.StartsAt.Sub(now) <= MaintenanceNoticeLead {
+			return "upcoming"
+		}
+		return "scheduled"
+	}
+	return "ended"
+}
+
+func (maintenance *Maintenance) Payload(now time.Time) map[string]interface{} {
+	if maintenance == nil {
+		return map[string]interface{}{
+			"status": "none",
+		}
+	}
+	return map[string]interface{}{
+		"id":       maintenance.Id,
+		"status":   maintenance.Status(now),
+		"message":  maintenance.Message,
+		"startsAt": maintenance.StartsAt,
+		"endsAt":   maintenance.EndsAt,
+	}
+}
+
+func (gameManager *GameManager) GetMaintenance() *Maintenance {
+	gameManager.maintenanceMu.RLock()
+	defer gameManager.maintenanceMu.RUnlock()
+	if gameManager.maintenance == nil {
+		return nil
+	}
+	maintenance := *gameManager.maintenance
+	return &maintenance
+}
+
+func (gameManager *GameManager) IsUnderMaintenance() bool {
+	return gameManager.GetMaintenance().IsActive(time.Now())
+}
+
+func (gameManager *GameManager) setMaintenance(maintenance *Maintenance) {
+	gameManager.maintenanceMu.Lock()
+	defer gameManager.maintenanceMu.Unlock()
+	gameManager.maintenance = maintenance
+}
+
+// LoadMaintenance refreshes the local copy of the maintenance state, Redis
+// first and Postgres when the key was lost.
+func (gameManager *GameManager) LoadMaintenance(ctx context.Context) error {
+	cached, err := gameManager.RedisClient.Get(ctx, maintenanceKey).Result()
+	if err == nil {
+		var maintenance Maintenance
+		if err := Parse(cached, &maintenance); err != nil {
+			return err
+		}
+		gameManager.setMaintenance(&maintenance)
+		return nil
+	}
+	if err != redis.Nil {
+		return err
+	}
+
+	var maintenance Maintenance
+	err = lib.Pool.QueryRow(ctx, `SELECT id, message, "startsAt", "endsAt", COALESCE("createdBy", '') FROM public.maintenance_windows WHERE "cancelledAt" IS NULL AND ("endsAt" IS NULL OR "endsAt" > NOW()) ORDER BY "startsAt" ASC LIMIT 1`).Scan(&maintenance.Id, &maintenance.Message, &maintenance.StartsAt, &maintenance.EndsAt, &maintenance.CreatedBy)
+	if err == pgx.ErrNoRows {
+		gameManager.setMaintenance(nil)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	gameManager.setMaintenance(&maintenance)
+	return gameManager.cacheMaintenance(ctx, &maintenance)
+}
+
+func (gameManager *GameManager) cacheMaintenance(ctx context.Context, maintenance *Maintenance) error {
+	if maintenance == nil {
+		return gameManager.RedisClient.Del(ctx, maintenanceKey).Err()
+	}
+	var ttl time.Duration
+	if maintenance.EndsAt != nil {
+		ttl = time.Until(*maintenance.EndsAt)
+		if ttl <= 0 {
+			return gameManager.RedisClient.Del(ctx, maintenanceKey).Err()
+		}
+	}
+	return gameManager.RedisClient.Set(ctx, maintenanceKey, lib.Stringify(maintenance), ttl).Err()
+}
+
+func (gameManager *GameManager) publishMaintenance(ctx context.Context) error {
+	return gameManager.RedisClient.Publish(ctx, "mari-arena-global", lib.Stringify(map[string]interface{}{
+		"type": "maintenance-updated",
+		"data": map[string]interface{}{},
+	})).Err()
+}
+
+// ScheduleMaintenance replaces any pending window with a new one and tells
+// every instance about it. A zero StartsAt starts maintenance right away.
+func (gameManager *GameManager) ScheduleMaintenance(ctx context.Context, message string, startsAt time.Time, endsAt *time.Time, createdBy string) (*Maintenance, error) {
+	if startsAt.IsZero() {
+		startsAt = time.Now()
+	}
+	if endsAt != nil && !endsAt.After(startsAt) {
+		return nil, errors.New("endsAt should be after startsAt")
+	}
+	if message == "" {
+		message = "We are under maintenance please try after some time"
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	maintenance := &Maintenance{
+		Id:        id.String(),
+		Message:   message,
+		StartsAt:  startsAt,
+		EndsAt:    endsAt,
+		CreatedBy: createdBy,
+	}
+
+	tx, err := lib.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `UPDATE public.maintenance_windows SET "cancelledAt" = NOW() WHERE "cancelledAt" IS NULL AND ("endsAt" IS NULL OR "endsAt" > NOW())`)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(ctx, `INSERT INTO public.maintenance_windows (id, message, "startsAt", "endsAt", "createdBy") VALUES ($1, $2, $3, $4, $5)`, maintenance.Id, maintenance.Message, maintenance.StartsAt, maintenance.EndsAt, maintenance.CreatedBy)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := gameManager.cacheMaintenance(ctx, maintenance); err != nil {
+		return nil, err
+	}
+	gameManager.setMaintenance(maintenance)
+	return maintenance, gameManager.publishMaintenance(ctx)
+}
+
+func (gameManager *GameManager) EndMaintenance(ctx context.Context) error {
+	_, err := lib.Pool.Exec(ctx, `UPDATE public.maintenance_windows SET "endsAt" = LEAST(COALESCE("endsAt", NOW()), NOW()), "cancelledAt" = CASE WHEN "startsAt" > NOW() THEN NOW() ELSE NULL END WHERE "cancelledAt" IS NULL AND ("endsAt" IS NULL OR "endsAt" > NOW())`)
+	if err != nil {
+		return err
+	}
+	if err := gameManager.cacheMaintenance(ctx, nil); err != nil {
+		return err
+	}
+	gameManager.setMaintenance(nil)
+	return gameManager.publishMaintenance(ctx)
+}
+
+func (gameManager *GameManager) broadcastLocal(messageType string, data map[string]interface{}) {
+	gameManager.RangeUsers(func(user User) {
+		user.SendMessage(messageType, data)
+	})
+}
+
+// notifyMaintenance pushes the maintenance state to local sockets whenever
+// its status changed since the last push.
+func (gameManager *GameManager) notifyMaintenance() {
+	now := time.Now()
+	gameManager.maintenanceMu.Lock()
+	maintenance := gameManager.maintenance
+	status := maintenance.Status(now)
+	if status == "ended" {
+		gameManager.maintenance = nil
+		maintenance = nil
+		status = "none"
+	}
+
+	notified := status
+	if maintenance != nil {
+		notified = maintenance.Id + status
+	}
+	skip := gameManager.maintenanceNotified == notified || status == "scheduled" || (status == "none" && gameManager.maintenanceNotified == "")
+	if !skip {
+		gameManager.maintenanceNotified = notified
+	}
+	gameManager.maintenanceMu.Unlock()
+
+	if !skip {
+		gameManager.broadcastLocal("maintenance", maintenance.Payload(now))
+	}
+}
+
+func (gameManager *GameManager) WatchMaintenance(ctx context.Context) {
+	if err := gameManager.LoadMaintenance(ctx); err != nil {
+		slog.ErrorContext(ctx, "error loading maintenance state", "error", err)
+	}
+
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			gameManager.notifyMaintenance()
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package gameManager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Each game type can have several staging lobbies at once. A lobby lives
+// under its own key and lobbies:<gameTypeId> indexes the open ones.
+func lobbyKey(gameTypeId string, gameId string) string {
+	return fmt.Sprintf("newGame:%s:%s", gameTypeId, gameId)
+}
+
+func lobbiesKey(gameTypeId string) string {
+	return fmt.Sprintf("lobbies:%s", gameTypeId)
+}
+
+// Rating is the mean rating of the players waiting in a lobby.
+func (game *Game) Rating() float64 {
+	if len(game.Ratings) == 0 {
+		return DefaultRating
+	}
+	total := 0.0
+	for _, rating := range game.Ratings {
+		total += rating
+	}
+	return total / float64(len(game.Ratings))
+}
+
+func (gameManager *GameManager) GetLobby(ctx context.Context, gameTypeId string, gameId string) (Game, error) {
+	return gameManager.GetStagingGameFromRedis(lobbyKey(gameTypeId, gameId))
+}
+
+// ListLobbies returns the open lobbies of a game type, dropping index
+// entries whose lobby is gone.
+func (gameManager *GameManager) ListLobbies(ctx context.Context, gameTypeId string) ([]Game, error) {
+	gameIds, err := gameManager.RedisClient.SMembers(ctx, lobbiesKey(gameTypeId)).Result()
+	if err != nil {
+		return nil, err
+	}
+	lobbies := make([]Game, 0, len(gameIds))
+	for _, gameId := range gameIds {
+		lobby, err := gameManager.GetLobby(ctx, gameTypeId, gameId)
+		if err != nil {
+			gameManager.RedisClient.SRem(ctx, lobbiesKey(gameTypeId), gameId)
+			continue
+		}
+		lobbies = append(lobbies, lobby)
+	}
+	return lobbies, nil
+}
+
+func (gameManager *GameManager) SaveLobby(ctx context.Context, lobby Game) error {
+	payload, err := json.Marshal(lobby)
+	if err != nil {
+		return err
+	}
+	if err := gameManager.RedisClient.Set(ctx, lobbyKey(lobby.GameTypeId, lobby.Id), string(payload), 365*24*time.Hour).Err(); err != nil {
+		return err
+	}
+	return gameManager.RedisClient.SAdd(ctx, lobbiesKey(lobby.GameTypeId), lobby.Id).Err()
+}
+
+func (gameManager *GameManager) DeleteLobby(ctx context.Context, gameTypeId string, gameId string) error {
+	if err := gameManager.RedisClient.Del(ctx, lobbyKey(gameTypeId, gameId)).Err(); err != nil {
+		return err
+	}
+	return gameManager.RedisClient.SRem(ctx, lobbiesKey(gameTypeId), gameId).Err()
+}
+
+// RatingBand is how far from a lobby's rating a player may be to join it.
+// It starts at MATCHMAKING_BAND and widens by MATCHMAKING_BAND_GROWTH per
+// minute the lobby has been waiting, up to MATCHMAKING_MAX_BAND.
+func (gameManager *GameManager) RatingBand(waited time.Duration) float64 {
+	band := float64(gameManager.Config.MatchmakingBand) + float64(gameManager.Config.MatchmakingBandGrowth)*waited.Minutes()
+	return math.Min(band, float64(gameManager.Config.MatchmakingMaxBand))
+}
+
+// FindLobby picks the open public lobby closest to the player's rating among
+// those whose band covers it. A lobby the player is already in always wins.
+func (gameManager *GameManager) FindLobby(ctx context.Context, gameTypeId string, userId string, rating float64) (Game, bool, error) {
+	lobbies, err := gameManager.ListLobbies(ctx, gameTypeId)
+	if err != nil {
+		return Game{}, false, err
+	}
+
+	var best Game
+	found := false
+	bestDistance := math.Inf(1)
+	for _, lobby := range lobbies {
+		if lobby.Private {
+			continue
+		}
+		if lobby.Users[userId] {
+			return lobby, true, nil
+		}
+		if lobby.CurrentUserCount >= lobby.MaxUserCount {
+			continue
+		}
+		distance := math.Abs(lobby.Rating() - rating)
+		if distance <= gameManager.RatingBand(time.Since(lobby.CreatedAt)) && distance < bestDistance {
+			best = lobby
+			found = true
+			bestDistance = distance
+		}
+	}
+	return best, found, nil
+}
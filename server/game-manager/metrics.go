@@ -0,0 +1,48 @@
+package gameManager
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	gamesDesc = prometheus.NewDesc("mari_arena_games", "Games held in memory on this instance, by status and game type.", []string{"status", "game_type"}, nil)
+	usersDesc = prometheus.NewDesc("mari_arena_users", "Registered websocket users on this instance.", nil, nil)
+	depthDesc = prometheus.NewDesc("mari_arena_queue_depth", "Tasks waiting in a queue, and tasks taken but not acknowledged.", []string{"queue", "state"}, nil)
+)
+
+// collector reads the game manager at scrape time instead of keeping
+// gauges in sync with every map change.
+type collector struct {
+	gameManager *GameManager
+}
+
+func (c collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- gamesDesc
+	ch <- usersDesc
+	ch <- depthDesc
+}
+
+func (c collector) Collect(ch chan<- prometheus.Metric) {
+	counts := map[[2]string]int{}
+	for _, game := range c.gameManager.ListGames() {
+		counts[[2]string{game.Status, game.GameTypeId}] += 1
+	}
+	for labels, count := range counts {
+		ch <- prometheus.MustNewConstMetric(gamesDesc, prometheus.GaugeValue, float64(count), labels[0], labels[1])
+	}
+	ch <- prometheus.MustNewConstMetric(usersDesc, prometheus.GaugeValue, float64(c.gameManager.UserCount()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for _, queue := range []*Queue{&c.gameManager.DbQueue, &c.gameManager.GameQueue} {
+		if waiting, err := queue.client.LLen(ctx, queue.queueName).Result(); err == nil {
+			ch <- prometheus.MustNewConstMetric(depthDesc, prometheus.GaugeValue, float64(waiting), queue.queueName, "waiting")
+		}
+		if processing, err := queue.client.LLen(ctx, queue.processingKey).Result(); err == nil {
+			ch <- prometheus.MustNewConstMetric(depthDesc, prometheus.GaugeValue, float64(processing), queue.queueName, "processing")
+		}
+	}
+}
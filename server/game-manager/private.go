@@ -0,0 +1,206 @@
+package gameManager
+
+import (
+	"context"
+	"crypto/rand"
+	"flappy-bird-server/lib"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// privateLobbyTTL is how long a private lobby and its invite code live
+// when the host never starts it.
+const privateLobbyTTL = time.Hour
+
+const inviteCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+const inviteCodeLength = 6
+
+func inviteKey(code string) string {
+	return fmt.Sprintf("mr-invite-%s", code)
+}
+
+func newInviteCode() (string, error) {
+	code := make([]byte, inviteCodeLength)
+	for i := range code {
+		index, err := rand.Int(rand.Reader, big.NewInt(int64(len(inviteCodeAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		code[i] = inviteCodeAlphabet[index.Int64()]
+	}
+	return string(code), nil
+}
+
+// reserveInviteCode points a fresh invite code at a lobby, retrying the
+// rare collision with a code still in use.
+func (gameManager *GameManager) reserveInviteCode(ctx context.Context, gameTypeId string, gameId string) (string, error) {
+	for attempt := 0; attempt < 5; attempt++ {
+		code, err := newInviteCode()
+		if err != nil {
+			return "", err
+		}
+		reserved, err := gameManager.RedisClient.SetNX(ctx, inviteKey(code), gameTypeId+":"+gameId, privateLobbyTTL).Result()
+		if err != nil {
+			return "", err
+		}
+		if reserved {
+			return code, nil
+		}
+	}
+	return "", fmt.Errorf("could not find a free invite code")
+}
+
+func (gameManager *GameManager) userError(userId string, message string) {
+	gameManager.RedisClient.Publish(gameManager.Context, "mari-arena-global", lib.Stringify(map[string]interface{}{
+		"type": "user-error",
+		"data": map[string]string{
+			"userId":  userId,
+			"message": message,
+		},
+	}))
+}
+
+// canEnterPrivateLobby checks what keeps a player from creating or joining
+// a private lobby and tells them why.
+func (gameManager *GameManager) canEnterPrivateLobby(ctx context.Context, userId string) bool {
+	if gameManager.IsDraining() {
+		gameManager.userError(userId, "Server is restarting, please try again in a moment")
+		return false
+	}
+	if gameManager.IsUnderMaintenance() {
+		gameManager.userError(userId, gameManager.GetMaintenance().Message)
+		return false
+	}
+	if lobbyTypeId, lobbyId, waiting := gameManager.UserLobby(ctx, userId); waiting && gameManager.lobbyExists(ctx, lobbyTypeId, lobbyId) {
+		gameManager.userError(userId, "Leave your current lobby before joining another one")
+		return false
+	}
+	return true
+}
+
+// CreatePrivateGame opens a lobby that only players with its invite code
+// can join. Its prize is scaled to the seats the host asked for, at the
+// game type's own ratio.
+func (gameManager *GameManager) CreatePrivateGame(ctx context.Context, userId string, gameTypeId string, maxPlayers int) {
+	ctx = lib.WithLogAttrs(ctx, "userId", userId, "gameTypeId", gameTypeId)
+	if !gameManager.canEnterPrivateLobby(ctx, userId) {
+		return
+	}
+
+	gameType, err := gameManager.GetGameType(gameTypeId)
+	if err != nil || !gameType.Active {
+		gameManager.userError(userId, "Invalid game type")
+		return
+	}
+	if maxPlayers == 0 {
+		maxPlayers = gameType.MaxPlayer
+	}
+	if maxPlayers < 2 || maxPlayers > gameType.MaxPlayer {
+		gameManager.userError(userId, fmt.Sprintf("maxPlayers should be between 2 and %d", gameType.MaxPlayer))
+		return
+	}
+	if balance, err := gameManager.GetBalance(userId); err != nil || balance < gameType.Entry {
+		gameManager.userError(userId, "Insufficient balance")
+		return
+	}
+
+	lobby, err := gameManager.CreateGame(ctx, maxPlayers, gameType.Winner*maxPlayers/gameType.MaxPlayer, gameType.Entry, gameType.Id)
+	if err != nil {
+		gameManager.userError(userId, "Error while creating new game")
+		return
+	}
+	code, err := gameManager.reserveInviteCode(ctx, gameType.Id, lobby.Id)
+	if err != nil {
+		slog.ErrorContext(ctx, "error reserving invite code", "gameId", lobby.Id, "error", err)
+		gameManager.userError(userId, "Error while creating new game")
+		return
+	}
+	lobby.Private = true
+	lobby.HostId = userId
+	lobby.InviteCode = code
+	if err := gameManager.SaveLobby(ctx, *lobby); err != nil {
+		gameManager.userError(userId, "Error while creating new game")
+		return
+	}
+
+	rating, err := gameManager.GetRating(ctx, userId, gameTypeId)
+	if err != nil {
+		rating = DefaultRating
+	}
+	if !gameManager.joinLobby(ctx, userId, *lobby, rating) {
+		return
+	}
+	gameManager.RedisClient.Publish(gameManager.Context, "mari-arena-global", lib.Stringify(map[string]interface{}{
+		"type": "private-game-created",
+		"data": map[string]interface{}{
+			"userId":     userId,
+			"gameId":     lobby.Id,
+			"inviteCode": code,
+			"maxPlayers": maxPlayers,
+		},
+	}))
+}
+
+// JoinPrivateGame seats a player in the private lobby behind an invite code.
+func (gameManager *GameManager) JoinPrivateGame(ctx context.Context, userId string, inviteCode string) {
+	ctx = lib.WithLogAttrs(ctx, "userId", userId)
+	if !gameManager.canEnterPrivateLobby(ctx, userId) {
+		return
+	}
+
+	value, err := gameManager.RedisClient.Get(ctx, inviteKey(strings.ToUpper(strings.TrimSpace(inviteCode)))).Result()
+	if err != nil {
+		gameManager.userError(userId, "Invalid invite code")
+		return
+	}
+	gameTypeId, gameId, _ := strings.Cut(value, ":")
+	lobby, err := gameManager.GetLobby(ctx, gameTypeId, gameId)
+	if err != nil || !lobby.Private {
+		gameManager.userError(userId, "Invalid invite code")
+		return
+	}
+	if lobby.CurrentUserCount >= lobby.MaxUserCount {
+		gameManager.userError(userId, "This game is full")
+		return
+	}
+
+	rating, err := gameManager.GetRating(ctx, userId, gameTypeId)
+	if err != nil {
+		rating = DefaultRating
+	}
+	gameManager.joinLobby(ctx, userId, lobby, rating)
+}
+
+// StartPrivateGame lets the host start their lobby with whoever has joined.
+// Entries and the payout then go through the same tasks as public games.
+func (gameManager *GameManager) StartPrivateGame(ctx context.Context, userId string) {
+	ctx = lib.WithLogAttrs(ctx, "userId", userId)
+	gameTypeId, gameId, waiting := gameManager.UserLobby(ctx, userId)
+	if !waiting {
+		gameManager.userError(userId, "You are not waiting in a lobby")
+		return
+	}
+	lobby, err := gameManager.GetLobby(ctx, gameTypeId, gameId)
+	if err != nil {
+		gameManager.userError(userId, "You are not waiting in a lobby")
+		return
+	}
+	if !lobby.Private || lobby.HostId != userId {
+		gameManager.userError(userId, "Only the host can start this game")
+		return
+	}
+	if lobby.CurrentUserCount < 2 {
+		gameManager.userError(userId, "At least 2 players are needed to start")
+		return
+	}
+
+	ctx = lib.WithLogAttrs(ctx, "gameId", lobby.Id)
+	lobby.ProRatePrize()
+	if err := gameManager.startLobby(ctx, lobby); err != nil {
+		slog.ErrorContext(ctx, "error starting private game", "error", err)
+		gameManager.publishStartError(ctx, lobby)
+	}
+}
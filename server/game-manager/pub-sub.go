@@ -3,8 +3,9 @@ package gameManager
 import (
 	"context"
 	"encoding/json"
-	"fmt"
-	"log"
+	"flappy-bird-server/lib"
+	"log/slog"
+	"os"
 )
 
 func (gameManager *GameManager) SubscribeGame(ctx context.Context, channel string) {
@@ -13,23 +14,32 @@ func (gameManager *GameManager) SubscribeGame(ctx context.Context, channel strin
 
 	_, err := pubsub.Receive(ctx)
 	if err != nil {
-		log.Fatalf("Could not subscribe to channel: %v", err)
+		slog.ErrorContext(ctx, "could not subscribe to channel", "channel", channel, "error", err)
+		os.Exit(1)
+	}
+
+	channelCtx := lib.WithLogAttrs(ctx, "channel", channel)
+	if channel != "mari-arena-global" {
+		channelCtx = lib.WithLogAttrs(channelCtx, "gameId", channel)
+	} else {
+		gameManager.globalPubSub.Store(true)
+		defer gameManager.globalPubSub.Store(false)
 	}
 
 	for {
 		select {
 		case <-ctx.Done():
-			fmt.Println("Stopping Redis Pub/Sub...")
+			slog.InfoContext(channelCtx, "stopping redis pub/sub")
 			return
 		case msg, ok := <-pubsub.Channel():
 			var parsedData map[string]interface{}
 			if !ok {
-				fmt.Println("Redis Pub/Sub channel closed")
+				slog.InfoContext(channelCtx, "redis pub/sub channel closed")
 				return
 			}
 			err = Parse(msg.Payload, &parsedData)
 			if err != nil {
-				fmt.Printf("Error in Parse: %v\n", err)
+				slog.ErrorContext(channelCtx, "error parsing pub/sub message", "error", err)
 				return
 			}
 
@@ -37,29 +47,67 @@ func (gameManager *GameManager) SubscribeGame(ctx context.Context, channel strin
 			taskPayload := parsedData["data"].(map[string]interface{})
 			payloadString, err := json.Marshal(taskPayload)
 			if err != nil {
-				fmt.Printf("Error in Parse: %v\n", err)
+				slog.ErrorContext(channelCtx, "error encoding pub/sub payload", "type", taskType, "error", err)
 				return
 			}
 
-			log.Println("44", taskType, taskPayload["users"])
+			userId, _ := taskPayload["userId"].(string)
+			messageCtx := lib.WithLogAttrs(channelCtx, "messageType", taskType, "userId", userId)
+			slog.DebugContext(messageCtx, "pub/sub message received")
 			switch taskType {
 			case "user-join-game":
 				gameManager.UserJoinGame(taskPayload["userId"].(string), taskPayload["gameId"].(string), taskPayload["users"])
+			case "maintenance-updated":
+				if err := gameManager.LoadMaintenance(ctx); err != nil {
+					slog.ErrorContext(messageCtx, "error loading maintenance state", "error", err)
+				}
+				gameManager.notifyMaintenance()
+			case "gametype-updated":
+				gameManager.forgetGameType(taskPayload["gameTypeId"].(string))
+			case "private-game-created":
+				gameManager.UserSendMessage(taskPayload["userId"].(string), "private-game-created", taskPayload)
+			case "tournament-updated":
+				gameManager.TournamentUpdated(taskPayload)
+			case "tournament-round":
+				gameManager.UserSendMessage(taskPayload["userId"].(string), "tournament-round", taskPayload)
 			case "user-error":
 				gameManager.UserSendError(taskPayload["userId"].(string), taskPayload["message"].(string))
 			case "start-game":
 				gameManager.StartGame(string(payloadString))
 			case "error-starting-game":
 				gameManager.ErrorStatingGame(string(payloadString))
+			case "game-aborted":
+				gameManager.AbortLocalGame(channel)
+			case "force-ended":
+				gameManager.EndLocalGame(channel, taskPayload["winnerId"].(string))
+			case "player-kicked":
+				gameManager.PlayerKicked(channel, taskPayload["userId"].(string))
+			case "player-left":
+				gameManager.PlayerLeft(channel, taskPayload["userId"].(string))
+			case "lobby-status":
+				gameManager.SendLocal(channel, "lobby-status", taskPayload)
+			case "lobby-closed":
+				gameManager.LobbyClosed(channel, taskPayload["reason"].(string))
 			case "update-board":
 				gameManager.UpdateBoard(channel, taskPayload["userId"].(string))
 			case "game-over":
 				gameManager.GameOver(channel, taskPayload["userId"].(string))
 			}
+			if channel != "mari-arena-global" {
+				gameManager.notifySpectators(channel, taskType, taskPayload)
+			}
 		}
 	}
 }
 
+// subscribe starts listening to a game's channel unless this instance
+// already does. Websocket, pub/sub and queue goroutines all get here.
+func (gameManager *GameManager) subscribe(gameId string) {
+	if _, subscribed := gameManager.Subscriptions.LoadOrStore(gameId, true); !subscribed {
+		go gameManager.SubscribeGame(gameManager.Context, gameId)
+	}
+}
+
 func (gameManager *GameManager) UserSendError(userId string, message string) {
 	targetUser, useExist := gameManager.GetUser(userId)
 	if !useExist {
@@ -70,6 +118,14 @@ func (gameManager *GameManager) UserSendError(userId string, message string) {
 	})
 }
 
+func (gameManager *GameManager) UserSendMessage(userId string, messageType string, data map[string]interface{}) {
+	targetUser, useExist := gameManager.GetUser(userId)
+	if !useExist {
+		return
+	}
+	targetUser.SendMessage(messageType, data)
+}
+
 func (gameManager *GameManager) UserJoinGame(userId string, gameId string, keys interface{}) {
 	targetUser, useExist := gameManager.GetUser(userId)
 	if !useExist {
@@ -79,26 +135,16 @@ func (gameManager *GameManager) UserJoinGame(userId string, gameId string, keys
 		"users":  keys,
 		"gameId": gameId,
 	})
-	gameManager.Users[targetUser.Id] = User{
-		Id:            targetUser.Id,
-		CurrentGameId: gameId,
-		PublicKey:     targetUser.PublicKey,
-		Ws:            targetUser.Ws,
-	}
-
-	if !gameManager.Subscriptions[gameId] {
-		gameManager.Subscriptions[gameId] = true
-		go gameManager.SubscribeGame(gameManager.Context, gameId)
-	}
+	gameManager.SetCurrentGame(targetUser.Id, gameId)
 
+	gameManager.subscribe(gameId)
 }
 
 func (gameManager *GameManager) ErrorStatingGame(gameJsonString string) {
 	var game Game
-	err := Parse(gameJsonString, game)
+	err := Parse(gameJsonString, &game)
 	if err != nil {
-		log.Println(gameJsonString)
-		log.Fatal("Something went wrong while parsing game string")
+		slog.Error("error parsing game", "game", gameJsonString, "error", err)
 		return
 	}
 	for k, _ := range game.Users {
@@ -116,8 +162,7 @@ func (gameManager *GameManager) StartGame(gameJsonString string) {
 	var game Game
 	err := Parse(gameJsonString, &game)
 	if err != nil {
-		log.Println(gameJsonString)
-		log.Fatal("Something went wrong while parsing game string", err.Error())
+		slog.Error("error parsing game", "game", gameJsonString, "error", err)
 		return
 	}
 	users := []string{}
@@ -145,18 +190,21 @@ func (gameManager *GameManager) StartGame(gameJsonString string) {
 	}
 
 	game.Status = "ongoing"
-	gameManager.StartedGames[game.Id] = game
+	gameManager.SetGame(game)
 
 	for _, id := range users {
 		participant, exist := gameManager.GetUser(id)
 		if exist {
 			if err != nil {
-				log.Println(err.Error())
+				slog.Error("error starting game", "gameId", game.Id, "userId", id, "error", err)
 				participant.SendMessage("error", map[string]interface{}{
 					"message": "Something went wrong while collecting entry fees",
 				})
 			} else {
-				participant.SendMessage("start-game", map[string]interface{}{})
+				participant.SendMessage("start-game", map[string]interface{}{
+					"gameId": game.Id,
+					"seed":   game.Seed,
+				})
 			}
 		}
 	}
@@ -3,12 +3,17 @@ package gameManager
 import (
 	"context"
 	"encoding/json"
+	"flappy-bird-server/audit"
 	"flappy-bird-server/lib"
+	"flappy-bird-server/metrics"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"os"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -19,18 +24,35 @@ type Queue struct {
 	timeout       time.Duration
 }
 
+// Enqueue pushes a task. The log attributes of ctx travel with it under
+// "log" so the worker logs it with the same request, game and user ids.
 func (q *Queue) Enqueue(ctx context.Context, item map[string]interface{}) error {
+	if attrs := lib.LogAttrs(ctx); len(attrs) > 0 {
+		item["log"] = attrs
+	}
 	jsonData, err := json.Marshal(item)
 	if err != nil {
 		return err
 	}
 	err = q.client.LPush(ctx, q.queueName, string(jsonData)).Err()
 	if err != nil {
-		log.Println("Enqueue 29", err.Error())
+		slog.ErrorContext(ctx, "error enqueuing task", "queue", q.queueName, "task", item["type"], "error", err)
 		return err
 	}
 	return nil
+}
 
+// claimedKey maps every task in the processing list to the unix
+// milliseconds a worker took it at, so RetryFailedTasks can tell a task
+// that failed or whose worker died from one that is still running.
+func (q *Queue) claimedKey() string {
+	return q.processingKey + ":claimed"
+}
+
+func (q *Queue) claim(ctx context.Context, item string) {
+	if err := q.client.HSetNX(ctx, q.claimedKey(), item, time.Now().UnixMilli()).Err(); err != nil {
+		slog.WarnContext(ctx, "error recording task claim", "queue", q.queueName, "error", err)
+	}
 }
 
 func (q *Queue) Dequeue(ctx context.Context) (string, error) {
@@ -38,47 +60,92 @@ func (q *Queue) Dequeue(ctx context.Context) (string, error) {
 	if err == redis.Nil {
 		return "", nil
 	}
+	if err == nil {
+		q.claim(ctx, result)
+	}
 	return result, err
 }
 
 func (q *Queue) Acknowledge(ctx context.Context, item string) error {
-	return q.client.LRem(ctx, q.processingKey, 0, item).Err()
+	if err := q.client.LRem(ctx, q.processingKey, 0, item).Err(); err != nil {
+		return err
+	}
+	return q.client.HDel(ctx, q.claimedKey(), item).Err()
 }
 
+// RetryFailedTasks puts tasks back on the queue that were claimed more than
+// QUEUE_TIMEOUT ago and never acknowledged.
 func (q *Queue) RetryFailedTasks(ctx context.Context) error {
 	items, err := q.client.LRange(ctx, q.processingKey, 0, -1).Result()
 	if err != nil {
 		return err
 	}
 
+	now := time.Now()
 	for _, item := range items {
-		if time.Since(time.Now()) > q.timeout {
-			if err := q.client.LPush(ctx, q.queueName, item).Err(); err != nil {
-				return err
-			}
-			if err := q.client.LRem(ctx, q.processingKey, 0, item).Err(); err != nil {
-				return err
-			}
-			fmt.Printf("Requeued item: %s\n", item)
+		claimed, err := q.client.HGet(ctx, q.claimedKey(), item).Int64()
+		if err == redis.Nil {
+			// The worker died between claiming the task and recording it,
+			// the clock starts now.
+			q.client.HSetNX(ctx, q.claimedKey(), item, now.UnixMilli())
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if now.Sub(time.UnixMilli(claimed)) <= q.timeout {
+			continue
+		}
+		if err := q.client.LPush(ctx, q.queueName, item).Err(); err != nil {
+			return err
 		}
+		if err := q.client.LRem(ctx, q.processingKey, 0, item).Err(); err != nil {
+			return err
+		}
+		if err := q.client.HDel(ctx, q.claimedKey(), item).Err(); err != nil {
+			return err
+		}
+		slog.Info("requeued task", "queue", q.queueName, "item", item)
 	}
 	return nil
 }
 
+// holds tells whether a task for the failed operation is waiting in the
+// queue or being processed.
+func (q *Queue) holds(ctx context.Context, operationId string) (bool, error) {
+	marker := fmt.Sprintf(`"%s":"%s"`, failedOperationKey, operationId)
+	for _, key := range []string{q.queueName, q.processingKey} {
+		items, err := q.client.LRange(ctx, key, 0, -1).Result()
+		if err != nil {
+			return false, err
+		}
+		for _, item := range items {
+			if strings.Contains(item, marker) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
 func (q *Queue) ProcessQueue(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("Stopping redis queue")
+			slog.Info("stopping redis queue", "queue", q.queueName)
+			q.Drain()
 			return
 		default:
 			item, err := q.Dequeue(ctx)
 			if err != nil {
+				if ctx.Err() != nil {
+					continue
+				}
 				if err == io.EOF {
 					time.Sleep(2 * time.Second)
 					continue
 				} else {
-					log.Printf("Error dequeuing task: %v", err)
+					slog.Error("error dequeuing task", "queue", q.queueName, "error", err)
 					time.Sleep(2 * time.Second)
 					continue
 				}
@@ -87,46 +154,130 @@ func (q *Queue) ProcessQueue(ctx context.Context) {
 				continue
 			}
 
-			var parsedData map[string]interface{}
-			err = Parse(item, &parsedData)
-			if err != nil {
-				fmt.Printf("Error in Parse: %v\n", err)
-				return
-			}
+			q.processItem(ctx, item)
+		}
+	}
+}
 
-			taskType := parsedData["type"].(string)
-			taskPayload := parsedData["data"].(map[string]interface{})
-			log.Printf("Processing ====== %s", taskType)
-			switch taskType {
-			case "create-game":
-				err = CreateGame(ctx, taskPayload)
-			case "add-participant":
-				err = AddParticipant(ctx, taskPayload)
-			case "start-game":
-				err = StartGame(ctx, taskPayload)
-			case "collect-entry":
-				err = CollectEntry(ctx, taskPayload)
-			case "join-game":
-				JoinGame(ctx, taskPayload)
-			case "end-game":
-				err = EndGame(ctx, taskPayload)
-			case "update-balance":
-				err = UpdateBalance(ctx, taskPayload)
-			case "delete-user":
-				GetInstance().DeleteUser(taskPayload["userId"].(string))
-			}
+// Drain processes whatever is left in the queue without blocking, so tasks
+// enqueued during shutdown, refunds in particular, are not left behind.
+func (q *Queue) Drain() {
+	ctx, cancel := context.WithTimeout(context.Background(), q.timeout)
+	defer cancel()
+	for {
+		item, err := q.client.RPopLPush(ctx, q.queueName, q.processingKey).Result()
+		if err == redis.Nil {
+			return
+		}
+		if err != nil {
+			slog.Error("error draining queue", "queue", q.queueName, "error", err)
+			return
+		}
+		q.claim(ctx, item)
+		q.processItem(ctx, item)
+	}
+}
 
-			if err != nil {
-				log.Printf("Failed to retry tasks: %s", err.Error())
-			} else {
-				if err := q.Acknowledge(ctx, item); err != nil {
-					log.Fatalf("Failed to acknowledge task: %v", err)
-				}
-			}
+func (q *Queue) processItem(ctx context.Context, item string) {
+	var parsedData struct {
+		Type string                 `json:"type"`
+		Data map[string]interface{} `json:"data"`
+		Log  map[string]string      `json:"log"`
+	}
+	err := Parse(item, &parsedData)
+	if err != nil {
+		slog.ErrorContext(ctx, "error parsing task", "queue", q.queueName, "error", err)
+		return
+	}
+
+	taskType := parsedData.Type
+	taskPayload := parsedData.Data
+	ctx = taskContext(ctx, q.queueName, taskType, parsedData.Log, taskPayload)
+	slog.DebugContext(ctx, "processing task")
+	start := time.Now()
+	switch taskType {
+	case "create-game":
+		err = CreateGame(ctx, taskPayload)
+	case "add-participant":
+		err = AddParticipant(ctx, taskPayload)
+	case "start-game":
+		err = StartGame(ctx, taskPayload)
+	case "collect-entry":
+		err = CollectEntry(ctx, taskPayload)
+	case "join-game":
+		JoinGame(ctx, taskPayload)
+	case "end-game":
+		err = EndGame(ctx, taskPayload)
+	case "update-balance":
+		err = UpdateBalance(ctx, taskPayload)
+	case "settle-game":
+		_, err = SettleGame(ctx, taskPayload["gameId"].(string), taskPayload["winnerId"].(string), int(taskPayload["amount"].(float64)))
+	case "refund-game":
+		err = RefundGame(ctx, taskPayload)
+	case "update-ratings":
+		err = UpdateRatings(ctx, taskPayload)
+	case "record-scores":
+		err = RecordScores(ctx, taskPayload)
+	case "save-replay":
+		err = SaveReplay(ctx, taskPayload)
+	case "create-private-game", "join-private-game", "start-private-game":
+		PrivateGame(ctx, taskType, taskPayload)
+	case "tournament-game-finished":
+		err = RecordTournamentGame(ctx, taskPayload)
+	case "leave-lobby":
+		err = LeaveLobby(ctx, taskPayload)
+	case "delete-user":
+		GetInstance().DeleteUser(taskPayload["userId"].(string))
+	}
+
+	metrics.QueueTaskDuration.WithLabelValues(q.queueName, taskType).Observe(time.Since(start).Seconds())
+	result := "success"
+	if err != nil {
+		result = "failed"
+	}
+	metrics.QueueTasks.WithLabelValues(q.queueName, taskType, result).Inc()
+
+	operationId, replayed := taskPayload[failedOperationKey].(string)
+	if err != nil {
+		slog.ErrorContext(ctx, "task failed", "error", err)
+		// Journaled tasks leave the queue once they are safely recorded,
+		// anything else stays in the processing list.
+		if replayed {
+			err = failOperation(ctx, operationId, err)
+		} else if journaledTasks[taskType] {
+			err = RecordFailedOperation(ctx, taskType, taskPayload, "queue", err)
+		}
+		if err != nil {
+			return
 		}
+	} else if replayed {
+		resolveOperation(ctx, operationId)
+	}
+
+	if err := q.Acknowledge(ctx, item); err != nil {
+		slog.ErrorContext(ctx, "error acknowledging task", "error", err)
+		os.Exit(1)
 	}
 }
 
+// taskContext restores the log attributes a task was enqueued with and adds
+// the game and user it is about.
+func taskContext(ctx context.Context, queueName string, taskType string, attrs map[string]string, taskPayload map[string]interface{}) context.Context {
+	args := []string{"queue", queueName, "task", taskType}
+	for key, value := range attrs {
+		args = append(args, key, value)
+	}
+	for _, key := range []string{"gameId", "userId", "winnerId", failedOperationKey} {
+		if value, ok := taskPayload[key].(string); ok {
+			args = append(args, key, value)
+		}
+	}
+	if value, ok := taskPayload["id"].(string); ok && taskType == "create-game" {
+		args = append(args, "gameId", value)
+	}
+	return lib.WithLogAttrs(ctx, args...)
+}
+
 func Parse(jsonStr string, result interface{}) error {
 	return json.Unmarshal([]byte(jsonStr), result)
 }
@@ -143,28 +294,223 @@ func AddParticipant(ctx context.Context, taskPayload map[string]interface{}) err
 	return err
 }
 
+// StartGame marks a game ongoing. Lobbies started early send the pro-rated
+// prize along, which replaces the one the game was created with. Private
+// games are flagged so leaderboard rebuilds skip them.
 func StartGame(ctx context.Context, taskPayload map[string]interface{}) error {
-	_, err := lib.Pool.Exec(ctx, `UPDATE public.games SET status = $2 WHERE id =  $1`, taskPayload["gameId"], "ongoing")
+	var winningAmount *int
+	if amount, ok := taskPayload["winningAmount"].(float64); ok {
+		value := int(amount)
+		winningAmount = &value
+	}
+	private, _ := taskPayload["private"].(bool)
+	// A game aborted before this task ran stays aborted.
+	_, err := lib.Pool.Exec(ctx, `UPDATE public.games SET status = $2, "winningAmount" = COALESCE($3, "winningAmount"), private = $4 WHERE id =  $1 AND status = $5`, taskPayload["gameId"], "ongoing", winningAmount, private, "staging")
 	return err
 }
 
 func JoinGame(ctx context.Context, taskPayload map[string]interface{}) error {
-	GetInstance().JoinGame(taskPayload["userId"].(string), taskPayload["gameTypeId"].(string))
+	GetInstance().JoinGame(ctx, taskPayload["userId"].(string), taskPayload["gameTypeId"].(string))
 	return nil
 }
 
+// PrivateGame runs the private lobby commands players send over the
+// websocket. Missing fields come through as empty and are rejected there.
+func PrivateGame(ctx context.Context, taskType string, taskPayload map[string]interface{}) {
+	userId, _ := taskPayload["userId"].(string)
+	switch taskType {
+	case "create-private-game":
+		gameTypeId, _ := taskPayload["gameTypeId"].(string)
+		maxPlayers, _ := taskPayload["maxPlayers"].(float64)
+		GetInstance().CreatePrivateGame(ctx, userId, gameTypeId, int(maxPlayers))
+	case "join-private-game":
+		inviteCode, _ := taskPayload["inviteCode"].(string)
+		GetInstance().JoinPrivateGame(ctx, userId, inviteCode)
+	case "start-private-game":
+		GetInstance().StartPrivateGame(ctx, userId)
+	}
+}
+
+// LeaveLobby tells the player when there was no lobby to leave, a failure
+// to leave is reported by the task.
+func LeaveLobby(ctx context.Context, taskPayload map[string]interface{}) error {
+	userId := taskPayload["userId"].(string)
+	err := GetInstance().LeaveLobby(ctx, userId)
+	if err == ErrNotInLobby {
+		GetInstance().RedisClient.Publish(ctx, "mari-arena-global", lib.Stringify(map[string]interface{}{
+			"type": "user-error",
+			"data": map[string]string{
+				"userId":  userId,
+				"message": "You are not waiting in a lobby",
+			},
+		}))
+		return nil
+	}
+	return err
+}
+
 func EndGame(ctx context.Context, taskPayload map[string]interface{}) error {
 	_, err := lib.Pool.Exec(ctx, `UPDATE public.games SET status = $2,  "winnerId" = $3 WHERE id = $1`, taskPayload["gameId"], "completed", taskPayload["winnerId"])
 	return err
 }
 
+// CollectEntry charges the players of a game that started. The game row is
+// locked so a refund either sees every entry collected or none. An aborted
+// game is not charged, start-game may still be queued behind this task so
+// a staging game is.
 func CollectEntry(ctx context.Context, taskPayload map[string]interface{}) error {
-	query := fmt.Sprintf(`UPDATE public.users SET "solanaBalance" = "solanaBalance" - $1 WHERE id IN (%s) AND "solanaBalance" >= $1`, taskPayload["ids"])
-	_, err := lib.Pool.Exec(ctx, query, taskPayload["entry"])
-	return err
+	entry := int(taskPayload["entry"].(float64))
+	gameId, _ := taskPayload["gameId"].(string)
+
+	tx, err := lib.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var status string
+	if err := tx.QueryRow(ctx, `SELECT status FROM public.games WHERE id = $1 FOR UPDATE`, gameId).Scan(&status); err != nil {
+		return err
+	}
+	if status == "aborted" {
+		return nil
+	}
+
+	query := fmt.Sprintf(`UPDATE public.users SET "solanaBalance" = "solanaBalance" - $1 WHERE id IN (%s) AND "solanaBalance" >= $1 RETURNING id, "solanaBalance"`, taskPayload["ids"])
+	events, err := balanceEvents(ctx, tx, "balance.entry", -entry, gameId, query, entry)
+	if err != nil {
+		return err
+	}
+	return commitBalanceChanges(ctx, tx, "entry", entry, events)
 }
 
 func UpdateBalance(ctx context.Context, taskPayload map[string]interface{}) error {
-	_, err := lib.Pool.Exec(ctx, `UPDATE public.users SET  "solanaBalance" = "solanaBalance"  + $2 WHERE id = $1`, taskPayload["winnerId"], taskPayload["amount"])
-	return err
+	amount := int(taskPayload["amount"].(float64))
+	gameId, _ := taskPayload["gameId"].(string)
+
+	tx, err := lib.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	events, err := balanceEvents(ctx, tx, "balance.prize", amount, gameId, `UPDATE public.users SET "solanaBalance" = "solanaBalance" + $2 WHERE id = $1 RETURNING id, "solanaBalance"`, taskPayload["winnerId"], amount)
+	if err != nil {
+		return err
+	}
+	return commitBalanceChanges(ctx, tx, "prize", amount, events)
+}
+
+// balanceEvents runs a balance update that returns (id, "solanaBalance")
+// and describes every changed row as an audit event.
+func balanceEvents(ctx context.Context, tx pgx.Tx, action string, delta int, gameId string, query string, args ...interface{}) ([]audit.Event, error) {
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []audit.Event{}
+	for rows.Next() {
+		var userId string
+		var balance int
+		if err := rows.Scan(&userId, &balance); err != nil {
+			return nil, err
+		}
+		event := audit.BalanceChange(action, userId, balance, delta)
+		if gameId != "" {
+			event.Details = map[string]interface{}{"gameId": gameId}
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// commitBalanceChanges writes the audit events in the same transaction as
+// the balance update, and counts the change once it is committed.
+func commitBalanceChanges(ctx context.Context, tx pgx.Tx, kind string, amount int, events []audit.Event) error {
+	for _, event := range events {
+		if err := audit.Record(ctx, tx, event); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	metrics.BalanceChanges.WithLabelValues(kind).Add(float64(len(events)))
+	metrics.BalanceAmount.WithLabelValues(kind).Add(float64(amount * len(events)))
+	return nil
+}
+
+// SettleGame marks an ongoing game completed and pays the winner in one
+// transaction. It reports false when the game was already settled or
+// aborted, so a payout never happens twice.
+func SettleGame(ctx context.Context, gameId string, winnerId string, amount int) (bool, error) {
+	tx, err := lib.Pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var gameTypeId string
+	err = tx.QueryRow(ctx, `UPDATE public.games SET status = $2, "winnerId" = $3, "updatedAt" = NOW() WHERE id = $1 AND status = $4 RETURNING "gameTypeId"`, gameId, "completed", winnerId, "ongoing").Scan(&gameTypeId)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	events, err := balanceEvents(ctx, tx, "balance.prize", amount, gameId, `UPDATE public.users SET "solanaBalance" = "solanaBalance" + $2 WHERE id = $1 RETURNING id, "solanaBalance"`, winnerId, amount)
+	if err != nil {
+		return false, err
+	}
+	if err := commitBalanceChanges(ctx, tx, "prize", amount, events); err != nil {
+		return false, err
+	}
+	metrics.GamesFinished.WithLabelValues(gameTypeId, "completed").Inc()
+	return true, nil
+}
+
+// RefundGame returns the entry fee to every participant of a game that
+// could not finish and paid for it, as recorded by CollectEntry. Flipping
+// the status first makes the refund happen at most once even if several
+// instances ask for it.
+func RefundGame(ctx context.Context, taskPayload map[string]interface{}) error {
+	gameId := taskPayload["gameId"].(string)
+	tx, err := lib.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var entryFee int
+	var gameTypeId string
+	err = tx.QueryRow(ctx, `UPDATE public.games SET status = $2, "updatedAt" = NOW() WHERE id = $1 AND status = $3 RETURNING "entryFee", "gameTypeId"`, gameId, "aborted", "ongoing").Scan(&entryFee, &gameTypeId)
+	if err == pgx.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	events, err := balanceEvents(ctx, tx, "balance.refund", entryFee, gameId, `UPDATE public.users SET "solanaBalance" = "solanaBalance" + $2 FROM public.participants p WHERE p."gameId" = $1 AND p."userId" = public.users.id
+		AND EXISTS (SELECT 1 FROM public.audit_logs a WHERE a."targetType" = 'user' AND a."targetId" = p."userId" AND a.action = 'balance.entry' AND a.details->>'gameId' = $1)
+		RETURNING public.users.id, public.users."solanaBalance"`, gameId, entryFee)
+	if err != nil {
+		return err
+	}
+	if err := commitBalanceChanges(ctx, tx, "refund", entryFee, events); err != nil {
+		return err
+	}
+	metrics.GamesFinished.WithLabelValues(gameTypeId, "aborted").Inc()
+
+	refunded := []string{}
+	for _, event := range events {
+		refunded = append(refunded, fmt.Sprintf("mr-balance-%s", event.TargetId))
+	}
+	if len(refunded) > 0 {
+		GetInstance().RedisClient.Del(ctx, refunded...)
+	}
+	return nil
 }
@@ -0,0 +1,82 @@
+package gameManager
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRetryFailedTasksRequeuesOnlyTimedOutTasks(t *testing.T) {
+	gameManager, _ := newTestManager(t)
+	ctx := context.Background()
+	queue := &gameManager.DbQueue
+
+	for _, task := range []string{"save-replay", "record-scores"} {
+		if err := queue.Enqueue(ctx, map[string]interface{}{"type": task, "data": map[string]interface{}{}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stale, err := queue.Dequeue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh, err := queue.Dequeue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * queue.timeout).UnixMilli()
+	queue.client.HSet(ctx, queue.claimedKey(), stale, strconv.FormatInt(old, 10))
+
+	if err := queue.RetryFailedTasks(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	waiting, _ := queue.client.LRange(ctx, queue.queueName, 0, -1).Result()
+	if len(waiting) != 1 || waiting[0] != stale {
+		t.Errorf("queue = %v, want only the timed out task", waiting)
+	}
+	processing, _ := queue.client.LRange(ctx, queue.processingKey, 0, -1).Result()
+	if len(processing) != 1 || processing[0] != fresh {
+		t.Errorf("processing = %v, want only the running task", processing)
+	}
+	if exists, _ := queue.client.HExists(ctx, queue.claimedKey(), stale).Result(); exists {
+		t.Error("claim of the requeued task was kept")
+	}
+}
+
+func TestRetryFailedTasksStartsClockForUnclaimedTasks(t *testing.T) {
+	gameManager, _ := newTestManager(t)
+	ctx := context.Background()
+	queue := &gameManager.DbQueue
+
+	// A task the worker moved to the processing list without recording when.
+	queue.client.LPush(ctx, queue.processingKey, `{"type":"save-replay"}`)
+	if err := queue.RetryFailedTasks(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if waiting, _ := queue.client.LLen(ctx, queue.queueName).Result(); waiting != 0 {
+		t.Fatalf("unclaimed task requeued right away")
+	}
+	if exists, _ := queue.client.HExists(ctx, queue.claimedKey(), `{"type":"save-replay"}`).Result(); !exists {
+		t.Fatal("no claim recorded for the unclaimed task")
+	}
+}
+
+func TestAcknowledgeForgetsClaim(t *testing.T) {
+	gameManager, _ := newTestManager(t)
+	ctx := context.Background()
+	queue := &gameManager.DbQueue
+
+	queue.Enqueue(ctx, map[string]interface{}{"type": "save-replay", "data": map[string]interface{}{}})
+	item, err := queue.Dequeue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := queue.Acknowledge(ctx, item); err != nil {
+		t.Fatal(err)
+	}
+	if claims, _ := queue.client.HLen(ctx, queue.claimedKey()).Result(); claims != 0 {
+		t.Errorf("%d claims left after acknowledging", claims)
+	}
+}
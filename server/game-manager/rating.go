@@ -0,0 +1,177 @@
+package gameManager
+
+import (
+	"context"
+	"flappy-bird-server/lib"
+	"log/slog"
+	"math"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultRating is where every player starts in a game type.
+const DefaultRating = 1500.0
+
+// RatingK is the most a player can gain or lose in a single game.
+const RatingK = 32.0
+
+// GetRating returns the player's rating for a game type, DefaultRating if
+// they have not finished a game of that type yet.
+func (gameManager *GameManager) GetRating(ctx context.Context, userId string, gameTypeId string) (float64, error) {
+	rating := DefaultRating
+	err := lib.Pool.QueryRow(ctx, `SELECT rating FROM public.ratings WHERE "userId" = $1 AND "gameTypeId" = $2`, userId, gameTypeId).Scan(&rating)
+	if err == pgx.ErrNoRows {
+		return DefaultRating, nil
+	}
+	return rating, err
+}
+
+// RatingChanges runs multiplayer Elo over the final standings: every pair of
+// players is scored as a win, loss or draw by points, and each player's
+// change is the sum over their opponents scaled so a game is worth at most
+// RatingK regardless of its size.
+func RatingChanges(ratings map[string]float64, points map[string]int) map[string]float64 {
+	changes := make(map[string]float64, len(points))
+	if len(points) < 2 {
+		return changes
+	}
+	k := RatingK / float64(len(points)-1)
+	for userId, userPoints := range points {
+		change := 0.0
+		for opponentId, opponentPoints := range points {
+			if opponentId == userId {
+				continue
+			}
+			expected := 1 / (1 + math.Pow(10, (ratings[opponentId]-ratings[userId])/400))
+			actual := 0.5
+			if userPoints > opponentPoints {
+				actual = 1
+			} else if userPoints < opponentPoints {
+				actual = 0
+			}
+			change += k * (actual - expected)
+		}
+		changes[userId] = change
+	}
+	return changes
+}
+
+// UpdateRatings applies the result of a finished game to its players'
+// ratings. Games are marked as rated in the same transaction, so a retried
+// task never counts a game twice.
+func UpdateRatings(ctx context.Context, taskPayload map[string]interface{}) error {
+	gameId := taskPayload["gameId"].(string)
+	points := map[string]int{}
+	if standings, ok := taskPayload["points"].(map[string]interface{}); ok {
+		for userId, value := range standings {
+			userPoints, _ := value.(float64)
+			points[userId] = int(userPoints)
+		}
+	}
+
+	tx, err := lib.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var gameTypeId string
+	err = tx.QueryRow(ctx, `UPDATE public.games SET "ratedAt" = NOW() WHERE id = $1 AND "ratedAt" IS NULL RETURNING "gameTypeId"`, gameId).Scan(&gameTypeId)
+	if err == pgx.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	userIds := make([]string, 0, len(points))
+	ratings := make(map[string]float64, len(points))
+	for userId := range points {
+		userIds = append(userIds, userId)
+		ratings[userId] = DefaultRating
+	}
+	rows, err := tx.Query(ctx, `SELECT "userId", rating FROM public.ratings WHERE "gameTypeId" = $1 AND "userId" = ANY($2) FOR UPDATE`, gameTypeId, userIds)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var userId string
+		var rating float64
+		if err := rows.Scan(&userId, &rating); err != nil {
+			rows.Close()
+			return err
+		}
+		ratings[userId] = rating
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for userId, change := range RatingChanges(ratings, points) {
+		_, err := tx.Exec(ctx, `INSERT INTO public.ratings ("userId", "gameTypeId", rating, "gamesPlayed", "updatedAt") VALUES ($1, $2, $3, 1, NOW())
+		ON CONFLICT ("userId", "gameTypeId") DO UPDATE SET rating = EXCLUDED.rating, "gamesPlayed" = public.ratings."gamesPlayed" + 1, "updatedAt" = NOW()`, userId, gameTypeId, ratings[userId]+change)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// enqueueRatingUpdate hands the final points of a finished public game to
+// the db queue. Private games between friends don't count. Ratings are not
+// money, so a failure is only logged.
+func (gameManager *GameManager) enqueueRatingUpdate(ctx context.Context, game *Game) {
+	if game.Private {
+		return
+	}
+	points := make(map[string]int, len(game.Users))
+	for userId := range game.Users {
+		points[userId] = game.ScoreBoard[userId].Points
+	}
+	err := gameManager.DbQueue.Enqueue(ctx, map[string]interface{}{
+		"type": "update-ratings",
+		"data": map[string]interface{}{
+			"gameId": game.Id,
+			"points": points,
+		},
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "error enqueuing rating update", "error", err)
+	}
+}
+
+// enqueueScores stores every player's final points with their participation
+// for match history, private games included.
+func (gameManager *GameManager) enqueueScores(ctx context.Context, game *Game) {
+	points := make(map[string]int, len(game.Users))
+	for userId := range game.Users {
+		points[userId] = game.ScoreBoard[userId].Points
+	}
+	err := gameManager.DbQueue.Enqueue(ctx, map[string]interface{}{
+		"type": "record-scores",
+		"data": map[string]interface{}{
+			"gameId": game.Id,
+			"points": points,
+		},
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "error enqueuing scores", "error", err)
+	}
+}
+
+// RecordScores writes the final points of a game to its participants.
+// Writing the same points twice is harmless, so retries need no guard.
+func RecordScores(ctx context.Context, taskPayload map[string]interface{}) error {
+	gameId := taskPayload["gameId"].(string)
+	standings, _ := taskPayload["points"].(map[string]interface{})
+	batch := &pgx.Batch{}
+	for userId, value := range standings {
+		points, _ := value.(float64)
+		batch.Queue(`UPDATE public.participants SET score = $3 WHERE "gameId" = $1 AND "userId" = $2`, gameId, userId, int(points))
+	}
+	if batch.Len() == 0 {
+		return nil
+	}
+	return lib.Pool.SendBatch(ctx, batch).Close()
+}
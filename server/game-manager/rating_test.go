@@ -0,0 +1,172 @@
+package gameManager
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRatingChanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		ratings map[string]float64
+		points  map[string]int
+		check   func(t *testing.T, changes map[string]float64)
+	}{
+		{
+			name:    "equal ratings, clear winner",
+			ratings: map[string]float64{"a": 1500, "b": 1500},
+			points:  map[string]int{"a": 5, "b": 2},
+			check: func(t *testing.T, changes map[string]float64) {
+				if changes["a"] != RatingK/2 || changes["b"] != -RatingK/2 {
+					t.Errorf("changes = %v, want ±%v", changes, RatingK/2)
+				}
+			},
+		},
+		{
+			name:    "draw between equals changes nothing",
+			ratings: map[string]float64{"a": 1500, "b": 1500, "c": 1500},
+			points:  map[string]int{"a": 0, "b": 0, "c": 0},
+			check: func(t *testing.T, changes map[string]float64) {
+				for userId, change := range changes {
+					if change != 0 {
+						t.Errorf("%s changed by %v in a draw between equals", userId, change)
+					}
+				}
+			},
+		},
+		{
+			name:    "draw moves the lower rated player up",
+			ratings: map[string]float64{"a": 1800, "b": 1400},
+			points:  map[string]int{"a": 3, "b": 3},
+			check: func(t *testing.T, changes map[string]float64) {
+				if changes["b"] <= 0 || changes["a"] >= 0 {
+					t.Errorf("changes = %v, want the underdog to gain", changes)
+				}
+			},
+		},
+		{
+			name:    "upset gains more than a favourite's win",
+			ratings: map[string]float64{"favourite": 1900, "underdog": 1300},
+			points:  map[string]int{"favourite": 1, "underdog": 4},
+			check: func(t *testing.T, changes map[string]float64) {
+				if changes["underdog"] <= RatingK/2 {
+					t.Errorf("underdog gained %v, want more than %v", changes["underdog"], RatingK/2)
+				}
+			},
+		},
+		{
+			name:    "K caps a big game",
+			ratings: map[string]float64{"a": 1000, "b": 2400, "c": 2400, "d": 2400, "e": 2400},
+			points:  map[string]int{"a": 9, "b": 0, "c": 0, "d": 0, "e": 0},
+			check: func(t *testing.T, changes map[string]float64) {
+				if changes["a"] > RatingK || changes["a"] < RatingK-1 {
+					t.Errorf("winner gained %v, want just under %v", changes["a"], RatingK)
+				}
+			},
+		},
+		{
+			name:    "a lone player is not rated",
+			ratings: map[string]float64{"a": 1500},
+			points:  map[string]int{"a": 4},
+			check: func(t *testing.T, changes map[string]float64) {
+				if len(changes) != 0 {
+					t.Errorf("changes = %v, want none", changes)
+				}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes := RatingChanges(test.ratings, test.points)
+			total := 0.0
+			for userId, change := range changes {
+				if math.Abs(change) > RatingK {
+					t.Errorf("%s changed by %v, more than K", userId, change)
+				}
+				total += change
+			}
+			if math.Abs(total) > 1e-9 {
+				t.Errorf("changes sum to %v, want zero", total)
+			}
+			test.check(t, changes)
+		})
+	}
+}
+
+func TestRatingBand(t *testing.T) {
+	gameManager, _ := newTestManager(t)
+	gameManager.Config.MatchmakingBand = 100
+	gameManager.Config.MatchmakingBandGrowth = 200
+	gameManager.Config.MatchmakingMaxBand = 1000
+
+	tests := []struct {
+		waited time.Duration
+		want   float64
+	}{
+		{0, 100},
+		{30 * time.Second, 200},
+		{2 * time.Minute, 500},
+		{4*time.Minute + 30*time.Second, 1000},
+		{time.Hour, 1000},
+	}
+	for _, test := range tests {
+		if got := gameManager.RatingBand(test.waited); got != test.want {
+			t.Errorf("RatingBand(%v) = %v, want %v", test.waited, got, test.want)
+		}
+	}
+}
+
+// queuedTasks returns the payloads of the queued tasks of one type.
+func queuedTasks(t *testing.T, queue *Queue, taskType string) []map[string]interface{} {
+	t.Helper()
+	items, err := queue.client.LRange(context.Background(), queue.queueName, 0, -1).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	payloads := []map[string]interface{}{}
+	for _, item := range items {
+		var task struct {
+			Type string                 `json:"type"`
+			Data map[string]interface{} `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(item), &task); err != nil {
+			t.Fatal(err)
+		}
+		if task.Type == taskType {
+			payloads = append(payloads, task.Data)
+		}
+	}
+	return payloads
+}
+
+func TestGameOverRatesEveryFinishedGameOnce(t *testing.T) {
+	first, _ := newTestManager(t)
+	second := managerOn(first.RedisClient)
+
+	// Nobody scored and no player is connected to either instance.
+	for _, instance := range []*GameManager{first, second} {
+		instance.SetGame(ongoingGame("scoreless", "a", "b"))
+		instance.GameOver("scoreless", "a")
+		instance.GameOver("scoreless", "b")
+	}
+
+	updates := queuedTasks(t, &first.DbQueue, "update-ratings")
+	if len(updates) != 1 {
+		t.Fatalf("%d rating updates enqueued, want 1", len(updates))
+	}
+	points, _ := updates[0]["points"].(map[string]interface{})
+	if len(points) != 2 {
+		t.Errorf("points = %v, want both players", points)
+	}
+	if scores := queuedTasks(t, &first.DbQueue, "record-scores"); len(scores) != 1 {
+		t.Errorf("%d score records enqueued, want 1", len(scores))
+	}
+	if _, err := first.RedisClient.ZScore(context.Background(), leaderboardKey("type", "alltime", "winnings"), "a").Result(); err != redis.Nil {
+		t.Errorf("scoreless game counted on the winnings board (%v)", err)
+	}
+}
@@ -0,0 +1,119 @@
+package gameManager
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"flappy-bird-server/lib"
+	"flappy-bird-server/replay"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// While a game runs its replay log is appended to a Redis list, so every
+// instance writes to the same log in the order Redis sees the events. Once
+// the game is over the log is moved to the replays table.
+func replayKey(gameId string) string {
+	return fmt.Sprintf("mr-replay-%s", gameId)
+}
+
+func replayClosedKey(gameId string) string {
+	return fmt.Sprintf("mr-replay-%s-closed", gameId)
+}
+
+func (gameManager *GameManager) appendReplay(ctx context.Context, gameId string, event replay.Event) {
+	event.At = time.Now().UnixMilli()
+	pipe := gameManager.RedisClient.TxPipeline()
+	pipe.RPush(ctx, replayKey(gameId), replay.Encode(event))
+	pipe.Expire(ctx, replayKey(gameId), gameSnapshotTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		slog.WarnContext(ctx, "error recording replay event", "gameId", gameId, "type", event.Type, "error", err)
+	}
+}
+
+func (gameManager *GameManager) startReplay(ctx context.Context, game Game) {
+	gameManager.appendReplay(ctx, game.Id, replay.Event{
+		Type:  replay.Start,
+		Seed:  game.Seed,
+		Users: lobbyUserIds(game),
+	})
+}
+
+// RecordInput logs a message a player sent about their own game.
+func (gameManager *GameManager) RecordInput(ctx context.Context, gameId string, userId string, input string) {
+	gameManager.appendReplay(ctx, gameId, replay.Event{
+		Type:   replay.Input,
+		UserId: userId,
+		Input:  input,
+	})
+}
+
+// closeReplay ends the log of a game and hands it to the db queue. Every
+// instance of a player sees the end, only the first one closes the log.
+func (gameManager *GameManager) closeReplay(ctx context.Context, gameId string, reason string, winnerId string) {
+	if exists, err := gameManager.RedisClient.Exists(ctx, replayKey(gameId)).Result(); err != nil || exists == 0 {
+		return
+	}
+	closed, err := gameManager.RedisClient.SetNX(ctx, replayClosedKey(gameId), reason, gameSnapshotTTL).Result()
+	if err != nil || !closed {
+		return
+	}
+	gameManager.appendReplay(ctx, gameId, replay.Event{
+		Type:     replay.End,
+		WinnerId: winnerId,
+		Reason:   reason,
+	})
+	err = gameManager.DbQueue.Enqueue(ctx, map[string]interface{}{
+		"type": "save-replay",
+		"data": map[string]interface{}{
+			"gameId": gameId,
+		},
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "error enqueuing replay", "gameId", gameId, "error", err)
+	}
+}
+
+// SaveReplay stores the gzipped log of a finished game and drops it from
+// Redis. A retried task leaves the stored replay alone.
+func SaveReplay(ctx context.Context, taskPayload map[string]interface{}) error {
+	gameId, ok := taskPayload["gameId"].(string)
+	if !ok {
+		return errors.New("save-replay without gameId")
+	}
+	client := GetInstance().RedisClient
+	lines, err := client.LRange(ctx, replayKey(gameId), 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	log := strings.Join(lines, "\n") + "\n"
+	events, err := replay.Decode(strings.NewReader(log))
+	if err != nil {
+		return err
+	}
+	var seed int64
+	if len(events) > 0 && events[0].Type == replay.Start {
+		seed = events[0].Seed
+	}
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write([]byte(log)); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	_, err = lib.Pool.Exec(ctx, `INSERT INTO public.replays ("gameId", seed, events, log) VALUES ($1, $2, $3, $4) ON CONFLICT ("gameId") DO NOTHING`, gameId, seed, len(events), compressed.Bytes())
+	if err != nil {
+		return err
+	}
+	return client.Del(ctx, replayKey(gameId)).Err()
+}
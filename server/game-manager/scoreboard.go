@@ -0,0 +1,90 @@
+package gameManager
+
+import (
+	"context"
+	"time"
+)
+
+// markScoreboard flags a local game whose scoreboard changed since the last
+// broadcast.
+func (gameManager *GameManager) markScoreboard(gameId string) {
+	gameManager.scoreboardsMu.Lock()
+	defer gameManager.scoreboardsMu.Unlock()
+	if gameManager.dirtyScoreboards == nil {
+		gameManager.dirtyScoreboards = map[string]bool{}
+	}
+	gameManager.dirtyScoreboards[gameId] = true
+}
+
+func (gameManager *GameManager) takeDirtyScoreboards() []string {
+	gameManager.scoreboardsMu.Lock()
+	defer gameManager.scoreboardsMu.Unlock()
+	gameIds := make([]string, 0, len(gameManager.dirtyScoreboards))
+	for gameId := range gameManager.dirtyScoreboards {
+		gameIds = append(gameIds, gameId)
+	}
+	gameManager.dirtyScoreboards = nil
+	return gameIds
+}
+
+// Scoreboard lists every player's points and whether they are still alive.
+func Scoreboard(game *Game) []map[string]interface{} {
+	players := make([]map[string]interface{}, 0, len(game.ScoreBoard))
+	for userId, score := range game.ScoreBoard {
+		players = append(players, map[string]interface{}{
+			"userId":  userId,
+			"points":  score.Points,
+			"isAlive": score.IsAlive,
+		})
+	}
+	return players
+}
+
+// liveScoreboard reads a local game's scoreboard under the games lock, the
+// pub/sub handler of the game may be writing to it.
+func (gameManager *GameManager) liveScoreboard(gameId string) ([]map[string]interface{}, bool) {
+	gameManager.gamesMu.RLock()
+	defer gameManager.gamesMu.RUnlock()
+	game, exist := gameManager.StartedGames[gameId]
+	if !exist || game.Status != "ongoing" {
+		return nil, false
+	}
+	return Scoreboard(&game), true
+}
+
+// BroadcastScoreboards sends the scoreboard of every local game that changed
+// to its local players, at most once per SCOREBOARD_INTERVAL so a burst of
+// points doesn't turn into a burst of frames. Each instance holds its own
+// copy of the game, so every player is served by their own instance.
+func (gameManager *GameManager) BroadcastScoreboards(ctx context.Context) {
+	ticker := time.NewTicker(gameManager.Config.ScoreboardInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, gameId := range gameManager.takeDirtyScoreboards() {
+				players, ongoing := gameManager.liveScoreboard(gameId)
+				if !ongoing {
+					continue
+				}
+				gameManager.SendLocal(gameId, "scoreboard", map[string]interface{}{
+					"gameId":  gameId,
+					"players": players,
+				})
+			}
+		}
+	}
+}
+
+// sendElimination tells the local players right away that someone is out,
+// together with the scoreboard at that moment.
+func (gameManager *GameManager) sendElimination(game *Game, userId string) {
+	gameManager.SendLocal(game.Id, "eliminated", map[string]interface{}{
+		"gameId":  game.Id,
+		"userId":  userId,
+		"points":  game.ScoreBoard[userId].Points,
+		"players": Scoreboard(game),
+	})
+}
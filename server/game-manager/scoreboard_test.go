@@ -0,0 +1,36 @@
+package gameManager
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBroadcastScoreboardsWhilePlayersComeAndGo(t *testing.T) {
+	gameManager, _ := newTestManager(t)
+	gameManager.Config.ScoreboardInterval = time.Millisecond
+
+	conn := connectUser(t, gameManager, "player")
+	gameManager.SetCurrentGame("player", "game")
+	gameManager.SetGame(ongoingGame("game", "player"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go gameManager.BroadcastScoreboards(ctx)
+
+	// Players joining and leaving other games write to the users map while
+	// the ticker walks it.
+	for i := 0; i < 200; i++ {
+		userId := fmt.Sprintf("other-%d", i)
+		gameManager.SetUser(User{Id: userId})
+		gameManager.SetCurrentGame(userId, "other-game")
+		gameManager.markScoreboard("game")
+		gameManager.RemoveUser(userId)
+	}
+
+	types := readMessageTypes(t, conn)
+	if len(types) == 0 || types[0] != "scoreboard" {
+		t.Fatalf("player got %v, want scoreboard frames", types)
+	}
+}
@@ -0,0 +1,220 @@
+package gameManager
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flappy-bird-server/lib"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrInvalidSession = errors.New("session expired, please sign in again")
+
+// A session token lets a player whose socket dropped take their seat back,
+// on whichever instance they reconnect to.
+func sessionKey(token string) string {
+	return fmt.Sprintf("mr-session-%s", token)
+}
+
+// A held seat records the game or lobby of a disconnected player until they
+// resume or the grace period runs out, whichever deletes it first.
+func heldSeatKey(userId string) string {
+	return fmt.Sprintf("mr-held-%s", userId)
+}
+
+type session struct {
+	UserId    string `json:"userId"`
+	PublicKey string `json:"publicKey"`
+}
+
+// IssueSession creates a resume token for a newly added player and sends it
+// to them.
+func (gameManager *GameManager) IssueSession(ctx context.Context, user User) error {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(raw)
+	payload, err := json.Marshal(session{UserId: user.Id, PublicKey: user.PublicKey})
+	if err != nil {
+		return err
+	}
+	if err := gameManager.RedisClient.Set(ctx, sessionKey(token), string(payload), gameManager.Config.SessionTTL).Err(); err != nil {
+		return err
+	}
+	user.SendMessage("session", map[string]interface{}{
+		"token":       token,
+		"gracePeriod": int(gameManager.Config.ReconnectGrace.Seconds()),
+	})
+	return nil
+}
+
+// seat tells whether a player still has something to come back to: "game"
+// when they are alive in a running game, "lobby" when they wait in it.
+func (gameManager *GameManager) seat(ctx context.Context, userId string, gameId string) string {
+	if gameId == "" {
+		return ""
+	}
+	if snapshot, err := gameManager.GameSnapshot(ctx, gameId); err == nil {
+		if snapshot.ScoreBoard[userId].IsAlive {
+			return "game"
+		}
+		return ""
+	}
+	if _, lobbyId, waiting := gameManager.UserLobby(ctx, userId); waiting && lobbyId == gameId {
+		return "lobby"
+	}
+	return ""
+}
+
+// Disconnect forgets a closed socket. A player in a running game or a lobby
+// keeps their seat for RECONNECT_GRACE before they are eliminated or leave
+// the lobby, so a short network drop doesn't forfeit the entry.
+func (gameManager *GameManager) Disconnect(ctx context.Context, conn *websocket.Conn) {
+	userId, exist := gameManager.ConnectionUser(conn)
+	if !exist {
+		return
+	}
+	gameManager.UnbindConnection(conn)
+	user, exist := gameManager.GetUser(userId)
+	if exist && user.Ws != conn {
+		// The player already resumed on a new socket.
+		return
+	}
+	if !exist || gameManager.IsDraining() {
+		gameManager.DeleteUser(userId)
+		return
+	}
+
+	gameId := user.CurrentGameId
+	if gameId == "" {
+		if _, lobbyId, waiting := gameManager.UserLobby(ctx, userId); waiting {
+			gameId = lobbyId
+		}
+	}
+	if gameManager.seat(ctx, userId, gameId) == "" {
+		gameManager.DeleteUser(userId)
+		return
+	}
+	grace := gameManager.Config.ReconnectGrace
+	if err := gameManager.RedisClient.Set(ctx, heldSeatKey(userId), gameId, 2*grace).Err(); err != nil {
+		slog.WarnContext(ctx, "error holding seat", "userId", userId, "gameId", gameId, "error", err)
+		gameManager.DeleteUser(userId)
+		return
+	}
+	gameManager.removeUserOn(userId, conn)
+	slog.InfoContext(ctx, "holding seat of disconnected player", "userId", userId, "gameId", gameId, "grace", grace)
+	time.AfterFunc(grace, func() {
+		gameManager.releaseSeat(lib.WithLogAttrs(gameManager.Context, "userId", userId, "gameId", gameId), userId, gameId)
+	})
+}
+
+// releaseSeat gives up the seat of a player who did not come back in time,
+// through the same messages a game over or a leave-lobby would send.
+func (gameManager *GameManager) releaseSeat(ctx context.Context, userId string, gameId string) {
+	deleted, err := gameManager.RedisClient.Del(ctx, heldSeatKey(userId)).Result()
+	if err != nil || deleted == 0 {
+		return
+	}
+	slog.InfoContext(ctx, "grace period over, releasing seat")
+	switch gameManager.seat(ctx, userId, gameId) {
+	case "game":
+		gameManager.RedisClient.Publish(ctx, gameId, lib.Stringify(map[string]interface{}{
+			"type": "game-over",
+			"data": map[string]interface{}{
+				"userId": userId,
+				"gameId": gameId,
+			},
+		}))
+	case "lobby":
+		gameManager.GameQueue.Enqueue(ctx, map[string]interface{}{
+			"type": "leave-lobby",
+			"data": map[string]interface{}{
+				"userId": userId,
+			},
+		})
+	}
+}
+
+// Resume binds a new socket to the player owning the session token and
+// sends them the state of the game or lobby they were in.
+func (gameManager *GameManager) Resume(ctx context.Context, conn *websocket.Conn, token string) error {
+	payload, err := gameManager.RedisClient.Get(ctx, sessionKey(token)).Result()
+	if err != nil {
+		return ErrInvalidSession
+	}
+	var resumed session
+	if err := Parse(payload, &resumed); err != nil {
+		return ErrInvalidSession
+	}
+	userId := resumed.UserId
+	gameManager.RedisClient.Expire(ctx, sessionKey(token), gameManager.Config.SessionTTL)
+
+	gameId, err := gameManager.RedisClient.GetDel(ctx, heldSeatKey(userId)).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+	if previous, exist := gameManager.GetUser(userId); exist {
+		gameManager.UnbindConnection(previous.Ws)
+		if gameId == "" {
+			gameId = previous.CurrentGameId
+		}
+	}
+
+	kind := gameManager.seat(ctx, userId, gameId)
+	if kind == "" {
+		gameId = ""
+	}
+	user := User{
+		Id:            userId,
+		CurrentGameId: gameId,
+		PublicKey:     resumed.PublicKey,
+		Ws:            conn,
+	}
+	gameManager.BindConnection(conn, userId)
+	gameManager.SetUser(user)
+
+	state := map[string]interface{}{
+		"token":  token,
+		"gameId": gameId,
+	}
+	switch kind {
+	case "game":
+		if _, local := gameManager.GetGame(gameId); !local {
+			snapshot, err := gameManager.GameSnapshot(ctx, gameId)
+			if err != nil {
+				return err
+			}
+			gameManager.SetGame(snapshot)
+		}
+		players, _ := gameManager.liveScoreboard(gameId)
+		state["status"] = "ongoing"
+		state["players"] = players
+	case "lobby":
+		gameTypeId, _, _ := gameManager.UserLobby(ctx, userId)
+		lobby, err := gameManager.GetLobby(ctx, gameTypeId, gameId)
+		if err != nil {
+			return err
+		}
+		gameType, err := gameManager.GetGameType(gameTypeId)
+		if err != nil {
+			return err
+		}
+		state["status"] = "staging"
+		state["lobby"] = LobbyStatus(lobby, gameType, time.Now())
+	}
+	if gameId != "" {
+		gameManager.subscribe(gameId)
+	}
+
+	slog.InfoContext(ctx, "session resumed", "userId", userId, "gameId", gameId)
+	user.SendMessage("resumed", state)
+	return nil
+}
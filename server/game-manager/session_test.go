@@ -0,0 +1,28 @@
+package gameManager
+
+import (
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSigningInAgainSignsTheOldSocketOut(t *testing.T) {
+	gameManager, _ := newTestManager(t)
+	gameManager.SetGame(ongoingGame("game", "player"))
+
+	sockets := []*websocket.Conn{}
+	for i := 0; i < 2; i++ {
+		dial(t, func(conn *websocket.Conn) {
+			gameManager.AddUser("player", "", conn)
+			gameManager.SetCurrentGame("player", "game")
+			sockets = append(sockets, conn)
+		})
+	}
+
+	if gameManager.IsPlayer(sockets[0], "player", "game") {
+		t.Error("old socket still plays for the player")
+	}
+	if !gameManager.IsPlayer(sockets[1], "player", "game") {
+		t.Error("new socket doesn't play for the player")
+	}
+}
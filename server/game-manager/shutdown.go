@@ -0,0 +1,140 @@
+package gameManager
+
+import (
+	"context"
+	"flappy-bird-server/lib"
+	"log/slog"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const shutdownPollInterval = 100 * time.Millisecond
+
+func (gameManager *GameManager) IsDraining() bool {
+	return gameManager.draining.Load()
+}
+
+// Shutdown stops the instance in order: refuse new joins, tell connected
+// players, give running games until ctx is done to finish, refund the ones
+// that didn't, then let the queue workers drain and exit.
+func (gameManager *GameManager) Shutdown(ctx context.Context) {
+	gameManager.draining.Store(true)
+	gameManager.broadcastLocal("server-shutdown", map[string]interface{}{
+		"message": "Server is restarting, running games will finish before it goes down",
+	})
+
+	for _, game := range gameManager.waitForGames(ctx) {
+		slog.Warn("game did not finish before shutdown, refunding entries", "gameId", game.Id, "gameTypeId", game.GameTypeId)
+		gameManager.abortGame(game)
+	}
+
+	gameManager.closeConnections()
+	gameManager.stopQueues()
+}
+
+// waitForGames blocks until no game is ongoing on this instance or ctx is
+// done, and returns the games that are still running.
+func (gameManager *GameManager) waitForGames(ctx context.Context) []Game {
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		ongoing := []Game{}
+		for _, game := range gameManager.ListGames() {
+			if game.Status == "ongoing" {
+				ongoing = append(ongoing, game)
+			}
+		}
+		if len(ongoing) == 0 {
+			return ongoing
+		}
+
+		select {
+		case <-ctx.Done():
+			return ongoing
+		case <-ticker.C:
+		}
+	}
+}
+
+// abortGame refunds every participant and tells all instances to drop the
+// game. RefundGame only pays out once, however many instances ask for it.
+func (gameManager *GameManager) abortGame(game Game) {
+	ctx := lib.WithLogAttrs(gameManager.Context, "gameId", game.Id)
+	refund := map[string]interface{}{
+		"gameId": game.Id,
+	}
+	err := gameManager.DbQueue.Enqueue(ctx, map[string]interface{}{
+		"type": "refund-game",
+		"data": refund,
+	})
+	if err != nil {
+		RecordFailedOperation(ctx, "refund-game", refund, "shutdown", err)
+	}
+	gameManager.closeReplay(ctx, game.Id, "aborted", "")
+
+	gameManager.RedisClient.Publish(gameManager.Context, game.Id, lib.Stringify(map[string]interface{}{
+		"type": "game-aborted",
+		"data": map[string]interface{}{
+			"gameId": game.Id,
+		},
+	}))
+	gameManager.AbortLocalGame(game.Id)
+}
+
+// AbortLocalGame tells the local participants that their game was cancelled
+// and forgets it. The refund itself is handled by the refund-game task.
+// Players still waiting in a lobby aren't in StartedGames on every instance,
+// so they are found through their CurrentGameId.
+func (gameManager *GameManager) AbortLocalGame(gameId string) {
+	entry := 0
+	participants := map[string]bool{}
+	if targetGame, exist := gameManager.GetGame(gameId); exist {
+		entry = targetGame.Entry
+		for userId := range targetGame.Users {
+			participants[userId] = true
+		}
+	}
+	gameManager.RangeUsers(func(user User) {
+		if user.CurrentGameId == gameId {
+			participants[user.Id] = true
+		}
+	})
+
+	for userId := range participants {
+		participant, exist := gameManager.GetUser(userId)
+		if exist {
+			participant.SendMessage("game-aborted", map[string]interface{}{
+				"gameId": gameId,
+				"amount": entry,
+			})
+			gameManager.SetCurrentGame(userId, "")
+		}
+	}
+	gameManager.DeleteGame(gameId)
+}
+
+func (gameManager *GameManager) closeConnections() {
+	deadline := time.Now().Add(time.Second)
+	message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	// Websocket goroutines keep running until their socket closes, so the
+	// connections are copied out of the map first.
+	gameManager.usersMu.RLock()
+	connections := make(map[*websocket.Conn]string, len(gameManager.UserConnectionMap))
+	for conn, userId := range gameManager.UserConnectionMap {
+		connections[conn] = userId
+	}
+	gameManager.usersMu.RUnlock()
+	for conn, userId := range connections {
+		if err := conn.WriteControl(websocket.CloseMessage, message, deadline); err != nil {
+			slog.Warn("error closing connection", "userId", userId, "error", err)
+		}
+	}
+}
+
+func (gameManager *GameManager) stopQueues() {
+	if gameManager.queueCancel != nil {
+		gameManager.queueCancel()
+	}
+	gameManager.queueWorkers.Wait()
+}
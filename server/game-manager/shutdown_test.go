@@ -0,0 +1,201 @@
+package gameManager
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestManager(t *testing.T) (*GameManager, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return managerOn(client), server
+}
+
+// managerOn builds a manager on an existing Redis, several of them stand in
+// for instances sharing it.
+func managerOn(client *redis.Client) *GameManager {
+	return &GameManager{
+		UserConnectionMap: make(map[*websocket.Conn]string),
+		Users:             make(map[string]User),
+		StartedGames:      map[string]Game{},
+		DbQueue: Queue{
+			client:        client,
+			queueName:     "mari-arena-db-queue",
+			processingKey: "mari-arena-db-queue:processing",
+			timeout:       time.Second,
+		},
+		GameQueue: Queue{
+			client:        client,
+			queueName:     "mari-arena-queue",
+			processingKey: "mari-arena-queue:processing",
+			timeout:       time.Second,
+		},
+		RedisClient: client,
+		Context:     context.Background(),
+	}
+}
+
+// connectUser registers userId on the manager with a real websocket and
+// returns the client side of it.
+func connectUser(t *testing.T, gameManager *GameManager, userId string) *websocket.Conn {
+	t.Helper()
+	return dial(t, func(conn *websocket.Conn) {
+		gameManager.BindConnection(conn, userId)
+		gameManager.SetUser(User{Id: userId, Ws: conn})
+	})
+}
+
+// dial opens a real websocket, hands the server side to register and
+// returns the client side.
+func dial(t *testing.T, register func(conn *websocket.Conn)) *websocket.Conn {
+	t.Helper()
+	registered := make(chan struct{})
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		register(conn)
+		close(registered)
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	<-registered
+	return conn
+}
+
+func readMessageTypes(t *testing.T, conn *websocket.Conn) []string {
+	t.Helper()
+	types := []string{}
+	for {
+		conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+		_, payload, err := conn.ReadMessage()
+		if err != nil {
+			return types
+		}
+		var message map[string]interface{}
+		if err := json.Unmarshal(payload, &message); err != nil {
+			t.Fatalf("invalid message %s: %v", payload, err)
+		}
+		types = append(types, message["type"].(string))
+	}
+}
+
+func ongoingGame(id string, users ...string) Game {
+	game := Game{
+		Id:           id,
+		GameTypeId:   "type",
+		MaxUserCount: len(users),
+		Entry:        10,
+		WinnerPrice:  18,
+		Users:        map[string]bool{},
+		Status:       "ongoing",
+		ScoreBoard:   map[string]Score{},
+	}
+	for _, userId := range users {
+		game.Users[userId] = true
+		game.ScoreBoard[userId] = Score{IsAlive: true}
+	}
+	game.CurrentUserCount = len(users)
+	return game
+}
+
+func TestShutdownRefundsGamesThatDoNotFinish(t *testing.T) {
+	gameManager, server := newTestManager(t)
+
+	finishingConn := connectUser(t, gameManager, "finishing-user")
+	stuckConn := connectUser(t, gameManager, "stuck-user")
+	gameManager.SetGame(ongoingGame("finishing-game", "finishing-user"))
+	gameManager.SetGame(ongoingGame("stuck-game", "stuck-user"))
+
+	workerCtx, workerCancel := context.WithCancel(context.Background())
+	gameManager.queueCancel = workerCancel
+	workerStopped := false
+	gameManager.queueWorkers.Add(1)
+	go func() {
+		defer gameManager.queueWorkers.Done()
+		<-workerCtx.Done()
+		workerStopped = true
+	}()
+
+	go func() {
+		time.Sleep(2 * shutdownPollInterval)
+		gameManager.DeleteGame("finishing-game")
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*shutdownPollInterval)
+	defer cancel()
+	gameManager.Shutdown(ctx)
+
+	if !gameManager.IsDraining() {
+		t.Fatal("expected manager to refuse new joins after shutdown")
+	}
+	if !workerStopped {
+		t.Fatal("expected queue workers to be stopped and awaited")
+	}
+	if games := gameManager.ListGames(); len(games) != 0 {
+		t.Fatalf("expected no games left in memory, got %d", len(games))
+	}
+
+	items, err := server.List("mari-arena-db-queue")
+	if err != nil {
+		t.Fatalf("reading db queue: %v", err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("expected exactly one refund task, got %v", items)
+	}
+	var task map[string]interface{}
+	if err := json.Unmarshal([]byte(items[0]), &task); err != nil {
+		t.Fatalf("invalid task: %v", err)
+	}
+	if task["type"] != "refund-game" || task["data"].(map[string]interface{})["gameId"] != "stuck-game" {
+		t.Fatalf("unexpected task %v", task)
+	}
+
+	if got := readMessageTypes(t, finishingConn); len(got) != 1 || got[0] != "server-shutdown" {
+		t.Fatalf("finishing player got %v, want [server-shutdown]", got)
+	}
+	if got := readMessageTypes(t, stuckConn); len(got) != 2 || got[0] != "server-shutdown" || got[1] != "game-aborted" {
+		t.Fatalf("stuck player got %v, want [server-shutdown game-aborted]", got)
+	}
+}
+
+func TestShutdownReturnsAsSoonAsGamesFinish(t *testing.T) {
+	gameManager, server := newTestManager(t)
+	gameManager.SetGame(ongoingGame("game", "user"))
+
+	go func() {
+		time.Sleep(shutdownPollInterval)
+		gameManager.DeleteGame("game")
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	start := time.Now()
+	gameManager.Shutdown(ctx)
+
+	if elapsed := time.Since(start); elapsed > 10*shutdownPollInterval {
+		t.Fatalf("shutdown waited %s after the last game finished", elapsed)
+	}
+	if server.Exists("mari-arena-db-queue") {
+		t.Fatal("expected no refund for a game that finished")
+	}
+}
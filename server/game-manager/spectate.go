@@ -0,0 +1,312 @@
+package gameManager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flappy-bird-server/lib"
+	"flappy-bird-server/replay"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// gameSnapshotTTL bounds how long the Redis copy of a running game is kept,
+// well past any real game.
+const gameSnapshotTTL = 2 * time.Hour
+
+var ErrGameNotLive = errors.New("game is not being played")
+var ErrSpectatorLimit = errors.New("this game has reached its spectator limit")
+
+// A running game only lives in the memory of the instances its players are
+// connected to. Spectators can be anywhere, so the game is mirrored in
+// Redis: the game as it started, the points scored since and who is out.
+func gameSnapshotKey(gameId string) string {
+	return fmt.Sprintf("mr-game-%s", gameId)
+}
+
+func gameScoresKey(gameId string) string {
+	return fmt.Sprintf("mr-game-%s-scores", gameId)
+}
+
+func gameEliminatedKey(gameId string) string {
+	return fmt.Sprintf("mr-game-%s-eliminated", gameId)
+}
+
+func spectatorCountKey(gameId string) string {
+	return fmt.Sprintf("mr-spectators-%s", gameId)
+}
+
+type spectatedGame struct {
+	game  Game
+	conns map[*websocket.Conn]bool
+}
+
+func (gameManager *GameManager) saveGameSnapshot(ctx context.Context, game Game) error {
+	game.Status = "ongoing"
+	payload, err := json.Marshal(game)
+	if err != nil {
+		return err
+	}
+	return gameManager.RedisClient.Set(ctx, gameSnapshotKey(game.Id), string(payload), gameSnapshotTTL).Err()
+}
+
+// RecordScore mirrors a point scored by a live player of a local game.
+func (gameManager *GameManager) RecordScore(ctx context.Context, gameId string, userId string) {
+	if game, exist := gameManager.GetGame(gameId); !exist || !game.ScoreBoard[userId].IsAlive {
+		return
+	}
+	pipe := gameManager.RedisClient.TxPipeline()
+	points := pipe.HIncrBy(ctx, gameScoresKey(gameId), userId, 1)
+	pipe.Expire(ctx, gameScoresKey(gameId), gameSnapshotTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		slog.WarnContext(ctx, "error recording score", "gameId", gameId, "userId", userId, "error", err)
+		return
+	}
+	gameManager.appendReplay(ctx, gameId, replay.Event{
+		Type:   replay.Score,
+		UserId: userId,
+		Points: int(points.Val()),
+	})
+}
+
+func (gameManager *GameManager) recordElimination(ctx context.Context, gameId string, userId string) {
+	pipe := gameManager.RedisClient.TxPipeline()
+	added := pipe.SAdd(ctx, gameEliminatedKey(gameId), userId)
+	pipe.Expire(ctx, gameEliminatedKey(gameId), gameSnapshotTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		slog.WarnContext(ctx, "error recording elimination", "gameId", gameId, "userId", userId, "error", err)
+		return
+	}
+	// Every instance of a player records the elimination, only the first
+	// one makes it into the replay.
+	if added.Val() == 1 {
+		gameManager.appendReplay(ctx, gameId, replay.Event{
+			Type:   replay.Eliminated,
+			UserId: userId,
+		})
+	}
+}
+
+// claimGameTask picks the one instance that runs a once-per-game task when
+// a game finishes. Every instance with a player in the game sees it end.
+func (gameManager *GameManager) claimGameTask(ctx context.Context, gameId string, task string) bool {
+	acquired, err := gameManager.RedisClient.SetNX(ctx, fmt.Sprintf("mr-game-%s-done-%s", gameId, task), 1, gameSnapshotTTL).Result()
+	if err != nil {
+		slog.WarnContext(ctx, "error claiming game task", "task", task, "error", err)
+		return false
+	}
+	return acquired
+}
+
+// GameSnapshot rebuilds the current state of a running game from Redis.
+func (gameManager *GameManager) GameSnapshot(ctx context.Context, gameId string) (Game, error) {
+	var game Game
+	payload, err := gameManager.RedisClient.Get(ctx, gameSnapshotKey(gameId)).Result()
+	if err != nil {
+		return game, ErrGameNotLive
+	}
+	if err := Parse(payload, &game); err != nil {
+		return game, err
+	}
+
+	scores, err := gameManager.RedisClient.HGetAll(ctx, gameScoresKey(gameId)).Result()
+	if err != nil {
+		return game, err
+	}
+	eliminated, err := gameManager.RedisClient.SMembers(ctx, gameEliminatedKey(gameId)).Result()
+	if err != nil {
+		return game, err
+	}
+	for userId, points := range scores {
+		score := game.ScoreBoard[userId]
+		score.Points, _ = strconv.Atoi(points)
+		game.ScoreBoard[userId] = score
+	}
+	for _, userId := range eliminated {
+		game.GameOver(userId)
+	}
+	return game, nil
+}
+
+// finishSpectatedGame drops the Redis copy of a game that just ended and
+// tells its spectators who won. Every instance of a player sees the end, the
+// one that gets to delete the copy announces it.
+func (gameManager *GameManager) finishSpectatedGame(ctx context.Context, gameId string, winnerId string) {
+	if !gameManager.dropGameSnapshot(ctx, gameId) {
+		return
+	}
+	gameManager.RedisClient.Publish(ctx, gameId, lib.Stringify(map[string]interface{}{
+		"type": "game-finished",
+		"data": map[string]interface{}{
+			"gameId":   gameId,
+			"winnerId": winnerId,
+		},
+	}))
+}
+
+// dropGameSnapshot removes the Redis copy of a game and reports whether
+// this call was the one that removed it. Scores and eliminations are left
+// to expire, late game over messages from other instances still dedupe
+// against them.
+func (gameManager *GameManager) dropGameSnapshot(ctx context.Context, gameId string) bool {
+	deleted, err := gameManager.RedisClient.Del(ctx, gameSnapshotKey(gameId)).Result()
+	return err == nil && deleted > 0
+}
+
+// IsPlayer reports whether a socket belongs to a player of the game it
+// claims to play in. The socket's user is the one its access token was
+// issued to. Score and game over messages from anyone else, in particular
+// spectators, are dropped.
+func (gameManager *GameManager) IsPlayer(conn *websocket.Conn, userId string, gameId string) bool {
+	if bound, _ := gameManager.ConnectionUser(conn); userId == "" || bound != userId {
+		return false
+	}
+	user, exist := gameManager.GetUser(userId)
+	return exist && gameId != "" && user.CurrentGameId == gameId
+}
+
+// Spectate sends a socket the snapshot of a running game and keeps it
+// updated with the game's live events. The number of spectators per game
+// is capped across instances by SPECTATOR_LIMIT.
+func (gameManager *GameManager) Spectate(ctx context.Context, conn *websocket.Conn, gameId string) error {
+	gameManager.StopSpectating(ctx, conn)
+
+	snapshot, err := gameManager.GameSnapshot(ctx, gameId)
+	if err != nil {
+		return err
+	}
+	count, err := gameManager.RedisClient.Incr(ctx, spectatorCountKey(gameId)).Result()
+	if err != nil {
+		return err
+	}
+	gameManager.RedisClient.Expire(ctx, spectatorCountKey(gameId), gameSnapshotTTL)
+	if count > int64(gameManager.Config.SpectatorLimit) {
+		gameManager.RedisClient.Decr(ctx, spectatorCountKey(gameId))
+		return ErrSpectatorLimit
+	}
+
+	gameManager.spectatorsMu.Lock()
+	if gameManager.spectated == nil {
+		gameManager.spectated = map[string]*spectatedGame{}
+		gameManager.spectating = map[*websocket.Conn]string{}
+	}
+	spectated, exist := gameManager.spectated[gameId]
+	if !exist {
+		spectated = &spectatedGame{game: snapshot, conns: map[*websocket.Conn]bool{}}
+		gameManager.spectated[gameId] = spectated
+	}
+	spectated.conns[conn] = true
+	gameManager.spectating[conn] = gameId
+	gameManager.spectatorsMu.Unlock()
+
+	gameManager.subscribe(gameId)
+
+	users := make([]string, 0, len(snapshot.Users))
+	for userId := range snapshot.Users {
+		users = append(users, userId)
+	}
+	spectator := User{Ws: conn}
+	spectator.SendMessage("spectate-snapshot", map[string]interface{}{
+		"gameId":     gameId,
+		"status":     snapshot.Status,
+		"users":      users,
+		"scoreBoard": snapshot.ScoreBoard,
+		"spectators": count,
+	})
+	gameManager.publishSpectatorCount(ctx, gameId, count)
+	return nil
+}
+
+// StopSpectating detaches a socket from the game it watches, if any.
+func (gameManager *GameManager) StopSpectating(ctx context.Context, conn *websocket.Conn) {
+	gameManager.spectatorsMu.Lock()
+	gameId, exist := gameManager.spectating[conn]
+	if exist {
+		delete(gameManager.spectating, conn)
+		if spectated, ok := gameManager.spectated[gameId]; ok {
+			delete(spectated.conns, conn)
+			if len(spectated.conns) == 0 {
+				delete(gameManager.spectated, gameId)
+			}
+		}
+	}
+	gameManager.spectatorsMu.Unlock()
+	if !exist {
+		return
+	}
+
+	count, err := gameManager.RedisClient.Decr(ctx, spectatorCountKey(gameId)).Result()
+	if err != nil {
+		slog.WarnContext(ctx, "error updating spectator count", "gameId", gameId, "error", err)
+		return
+	}
+	gameManager.publishSpectatorCount(ctx, gameId, count)
+}
+
+func (gameManager *GameManager) publishSpectatorCount(ctx context.Context, gameId string, count int64) {
+	gameManager.RedisClient.Publish(ctx, gameId, lib.Stringify(map[string]interface{}{
+		"type": "spectators",
+		"data": map[string]interface{}{
+			"gameId": gameId,
+			"count":  count,
+		},
+	}))
+}
+
+// notifySpectators applies a game event to the local spectators' copy of
+// the game and passes it on to them. Once the game is over they are let go.
+func (gameManager *GameManager) notifySpectators(gameId string, eventType string, data map[string]interface{}) {
+	if eventType == "spectators" {
+		gameManager.SendLocal(gameId, "spectator-count", data)
+	}
+
+	gameManager.spectatorsMu.Lock()
+	defer gameManager.spectatorsMu.Unlock()
+	spectated, exist := gameManager.spectated[gameId]
+	if !exist {
+		return
+	}
+
+	userId, _ := data["userId"].(string)
+	messageType, message := "", map[string]interface{}{"gameId": gameId}
+	finished := false
+	switch eventType {
+	case "spectators":
+		messageType, message = "spectator-count", data
+	case "update-board":
+		spectated.game.UpdateScore(userId)
+		messageType = "score"
+		message["userId"] = userId
+		message["points"] = spectated.game.ScoreBoard[userId].Points
+	case "game-over", "player-kicked":
+		spectated.game.GameOver(userId)
+		messageType = "eliminated"
+		message["userId"] = userId
+	case "game-finished", "force-ended":
+		messageType = "game-finished"
+		message["winnerId"] = data["winnerId"]
+		finished = true
+	case "game-aborted":
+		messageType = "game-aborted"
+		finished = true
+	default:
+		return
+	}
+
+	for conn := range spectated.conns {
+		spectator := User{Ws: conn}
+		spectator.SendMessage(messageType, message)
+		if finished {
+			delete(gameManager.spectating, conn)
+		}
+	}
+	if finished {
+		delete(gameManager.spectated, gameId)
+		gameManager.dropGameSnapshot(gameManager.Context, gameId)
+		gameManager.RedisClient.Del(gameManager.Context, spectatorCountKey(gameId))
+	}
+}
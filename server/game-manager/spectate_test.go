@@ -0,0 +1,47 @@
+package gameManager
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSpectatorCannotScore(t *testing.T) {
+	gameManager, _ := newTestManager(t)
+	gameManager.Config.SpectatorLimit = 5
+	game := ongoingGame("game", "player")
+	gameManager.SetGame(game)
+	// The player's instance already listens to the game's channel.
+	gameManager.Subscriptions.Store("game", true)
+	if err := gameManager.saveGameSnapshot(context.Background(), game); err != nil {
+		t.Fatal(err)
+	}
+
+	var playerConn, watcherConn *websocket.Conn
+	connectUser(t, gameManager, "player")
+	gameManager.SetCurrentGame("player", "game")
+	player, _ := gameManager.GetUser("player")
+	playerConn = player.Ws
+	dial(t, func(conn *websocket.Conn) {
+		gameManager.BindConnection(conn, "watcher")
+		gameManager.SetUser(User{Id: "watcher", Ws: conn})
+		watcherConn = conn
+	})
+	if err := gameManager.Spectate(context.Background(), watcherConn, "game"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Messages act as the user the socket signed in as, so a spectator
+	// claiming to be the player still scores as themselves.
+	watcher, _ := gameManager.ConnectionUser(watcherConn)
+	if gameManager.IsPlayer(watcherConn, watcher, "game") {
+		t.Error("spectator scores in the game they watch")
+	}
+	if gameManager.IsPlayer(watcherConn, "player", "game") {
+		t.Error("spectator scores for the player they watch")
+	}
+	if !gameManager.IsPlayer(playerConn, "player", "game") {
+		t.Error("player can't score in their own game")
+	}
+}
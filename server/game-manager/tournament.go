@@ -0,0 +1,1006 @@
+package gameManager
+
+import (
+	"context"
+	"errors"
+	"flappy-bird-server/audit"
+	"flappy-bird-server/lib"
+	"flappy-bird-server/metrics"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Tournaments live in Postgres so a restart picks them up where they were.
+// Every instance sweeps them, a short Redis lock makes one of them act per
+// tick. Rounds are ordinary games created through CreateGame and started
+// like a full lobby, with no entry fee and no prize of their own.
+const tournamentSweepInterval = 5 * time.Second
+
+// tournamentSeatingDelay gives the players' instances time to subscribe to
+// a round game before it starts.
+const tournamentSeatingDelay = 5 * time.Second
+
+var ErrTournamentNotFound = errors.New("tournament not found")
+var ErrInvalidTournament = errors.New("invalid tournament")
+var ErrRegistrationClosed = errors.New("registration for this tournament is closed")
+var ErrTournamentFull = errors.New("tournament is full")
+var ErrAlreadyRegistered = errors.New("already registered for this tournament")
+var ErrNotRegistered = errors.New("not registered for this tournament")
+var ErrInsufficientBalance = errors.New("insufficient balance")
+
+type Tournament struct {
+	Id         string    `json:"id"`
+	Title      string    `json:"title"`
+	GameTypeId string    `json:"gameTypeId"`
+	Status     string    `json:"status"`
+	StartsAt   time.Time `json:"startsAt"`
+	Capacity   int       `json:"capacity"`
+	BuyIn      int       `json:"buyIn"`
+	// PrizeTable is the share of the pool in percent for first place,
+	// second place and so on.
+	PrizeTable []int `json:"prizeTable"`
+	// TableSize players meet in each round game and the best Advance of
+	// each game play the next round.
+	TableSize int       `json:"tableSize"`
+	Advance   int       `json:"advance"`
+	Round     int       `json:"round"`
+	Entrants  int       `json:"entrants"`
+	Pool      int       `json:"pool"`
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type TournamentEntry struct {
+	UserId          string `json:"userId"`
+	Status          string `json:"status"`
+	Round           int    `json:"round"`
+	EliminatedRound *int   `json:"eliminatedRound"`
+	Place           *int   `json:"place"`
+	Prize           *int   `json:"prize"`
+}
+
+type TournamentGame struct {
+	GameId     string     `json:"gameId"`
+	Round      int        `json:"round"`
+	Players    int        `json:"players"`
+	StartedAt  *time.Time `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt"`
+	// Results lists the players from first to last.
+	Results []string `json:"results"`
+}
+
+const tournamentColumns = `t.id, t.title, t."gameTypeId", t.status, t."startsAt", t.capacity, t."buyIn", t."prizeTable", t."tableSize", t.advance, t.round, COALESCE(t."createdBy", ''), t."createdAt",
+	(SELECT COUNT(*) FROM public.tournament_entries e WHERE e."tournamentId" = t.id)`
+
+func scanTournament(row pgx.Row) (Tournament, error) {
+	var tournament Tournament
+	err := row.Scan(&tournament.Id, &tournament.Title, &tournament.GameTypeId, &tournament.Status, &tournament.StartsAt, &tournament.Capacity, &tournament.BuyIn, &tournament.PrizeTable, &tournament.TableSize, &tournament.Advance, &tournament.Round, &tournament.CreatedBy, &tournament.CreatedAt, &tournament.Entrants)
+	tournament.Pool = tournament.BuyIn * tournament.Entrants
+	return tournament, err
+}
+
+// CreateTournament validates and stores a new tournament. TableSize
+// defaults to the game type's player count and Advance to one. At most
+// half of a table advances so every round gets smaller.
+func (gameManager *GameManager) CreateTournament(ctx context.Context, tournament Tournament) (Tournament, error) {
+	gameType, err := gameManager.GetGameType(tournament.GameTypeId)
+	if err != nil || !gameType.Active {
+		return tournament, fmt.Errorf("%w: gameTypeId should be an active game type", ErrInvalidTournament)
+	}
+	if tournament.TableSize == 0 {
+		tournament.TableSize = gameType.MaxPlayer
+	}
+	if tournament.Advance == 0 {
+		tournament.Advance = 1
+	}
+
+	problems := []string{}
+	if tournament.Title == "" {
+		problems = append(problems, "title is required")
+	}
+	if !tournament.StartsAt.After(time.Now()) {
+		problems = append(problems, "startsAt should be in the future")
+	}
+	if tournament.Capacity < 2 {
+		problems = append(problems, "capacity should be at least 2")
+	}
+	if tournament.BuyIn < 0 {
+		problems = append(problems, "buyIn can't be negative")
+	}
+	if tournament.TableSize < 2 || tournament.TableSize > gameType.MaxPlayer {
+		problems = append(problems, fmt.Sprintf("tableSize should be between 2 and %d", gameType.MaxPlayer))
+	}
+	if tournament.Advance < 1 || 2*tournament.Advance > tournament.TableSize {
+		problems = append(problems, "advance should be between 1 and half the tableSize")
+	}
+	share := 0
+	for _, percent := range tournament.PrizeTable {
+		if percent < 0 {
+			problems = append(problems, "prizeTable can't hold negative shares")
+			break
+		}
+		share += percent
+	}
+	if len(tournament.PrizeTable) == 0 || share > 100 {
+		problems = append(problems, "prizeTable should list up to 100 percent of the pool")
+	}
+	if len(problems) > 0 {
+		return tournament, fmt.Errorf("%w: %s", ErrInvalidTournament, strings.Join(problems, ", "))
+	}
+
+	tournament.Id = uuid.NewString()
+	row := lib.Pool.QueryRow(ctx, `WITH t AS (INSERT INTO public.tournaments (id, title, "gameTypeId", "startsAt", capacity, "buyIn", "prizeTable", "tableSize", advance, "createdBy")
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, '')) RETURNING *)
+		SELECT `+tournamentColumns+` FROM t`, tournament.Id, tournament.Title, tournament.GameTypeId, tournament.StartsAt, tournament.Capacity, tournament.BuyIn, tournament.PrizeTable, tournament.TableSize, tournament.Advance, tournament.CreatedBy)
+	created, err := scanTournament(row)
+	if err != nil {
+		return tournament, err
+	}
+	gameManager.publishTournament(ctx, created)
+	return created, nil
+}
+
+// ListTournaments returns the tournaments with the given status, or all of
+// them, latest first.
+func (gameManager *GameManager) ListTournaments(ctx context.Context, status string) ([]Tournament, error) {
+	rows, err := lib.Pool.Query(ctx, `SELECT `+tournamentColumns+` FROM public.tournaments t WHERE $1 = '' OR t.status::text = $1 ORDER BY t."startsAt" DESC`, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tournaments := []Tournament{}
+	for rows.Next() {
+		tournament, err := scanTournament(rows)
+		if err != nil {
+			return nil, err
+		}
+		tournaments = append(tournaments, tournament)
+	}
+	return tournaments, rows.Err()
+}
+
+// GetTournament returns a tournament with its entries, best placed first,
+// and its round games.
+func (gameManager *GameManager) GetTournament(ctx context.Context, tournamentId string) (Tournament, []TournamentEntry, []TournamentGame, error) {
+	tournament, err := scanTournament(lib.Pool.QueryRow(ctx, `SELECT `+tournamentColumns+` FROM public.tournaments t WHERE t.id = $1`, tournamentId))
+	if err == pgx.ErrNoRows {
+		return tournament, nil, nil, ErrTournamentNotFound
+	}
+	if err != nil {
+		return tournament, nil, nil, err
+	}
+
+	entries := []TournamentEntry{}
+	rows, err := lib.Pool.Query(ctx, `SELECT "userId", status, round, "eliminatedRound", place, prize FROM public.tournament_entries WHERE "tournamentId" = $1
+		ORDER BY place ASC NULLS LAST, round DESC, "createdAt" ASC`, tournamentId)
+	if err != nil {
+		return tournament, nil, nil, err
+	}
+	for rows.Next() {
+		var entry TournamentEntry
+		if err := rows.Scan(&entry.UserId, &entry.Status, &entry.Round, &entry.EliminatedRound, &entry.Place, &entry.Prize); err != nil {
+			rows.Close()
+			return tournament, nil, nil, err
+		}
+		entries = append(entries, entry)
+	}
+	rows.Close()
+
+	games := []TournamentGame{}
+	rows, err = lib.Pool.Query(ctx, `SELECT "gameId", round, players, "startedAt", "finishedAt", results FROM public.tournament_games WHERE "tournamentId" = $1 ORDER BY round, "gameId"`, tournamentId)
+	if err != nil {
+		return tournament, nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var game TournamentGame
+		if err := rows.Scan(&game.GameId, &game.Round, &game.Players, &game.StartedAt, &game.FinishedAt, &game.Results); err != nil {
+			return tournament, nil, nil, err
+		}
+		games = append(games, game)
+	}
+	return tournament, entries, games, rows.Err()
+}
+
+// lockTournament reads a tournament inside tx and holds its row until the
+// transaction ends, so registrations and round changes don't interleave.
+func lockTournament(ctx context.Context, tx pgx.Tx, tournamentId string) (Tournament, error) {
+	tournament, err := scanTournament(tx.QueryRow(ctx, `SELECT `+tournamentColumns+` FROM public.tournaments t WHERE t.id = $1 FOR UPDATE`, tournamentId))
+	if err == pgx.ErrNoRows {
+		return tournament, ErrTournamentNotFound
+	}
+	return tournament, err
+}
+
+// commitTournamentPayments commits balance changes of different amounts,
+// which commitBalanceChanges can't count.
+func commitTournamentPayments(ctx context.Context, tx pgx.Tx, kind string, events []audit.Event, total int) error {
+	for _, event := range events {
+		if err := audit.Record(ctx, tx, event); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	metrics.BalanceChanges.WithLabelValues(kind).Add(float64(len(events)))
+	metrics.BalanceAmount.WithLabelValues(kind).Add(float64(total))
+	return nil
+}
+
+func (gameManager *GameManager) forgetBalances(ctx context.Context, userIds ...string) {
+	keys := make([]string, 0, len(userIds))
+	for _, userId := range userIds {
+		keys = append(keys, fmt.Sprintf("mr-balance-%s", userId))
+	}
+	if len(keys) > 0 {
+		gameManager.RedisClient.Del(ctx, keys...)
+	}
+}
+
+// RegisterTournament takes the buy-in and enters the player, as long as
+// registration is open and there is room left.
+func (gameManager *GameManager) RegisterTournament(ctx context.Context, tournamentId string, userId string) (Tournament, error) {
+	tx, err := lib.Pool.Begin(ctx)
+	if err != nil {
+		return Tournament{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	tournament, err := lockTournament(ctx, tx, tournamentId)
+	if err != nil {
+		return tournament, err
+	}
+	if tournament.Status != "registration" || !time.Now().Before(tournament.StartsAt) {
+		return tournament, ErrRegistrationClosed
+	}
+	if tournament.Entrants >= tournament.Capacity {
+		return tournament, ErrTournamentFull
+	}
+	tag, err := tx.Exec(ctx, `INSERT INTO public.tournament_entries ("tournamentId", "userId") VALUES ($1, $2) ON CONFLICT DO NOTHING`, tournamentId, userId)
+	if err != nil {
+		return tournament, err
+	}
+	if tag.RowsAffected() == 0 {
+		return tournament, ErrAlreadyRegistered
+	}
+
+	events, err := balanceEvents(ctx, tx, "balance.buy-in", -tournament.BuyIn, "", `UPDATE public.users SET "solanaBalance" = "solanaBalance" - $2 WHERE id = $1 AND "solanaBalance" >= $2 RETURNING id, "solanaBalance"`, userId, tournament.BuyIn)
+	if err != nil {
+		return tournament, err
+	}
+	if len(events) == 0 {
+		return tournament, ErrInsufficientBalance
+	}
+	for i := range events {
+		events[i].Details = map[string]interface{}{"tournamentId": tournamentId}
+	}
+	if err := commitBalanceChanges(ctx, tx, "buy-in", tournament.BuyIn, events); err != nil {
+		return tournament, err
+	}
+	gameManager.forgetBalances(ctx, userId)
+
+	tournament.Entrants += 1
+	tournament.Pool += tournament.BuyIn
+	gameManager.publishTournament(ctx, tournament)
+	return tournament, nil
+}
+
+// UnregisterTournament refunds the buy-in of a player who changed their
+// mind before the tournament started.
+func (gameManager *GameManager) UnregisterTournament(ctx context.Context, tournamentId string, userId string) (Tournament, error) {
+	tx, err := lib.Pool.Begin(ctx)
+	if err != nil {
+		return Tournament{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	tournament, err := lockTournament(ctx, tx, tournamentId)
+	if err != nil {
+		return tournament, err
+	}
+	if tournament.Status != "registration" {
+		return tournament, ErrRegistrationClosed
+	}
+	tag, err := tx.Exec(ctx, `DELETE FROM public.tournament_entries WHERE "tournamentId" = $1 AND "userId" = $2`, tournamentId, userId)
+	if err != nil {
+		return tournament, err
+	}
+	if tag.RowsAffected() == 0 {
+		return tournament, ErrNotRegistered
+	}
+	if err := gameManager.refundBuyIns(ctx, tx, tournament, []string{userId}); err != nil {
+		return tournament, err
+	}
+	gameManager.forgetBalances(ctx, userId)
+
+	tournament.Entrants -= 1
+	tournament.Pool -= tournament.BuyIn
+	gameManager.publishTournament(ctx, tournament)
+	return tournament, nil
+}
+
+// refundBuyIns pays the buy-in back to the given players and commits tx.
+func (gameManager *GameManager) refundBuyIns(ctx context.Context, tx pgx.Tx, tournament Tournament, userIds []string) error {
+	events, err := balanceEvents(ctx, tx, "balance.refund", tournament.BuyIn, "", `UPDATE public.users SET "solanaBalance" = "solanaBalance" + $2 WHERE id = ANY($1) RETURNING id, "solanaBalance"`, userIds, tournament.BuyIn)
+	if err != nil {
+		return err
+	}
+	for i := range events {
+		events[i].Details = map[string]interface{}{"tournamentId": tournament.Id}
+	}
+	return commitBalanceChanges(ctx, tx, "refund", tournament.BuyIn, events)
+}
+
+func entryUserIds(ctx context.Context, tx pgx.Tx, tournamentId string, condition string) ([]string, error) {
+	rows, err := tx.Query(ctx, `SELECT "userId" FROM public.tournament_entries WHERE "tournamentId" = $1`+condition, tournamentId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	userIds := []string{}
+	for rows.Next() {
+		var userId string
+		if err := rows.Scan(&userId); err != nil {
+			return nil, err
+		}
+		userIds = append(userIds, userId)
+	}
+	return userIds, rows.Err()
+}
+
+// CancelTournament stops a tournament that hasn't finished, aborts its
+// running games and refunds every buy-in.
+func (gameManager *GameManager) CancelTournament(ctx context.Context, tournamentId string) (Tournament, error) {
+	tx, err := lib.Pool.Begin(ctx)
+	if err != nil {
+		return Tournament{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	tournament, err := lockTournament(ctx, tx, tournamentId)
+	if err != nil {
+		return tournament, err
+	}
+	if tournament.Status != "registration" && tournament.Status != "running" {
+		return tournament, fmt.Errorf("%w: tournament is %s", ErrInvalidTournament, tournament.Status)
+	}
+	return tournament, gameManager.cancelLocked(ctx, tx, tournament)
+}
+
+func (gameManager *GameManager) cancelLocked(ctx context.Context, tx pgx.Tx, tournament Tournament) error {
+	if _, err := tx.Exec(ctx, `UPDATE public.tournaments SET status = 'cancelled', "updatedAt" = NOW() WHERE id = $1`, tournament.Id); err != nil {
+		return err
+	}
+	userIds, err := entryUserIds(ctx, tx, tournament.Id, "")
+	if err != nil {
+		return err
+	}
+	rows, err := tx.Query(ctx, `SELECT "gameId" FROM public.tournament_games WHERE "tournamentId" = $1 AND "startedAt" IS NOT NULL AND "finishedAt" IS NULL`, tournament.Id)
+	if err != nil {
+		return err
+	}
+	running := []string{}
+	for rows.Next() {
+		var gameId string
+		if err := rows.Scan(&gameId); err != nil {
+			rows.Close()
+			return err
+		}
+		running = append(running, gameId)
+	}
+	rows.Close()
+	if _, err := tx.Exec(ctx, `UPDATE public.tournament_games SET "finishedAt" = NOW() WHERE "tournamentId" = $1 AND "finishedAt" IS NULL`, tournament.Id); err != nil {
+		return err
+	}
+	if err := gameManager.refundBuyIns(ctx, tx, tournament, userIds); err != nil {
+		return err
+	}
+	gameManager.forgetBalances(ctx, userIds...)
+
+	for _, gameId := range running {
+		if _, err := gameManager.AdminAbortGame(ctx, gameId); err != nil {
+			slog.WarnContext(ctx, "error aborting tournament game", "tournamentId", tournament.Id, "gameId", gameId, "error", err)
+		}
+	}
+	tournament.Status = "cancelled"
+	gameManager.publishTournament(ctx, tournament)
+	return nil
+}
+
+// publishTournament tells every connected player that a tournament
+// changed, clients that show it fetch the details over REST.
+func (gameManager *GameManager) publishTournament(ctx context.Context, tournament Tournament) {
+	gameManager.RedisClient.Publish(ctx, "mari-arena-global", lib.Stringify(map[string]interface{}{
+		"type": "tournament-updated",
+		"data": map[string]interface{}{
+			"tournamentId": tournament.Id,
+			"status":       tournament.Status,
+			"round":        tournament.Round,
+			"entrants":     tournament.Entrants,
+		},
+	}))
+}
+
+// TournamentUpdated passes a tournament change on to the local players.
+func (gameManager *GameManager) TournamentUpdated(data map[string]interface{}) {
+	gameManager.RangeUsers(func(user User) {
+		user.SendMessage("tournament-updated", data)
+	})
+}
+
+// WatchTournaments starts tournaments when they are due, starts seated
+// round games, ends round games that ran past TOURNAMENT_ROUND_TIMEOUT and
+// moves finished rounds on.
+func (gameManager *GameManager) WatchTournaments(ctx context.Context) {
+	ticker := time.NewTicker(tournamentSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			acquired, err := gameManager.RedisClient.SetNX(ctx, "mr-tournament-sweep", 1, tournamentSweepInterval-time.Second).Result()
+			if err != nil || !acquired {
+				continue
+			}
+			gameManager.sweepTournaments(ctx)
+		}
+	}
+}
+
+func (gameManager *GameManager) sweepTournaments(ctx context.Context) {
+	due := []string{}
+	rows, err := lib.Pool.Query(ctx, `SELECT id FROM public.tournaments WHERE (status = 'registration' AND "startsAt" <= NOW()) OR status = 'running'`)
+	if err != nil {
+		slog.WarnContext(ctx, "error loading tournaments", "error", err)
+		return
+	}
+	for rows.Next() {
+		var tournamentId string
+		if rows.Scan(&tournamentId) == nil {
+			due = append(due, tournamentId)
+		}
+	}
+	rows.Close()
+
+	for _, tournamentId := range due {
+		tournamentCtx := lib.WithLogAttrs(ctx, "tournamentId", tournamentId)
+		if err := gameManager.advanceTournament(tournamentCtx, tournamentId); err != nil {
+			slog.ErrorContext(tournamentCtx, "error advancing tournament", "error", err)
+		}
+	}
+
+	type seatedGame struct {
+		tournamentId string
+		gameId       string
+		startedAt    *time.Time
+	}
+	games := []seatedGame{}
+	rows, err = lib.Pool.Query(ctx, `SELECT g."tournamentId", g."gameId", g."startedAt" FROM public.tournament_games g JOIN public.tournaments t ON t.id = g."tournamentId"
+		WHERE t.status = 'running' AND g."finishedAt" IS NULL AND (("startedAt" IS NULL AND "startAt" <= NOW()) OR "startedAt" <= $1)`, time.Now().Add(-gameManager.Config.TournamentRoundTimeout))
+	if err != nil {
+		slog.WarnContext(ctx, "error loading tournament games", "error", err)
+		return
+	}
+	for rows.Next() {
+		var game seatedGame
+		if rows.Scan(&game.tournamentId, &game.gameId, &game.startedAt) == nil {
+			games = append(games, game)
+		}
+	}
+	rows.Close()
+
+	for _, game := range games {
+		gameCtx := lib.WithLogAttrs(ctx, "tournamentId", game.tournamentId, "gameId", game.gameId)
+		if game.startedAt == nil {
+			err = gameManager.startTournamentGame(gameCtx, game.tournamentId, game.gameId)
+		} else {
+			err = gameManager.timeOutTournamentGame(gameCtx, game.tournamentId, game.gameId)
+		}
+		if err != nil {
+			slog.ErrorContext(gameCtx, "error running tournament game", "error", err)
+		}
+	}
+}
+
+// advanceTournament makes the next step a tournament is ready for: the
+// first round once it is due, the next round once every game of the
+// current one has its results, or the payout after the final.
+func (gameManager *GameManager) advanceTournament(ctx context.Context, tournamentId string) error {
+	tx, err := lib.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tournament, err := lockTournament(ctx, tx, tournamentId)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case tournament.Status == "registration" && !time.Now().Before(tournament.StartsAt):
+		if tournament.Entrants < 2 {
+			slog.InfoContext(ctx, "cancelling tournament without enough entrants", "entrants", tournament.Entrants)
+			return gameManager.cancelLocked(ctx, tx, tournament)
+		}
+		if _, err := tx.Exec(ctx, `UPDATE public.tournaments SET status = 'running', "updatedAt" = NOW() WHERE id = $1`, tournamentId); err != nil {
+			return err
+		}
+		tournament.Status = "running"
+	case tournament.Status != "running":
+		return nil
+	default:
+		var games, unfinished int
+		err := tx.QueryRow(ctx, `SELECT COUNT(*), COUNT(*) FILTER (WHERE "finishedAt" IS NULL) FROM public.tournament_games WHERE "tournamentId" = $1 AND round = $2`, tournamentId, tournament.Round).Scan(&games, &unfinished)
+		if err != nil {
+			return err
+		}
+		if games == 0 || unfinished > 0 {
+			return nil
+		}
+		final, err := gameManager.closeRound(ctx, tx, tournament)
+		if err != nil {
+			return err
+		}
+		if final {
+			return gameManager.payOut(ctx, tx, tournament)
+		}
+	}
+
+	if err := gameManager.seedRound(ctx, tx, &tournament); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	gameManager.publishTournament(ctx, tournament)
+	return nil
+}
+
+// closeRound eliminates everyone who didn't finish in the top Advance of
+// their game. It reports whether this was the final, a round played at a
+// single table by every remaining player.
+func (gameManager *GameManager) closeRound(ctx context.Context, tx pgx.Tx, tournament Tournament) (bool, error) {
+	rows, err := tx.Query(ctx, `SELECT results FROM public.tournament_games WHERE "tournamentId" = $1 AND round = $2`, tournament.Id, tournament.Round)
+	if err != nil {
+		return false, err
+	}
+	tables := [][]string{}
+	for rows.Next() {
+		var results []string
+		if err := rows.Scan(&results); err != nil {
+			rows.Close()
+			return false, err
+		}
+		tables = append(tables, results)
+	}
+	rows.Close()
+
+	active, err := entryUserIds(ctx, tx, tournament.Id, ` AND status = 'active'`)
+	if err != nil {
+		return false, err
+	}
+	if len(tables) == 1 && len(tables[0]) >= len(active) {
+		for position, userId := range tables[0] {
+			if _, err := tx.Exec(ctx, `UPDATE public.tournament_entries SET place = $3 WHERE "tournamentId" = $1 AND "userId" = $2`, tournament.Id, userId, position+1); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+
+	for _, results := range tables {
+		for position, userId := range results {
+			if position < tournament.Advance {
+				continue
+			}
+			_, err := tx.Exec(ctx, `UPDATE public.tournament_entries SET status = 'eliminated', "eliminatedRound" = $3, position = $4 WHERE "tournamentId" = $1 AND "userId" = $2`, tournament.Id, userId, tournament.Round, position)
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+	return false, nil
+}
+
+// seedRound seats the remaining players of the next round. Players are
+// spread over as few tables as TableSize allows, snaking by rating so each
+// table gets a similar mix. A table no bigger than Advance has nothing to
+// play for and goes through without a game.
+func (gameManager *GameManager) seedRound(ctx context.Context, tx pgx.Tx, tournament *Tournament) error {
+	players, err := entryUserIds(ctx, tx, tournament.Id, ` AND status = 'active'`)
+	if err != nil {
+		return err
+	}
+	ratings := make(map[string]float64, len(players))
+	for _, userId := range players {
+		rating, err := gameManager.GetRating(ctx, userId, tournament.GameTypeId)
+		if err != nil {
+			rating = DefaultRating
+		}
+		ratings[userId] = rating
+	}
+	sort.Slice(players, func(i, j int) bool {
+		if ratings[players[i]] != ratings[players[j]] {
+			return ratings[players[i]] > ratings[players[j]]
+		}
+		return players[i] < players[j]
+	})
+
+	count := (len(players) + tournament.TableSize - 1) / tournament.TableSize
+	tables := make([][]string, count)
+	for i, userId := range players {
+		table := i % count
+		if (i/count)%2 == 1 {
+			table = count - 1 - table
+		}
+		tables[table] = append(tables[table], userId)
+	}
+
+	tournament.Round += 1
+	if _, err := tx.Exec(ctx, `UPDATE public.tournaments SET round = $2, "updatedAt" = NOW() WHERE id = $1`, tournament.Id, tournament.Round); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE public.tournament_entries SET round = $2 WHERE "tournamentId" = $1 AND status = 'active'`, tournament.Id, tournament.Round); err != nil {
+		return err
+	}
+
+	startAt := time.Now().Add(tournamentSeatingDelay)
+	for _, table := range tables {
+		if count > 1 && len(table) <= tournament.Advance {
+			continue
+		}
+		game, err := gameManager.CreateGame(ctx, len(table), 0, 0, tournament.GameTypeId)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `INSERT INTO public.tournament_games ("gameId", "tournamentId", round, players, "startAt") VALUES ($1, $2, $3, $4, $5)`, game.Id, tournament.Id, tournament.Round, len(table), startAt)
+		if err != nil {
+			return err
+		}
+		for _, userId := range table {
+			err := gameManager.DbQueue.Enqueue(ctx, map[string]interface{}{
+				"type": "add-participant",
+				"data": map[string]interface{}{
+					"userId": userId,
+					"gameId": game.Id,
+				},
+			})
+			if err != nil {
+				return err
+			}
+		}
+		for _, userId := range table {
+			gameManager.RedisClient.Publish(ctx, "mari-arena-global", lib.Stringify(map[string]interface{}{
+				"type": "user-join-game",
+				"data": map[string]interface{}{
+					"userId": userId,
+					"users":  table,
+					"gameId": game.Id,
+				},
+			}))
+			gameManager.RedisClient.Publish(ctx, "mari-arena-global", lib.Stringify(map[string]interface{}{
+				"type": "tournament-round",
+				"data": map[string]interface{}{
+					"userId":       userId,
+					"tournamentId": tournament.Id,
+					"round":        tournament.Round,
+					"gameId":       game.Id,
+					"startsAt":     startAt,
+				},
+			}))
+		}
+	}
+	slog.InfoContext(ctx, "tournament round seeded", "round", tournament.Round, "players", len(players), "tables", count)
+	return nil
+}
+
+// startTournamentGame starts a seated round game once its participants
+// are stored, through the same path as a full lobby.
+func (gameManager *GameManager) startTournamentGame(ctx context.Context, tournamentId string, gameId string) error {
+	lobby := Game{
+		Id:           gameId,
+		Users:        map[string]bool{},
+		ScoreBoard:   map[string]Score{},
+		Ratings:      map[string]float64{},
+		Status:       "staging",
+		CreatedAt:    time.Now(),
+		TournamentId: tournamentId,
+	}
+	var players int
+	err := lib.Pool.QueryRow(ctx, `SELECT g."gameTypeId", g."maxPlayer", tg.players FROM public.games g JOIN public.tournament_games tg ON tg."gameId" = g.id WHERE g.id = $1`, gameId).Scan(&lobby.GameTypeId, &lobby.MaxUserCount, &players)
+	if err == pgx.ErrNoRows {
+		// The create-game task hasn't run yet.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	rows, err := lib.Pool.Query(ctx, `SELECT "userId" FROM public.participants WHERE "gameId" = $1`, gameId)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var userId string
+		if err := rows.Scan(&userId); err != nil {
+			rows.Close()
+			return err
+		}
+		lobby.Users[userId] = true
+		lobby.ScoreBoard[userId] = Score{IsAlive: true}
+		lobby.CurrentUserCount += 1
+	}
+	rows.Close()
+	if lobby.CurrentUserCount < players {
+		return nil
+	}
+
+	tag, err := lib.Pool.Exec(ctx, `UPDATE public.tournament_games SET "startedAt" = NOW() WHERE "gameId" = $1 AND "startedAt" IS NULL`, gameId)
+	if err != nil || tag.RowsAffected() == 0 {
+		return err
+	}
+	return gameManager.startLobby(ctx, lobby)
+}
+
+// tournamentResults ranks the players of a game: most points first, then
+// whoever stayed in longest.
+func tournamentResults(game Game) []string {
+	results := make([]string, 0, len(game.Users))
+	for userId := range game.Users {
+		results = append(results, userId)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		a, b := game.ScoreBoard[results[i]], game.ScoreBoard[results[j]]
+		if a.Points != b.Points {
+			return a.Points > b.Points
+		}
+		if a.IsAlive != b.IsAlive {
+			return a.IsAlive
+		}
+		if a.EliminatedAt != b.EliminatedAt {
+			return a.EliminatedAt > b.EliminatedAt
+		}
+		return results[i] < results[j]
+	})
+	return results
+}
+
+// rankFirst moves userId to the front of the results.
+func rankFirst(results []string, userId string) []string {
+	for i, rankedId := range results {
+		if rankedId == userId {
+			ranked := append([]string{userId}, results[:i]...)
+			return append(ranked, results[i+1:]...)
+		}
+	}
+	return results
+}
+
+// finishTournamentGame hands the results of a round game that just ended
+// to the db queue, winnerId first. An admin may force-end a game with a
+// winner who isn't ahead on points. Every instance of a player sees the
+// end, one enqueues.
+func (gameManager *GameManager) finishTournamentGame(ctx context.Context, game Game, winnerId string) {
+	acquired, err := gameManager.RedisClient.SetNX(ctx, fmt.Sprintf("mr-tournament-game-%s", game.Id), 1, gameSnapshotTTL).Result()
+	if err != nil || !acquired {
+		return
+	}
+	err = gameManager.DbQueue.Enqueue(ctx, map[string]interface{}{
+		"type": "tournament-game-finished",
+		"data": map[string]interface{}{
+			"tournamentId": game.TournamentId,
+			"gameId":       game.Id,
+			"results":      rankFirst(tournamentResults(game), winnerId),
+		},
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "error enqueuing tournament results", "gameId", game.Id, "error", err)
+	}
+}
+
+// timeOutTournamentGame ends a round game that ran too long with the
+// standings it has, so one idle player can't hold up the tournament.
+func (gameManager *GameManager) timeOutTournamentGame(ctx context.Context, tournamentId string, gameId string) error {
+	game, err := gameManager.GameSnapshot(ctx, gameId)
+	if err != nil {
+		game = Game{Id: gameId, Users: map[string]bool{}, ScoreBoard: map[string]Score{}}
+		rows, err := lib.Pool.Query(ctx, `SELECT "userId" FROM public.participants WHERE "gameId" = $1`, gameId)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var userId string
+			if rows.Scan(&userId) == nil {
+				game.Users[userId] = true
+			}
+		}
+		rows.Close()
+	}
+	results := tournamentResults(game)
+	winnerId := ""
+	if len(results) > 0 {
+		winnerId = results[0]
+	}
+	slog.InfoContext(ctx, "tournament game timed out", "winnerId", winnerId)
+
+	gameManager.dropGameSnapshot(ctx, gameId)
+	gameManager.closeReplay(ctx, gameId, "force-ended", winnerId)
+	gameManager.RedisClient.Publish(ctx, gameId, lib.Stringify(map[string]interface{}{
+		"type": "force-ended",
+		"data": map[string]interface{}{
+			"winnerId": winnerId,
+		},
+	}))
+	return RecordTournamentGame(ctx, map[string]interface{}{
+		"tournamentId": tournamentId,
+		"gameId":       gameId,
+		"results":      stringsToInterfaces(results),
+	})
+}
+
+func stringsToInterfaces(values []string) []interface{} {
+	converted := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		converted = append(converted, value)
+	}
+	return converted
+}
+
+// RecordTournamentGame stores the results of a round game and moves the
+// tournament on when it was the last game of the round. Results already
+// stored are kept, so a retried or late task changes nothing.
+func RecordTournamentGame(ctx context.Context, taskPayload map[string]interface{}) error {
+	tournamentId, _ := taskPayload["tournamentId"].(string)
+	gameId, _ := taskPayload["gameId"].(string)
+	results := []string{}
+	if values, ok := taskPayload["results"].([]interface{}); ok {
+		for _, value := range values {
+			if userId, ok := value.(string); ok {
+				results = append(results, userId)
+			}
+		}
+	}
+
+	tag, err := lib.Pool.Exec(ctx, `UPDATE public.tournament_games SET results = $2, "finishedAt" = NOW() WHERE "gameId" = $1 AND "finishedAt" IS NULL`, gameId, results)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+	if len(results) > 0 {
+		_, err = lib.Pool.Exec(ctx, `UPDATE public.games SET status = 'completed', "winnerId" = $2, "updatedAt" = NOW() WHERE id = $1 AND status = 'ongoing'`, gameId, results[0])
+		if err != nil {
+			return err
+		}
+	}
+	return GetInstance().advanceTournament(lib.WithLogAttrs(ctx, "tournamentId", tournamentId), tournamentId)
+}
+
+// prizes splits the prize table's part of the pool between the places the
+// entrants fill. The share of places nobody reached goes to the others in
+// proportion to their own share, the rounding remainder to first place.
+func prizes(pool int, prizeTable []int, entrants int) []int {
+	places := min(len(prizeTable), entrants)
+	budget, share := 0, 0
+	for index, percent := range prizeTable {
+		budget += percent
+		if index < places {
+			share += percent
+		}
+	}
+	budget = pool * budget / 100
+	amounts := make([]int, places)
+	if share == 0 {
+		return amounts
+	}
+	distributed := 0
+	for index := range amounts {
+		amounts[index] = budget * prizeTable[index] / share
+		distributed += amounts[index]
+	}
+	amounts[0] += budget - distributed
+	return amounts
+}
+
+// payOut places everyone, pays the prize table out of the pool and ends
+// the tournament. Players out in the same round rank by their place in
+// their game.
+func (gameManager *GameManager) payOut(ctx context.Context, tx pgx.Tx, tournament Tournament) error {
+	rows, err := tx.Query(ctx, `SELECT "userId" FROM public.tournament_entries WHERE "tournamentId" = $1 AND place IS NULL
+		ORDER BY "eliminatedRound" DESC NULLS FIRST, position ASC, "userId" ASC`, tournament.Id)
+	if err != nil {
+		return err
+	}
+	unplaced := []string{}
+	for rows.Next() {
+		var userId string
+		if err := rows.Scan(&userId); err != nil {
+			rows.Close()
+			return err
+		}
+		unplaced = append(unplaced, userId)
+	}
+	rows.Close()
+	var placed int
+	if err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM public.tournament_entries WHERE "tournamentId" = $1 AND place IS NOT NULL`, tournament.Id).Scan(&placed); err != nil {
+		return err
+	}
+	for i, userId := range unplaced {
+		if _, err := tx.Exec(ctx, `UPDATE public.tournament_entries SET place = $3 WHERE "tournamentId" = $1 AND "userId" = $2`, tournament.Id, userId, placed+i+1); err != nil {
+			return err
+		}
+	}
+
+	events := []audit.Event{}
+	paid := []string{}
+	total := 0
+	for index, prize := range prizes(tournament.Pool, tournament.PrizeTable, placed+len(unplaced)) {
+		var userId string
+		err := tx.QueryRow(ctx, `UPDATE public.tournament_entries SET prize = $3 WHERE "tournamentId" = $1 AND place = $2 RETURNING "userId"`, tournament.Id, index+1, prize).Scan(&userId)
+		if err == pgx.ErrNoRows {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if prize == 0 {
+			continue
+		}
+		changes, err := balanceEvents(ctx, tx, "balance.tournament-prize", prize, "", `UPDATE public.users SET "solanaBalance" = "solanaBalance" + $2 WHERE id = $1 RETURNING id, "solanaBalance"`, userId, prize)
+		if err != nil {
+			return err
+		}
+		for i := range changes {
+			changes[i].Details = map[string]interface{}{"tournamentId": tournament.Id, "place": index + 1}
+		}
+		events = append(events, changes...)
+		paid = append(paid, userId)
+		total += prize
+	}
+	if _, err := tx.Exec(ctx, `UPDATE public.tournaments SET status = 'completed', "updatedAt" = NOW() WHERE id = $1`, tournament.Id); err != nil {
+		return err
+	}
+	// Whatever the prize table leaves in the pool stays with the house.
+	err = audit.Record(ctx, tx, audit.Event{
+		Action:     "tournament.payout",
+		TargetType: "tournament",
+		TargetId:   tournament.Id,
+		Details:    map[string]interface{}{"pool": tournament.Pool, "paid": total, "undistributed": tournament.Pool - total},
+	})
+	if err != nil {
+		return err
+	}
+	if err := commitTournamentPayments(ctx, tx, "tournament-prize", events, total); err != nil {
+		return err
+	}
+	gameManager.forgetBalances(ctx, paid...)
+
+	slog.InfoContext(ctx, "tournament completed", "pool", tournament.Pool, "paid", total, "undistributed", tournament.Pool-total)
+	tournament.Status = "completed"
+	gameManager.publishTournament(ctx, tournament)
+	return nil
+}
+
+// SendTournamentStatus sends a tournament with its entries and games over
+// the websocket, the same state GET /api/tournaments/{id} returns.
+func (gameManager *GameManager) SendTournamentStatus(ctx context.Context, client User, tournamentId string) error {
+	tournament, entries, games, err := gameManager.GetTournament(ctx, tournamentId)
+	if err != nil {
+		return err
+	}
+	client.SendMessage("tournament-status", map[string]interface{}{
+		"tournament": tournament,
+		"entries":    entries,
+		"games":      games,
+	})
+	return nil
+}
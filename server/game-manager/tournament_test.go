@@ -0,0 +1,30 @@
+package gameManager
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPrizes(t *testing.T) {
+	tests := []struct {
+		name       string
+		pool       int
+		prizeTable []int
+		entrants   int
+		want       []int
+	}{
+		{"every place filled", 1000, []int{50, 30, 20}, 10, []int{500, 300, 200}},
+		{"house keeps the rest of the table", 1000, []int{60, 30}, 10, []int{600, 300}},
+		{"unfilled places go to the others", 200, []int{50, 30, 10}, 2, []int{113, 67}},
+		{"remainder goes to first place", 7, []int{50, 50}, 3, []int{4, 3}},
+		{"nothing to share", 100, []int{0, 0}, 1, []int{0}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := prizes(test.pool, test.prizeTable, test.entrants)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("prizes(%d, %v, %d) = %v, want %v", test.pool, test.prizeTable, test.entrants, got, test.want)
+			}
+		})
+	}
+}
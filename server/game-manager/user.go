@@ -2,7 +2,8 @@ package gameManager
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
+	"sync"
 
 	"github.com/gorilla/websocket"
 )
@@ -14,6 +15,102 @@ type User struct {
 	Ws            *websocket.Conn
 }
 
+// Users are copied around by value, so the lock serialising writes to a
+// socket is kept per connection. gorilla/websocket allows one concurrent
+// writer, and pub/sub handlers and the scoreboard ticker write from their
+// own goroutines.
+var writeLocks sync.Map
+
+func writeLock(conn *websocket.Conn) *sync.Mutex {
+	lock, _ := writeLocks.LoadOrStore(conn, &sync.Mutex{})
+	return lock.(*sync.Mutex)
+}
+
+// ForgetConnection drops the write lock of a closed socket.
+func ForgetConnection(conn *websocket.Conn) {
+	writeLocks.Delete(conn)
+}
+
+func (gameManager *GameManager) GetUser(userId string) (*User, bool) {
+	gameManager.usersMu.RLock()
+	defer gameManager.usersMu.RUnlock()
+	targetUser, exist := gameManager.Users[userId]
+	return &targetUser, exist
+}
+
+func (gameManager *GameManager) SetUser(user User) {
+	gameManager.usersMu.Lock()
+	defer gameManager.usersMu.Unlock()
+	gameManager.Users[user.Id] = user
+}
+
+// SetCurrentGame moves a connected user to a game, or out of one with an
+// empty gameId. A user who left in the meantime stays gone.
+func (gameManager *GameManager) SetCurrentGame(userId string, gameId string) {
+	gameManager.usersMu.Lock()
+	defer gameManager.usersMu.Unlock()
+	if user, exist := gameManager.Users[userId]; exist {
+		user.CurrentGameId = gameId
+		gameManager.Users[userId] = user
+	}
+}
+
+func (gameManager *GameManager) RemoveUser(userId string) {
+	gameManager.usersMu.Lock()
+	defer gameManager.usersMu.Unlock()
+	delete(gameManager.Users, userId)
+}
+
+// removeUserOn forgets a user as long as they are still on conn, one who
+// resumed on a new socket in the meantime is kept.
+func (gameManager *GameManager) removeUserOn(userId string, conn *websocket.Conn) {
+	gameManager.usersMu.Lock()
+	defer gameManager.usersMu.Unlock()
+	if user, exist := gameManager.Users[userId]; exist && user.Ws == conn {
+		delete(gameManager.Users, userId)
+	}
+}
+
+// RangeUsers calls fn for every connected user. It works on a copy, so fn
+// can write to sockets and update users without holding the lock.
+func (gameManager *GameManager) RangeUsers(fn func(user User)) {
+	gameManager.usersMu.RLock()
+	users := make([]User, 0, len(gameManager.Users))
+	for _, user := range gameManager.Users {
+		users = append(users, user)
+	}
+	gameManager.usersMu.RUnlock()
+	for _, user := range users {
+		fn(user)
+	}
+}
+
+func (gameManager *GameManager) UserCount() int {
+	gameManager.usersMu.RLock()
+	defer gameManager.usersMu.RUnlock()
+	return len(gameManager.Users)
+}
+
+// ConnectionUser returns the user bound to a socket.
+func (gameManager *GameManager) ConnectionUser(conn *websocket.Conn) (string, bool) {
+	gameManager.usersMu.RLock()
+	defer gameManager.usersMu.RUnlock()
+	userId, exist := gameManager.UserConnectionMap[conn]
+	return userId, exist
+}
+
+func (gameManager *GameManager) BindConnection(conn *websocket.Conn, userId string) {
+	gameManager.usersMu.Lock()
+	defer gameManager.usersMu.Unlock()
+	gameManager.UserConnectionMap[conn] = userId
+}
+
+func (gameManager *GameManager) UnbindConnection(conn *websocket.Conn) {
+	gameManager.usersMu.Lock()
+	defer gameManager.usersMu.Unlock()
+	delete(gameManager.UserConnectionMap, conn)
+}
+
 func (user *User) SendMessage(messageType string, data map[string]interface{}) {
 	jsonByte, err := json.Marshal(map[string]interface{}{
 		"type": messageType,
@@ -21,10 +118,14 @@ func (user *User) SendMessage(messageType string, data map[string]interface{}) {
 	})
 
 	if err != nil {
-		log.Println("Error converting map into byte:", err)
+		slog.Error("error encoding message", "userId", user.Id, "type", messageType, "error", err)
+		return
 	}
 
+	lock := writeLock(user.Ws)
+	lock.Lock()
+	defer lock.Unlock()
 	if err := user.Ws.WriteMessage(int(1), jsonByte); err != nil {
-		log.Println("Error writing message:", err)
+		slog.Warn("error writing message", "userId", user.Id, "gameId", user.CurrentGameId, "type", messageType, "error", err)
 	}
 }
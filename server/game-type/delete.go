@@ -0,0 +1,42 @@
+package gametype
+
+import (
+	"flappy-bird-server/audit"
+	gameManager "flappy-bird-server/game-manager"
+	"flappy-bird-server/lib"
+	"flappy-bird-server/middleware"
+	"flappy-bird-server/model"
+	"log/slog"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+// archiveGameType hides a game type from players. Games already played on
+// it keep their foreign key, so the row itself is never deleted.
+func archiveGameType(w http.ResponseWriter, r *http.Request) {
+	gameType, err := scanGameType(lib.Pool.QueryRow(r.Context(), `UPDATE public.gametypes SET active = false, "archivedAt" = COALESCE("archivedAt", NOW()), "updatedAt" = NOW() WHERE id = $1 RETURNING `+gameTypeColumns, mux.Vars(r)["id"]))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			lib.ErrorJson(w, http.StatusNotFound, "Game type not found", "")
+			return
+		}
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	user, _ := middleware.GetUser(r)
+	event := audit.FromRequest(r, user.Id, "gametype.archive", "gametype", gameType.Id)
+	event.After = gameType
+	audit.Log(r.Context(), event)
+
+	if err := gameManager.GetInstance().InvalidateGameType(r.Context(), gameType.Id); err != nil {
+		slog.ErrorContext(r.Context(), "error invalidating game type cache", "gameTypeId", gameType.Id, "error", err)
+	}
+
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Game type archived successfully",
+		"data":    []model.GameType{gameType},
+	})
+}
@@ -3,12 +3,49 @@ package gametype
 import (
 	"flappy-bird-server/lib"
 	"flappy-bird-server/model"
+	"fmt"
 	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
 )
 
+// getGameTypes lists game types. By default only active, non archived
+// types are returned; active=false|all and includeArchived=true widen that.
 func getGameTypes(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	conditions := []string{}
+	args := []interface{}{}
+
+	switch query.Get("active") {
+	case "", "true":
+		conditions = append(conditions, "active = true")
+	case "false":
+		conditions = append(conditions, "active = false")
+	case "all":
+	default:
+		lib.ErrorJson(w, http.StatusBadRequest, "active should be true, false or all", "")
+		return
+	}
+
+	if query.Get("includeArchived") != "true" {
+		conditions = append(conditions, `"archivedAt" IS NULL`)
+	}
+
+	if currency := query.Get("currency"); currency != "" {
+		args = append(args, currency)
+		conditions = append(conditions, fmt.Sprintf("currency = $%d", len(args)))
+	}
+
+	sql := `SELECT ` + gameTypeColumns + ` FROM public.gametypes`
+	if len(conditions) > 0 {
+		sql += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	sql += ` ORDER BY "sortOrder" ASC, entry ASC`
+
 	gameTypes := []model.GameType{}
-	rows, err := lib.Pool.Query(r.Context(), `SELECT id, title, entry, winner, currency, "maxPlayer" FROM public.gametypes`)
+	rows, err := lib.Pool.Query(r.Context(), sql, args...)
 	if err != nil {
 		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
 		return
@@ -16,8 +53,8 @@ func getGameTypes(w http.ResponseWriter, r *http.Request) {
 	defer rows.Close()
 
 	for rows.Next() {
-		var i model.GameType
-		if err := rows.Scan(&i.Id, &i.Title, &i.Entry, &i.Winner, &i.Currency, &i.MaxPlayer); err != nil {
+		i, err := scanGameType(rows)
+		if err != nil {
 			lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
 			return
 		}
@@ -29,3 +66,19 @@ func getGameTypes(w http.ResponseWriter, r *http.Request) {
 	})
 
 }
+
+func getGameType(w http.ResponseWriter, r *http.Request) {
+	gameType, err := findGameType(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			lib.ErrorJson(w, http.StatusNotFound, "Game type not found", "")
+			return
+		}
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"data":    []model.GameType{gameType},
+		"message": "success",
+	})
+}
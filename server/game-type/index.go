@@ -1,22 +1,19 @@
 package gametype
 
 import (
-	"flappy-bird-server/lib"
+	"flappy-bird-server/middleware"
 	"net/http"
+
+	"github.com/gorilla/mux"
 )
 
-// func Handler(r *mux.Router) {
-// 	r.HandleFunc("/", getGameTypes).Methods("GET")
-// 	r.HandleFunc("/", addGameType).Methods("POST")
-// }
+func Handler(r *mux.Router) {
+	requireWrite := middleware.RequirePermission("gametypes:write")
 
-func Handler(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodPost {
-		addGameType(w, r)
-		return
-	} else if r.Method == http.MethodGet {
-		getGameTypes(w, r)
-		return
-	}
-	lib.ErrorJson(w, 405, "Method not allowed", "")
+	r.HandleFunc("", getGameTypes).Methods("GET")
+	r.Handle("", requireWrite(http.HandlerFunc(addGameType))).Methods("POST")
+	r.HandleFunc("/{id}", getGameType).Methods("GET")
+	r.Handle("/{id}", requireWrite(http.HandlerFunc(replaceGameType))).Methods("PUT")
+	r.Handle("/{id}", requireWrite(http.HandlerFunc(patchGameType))).Methods("PATCH")
+	r.Handle("/{id}", requireWrite(http.HandlerFunc(archiveGameType))).Methods("DELETE")
 }
@@ -1,6 +1,7 @@
 package gametype
 
 import (
+	"flappy-bird-server/audit"
 	"flappy-bird-server/lib"
 	"flappy-bird-server/middleware"
 	"flappy-bird-server/model"
@@ -10,34 +11,39 @@ import (
 )
 
 type RequestBody struct {
-	Title     string `json:"title"`
-	Entry     uint   `json:"entry"`
-	Winner    uint   `json:"winner"`
-	Currency  string `json:"currency"`
-	MaxPlayer uint   `json:"maxPlayer"`
+	Title        string `json:"title"`
+	Entry        uint   `json:"entry"`
+	Winner       uint   `json:"winner"`
+	Currency     string `json:"currency"`
+	MaxPlayer    uint   `json:"maxPlayer"`
+	MinPlayer    uint   `json:"minPlayer"`
+	LobbyTimeout uint   `json:"lobbyTimeout"`
+	Active       *bool  `json:"active"`
+	SortOrder    int    `json:"sortOrder"`
 }
 
 func addGameType(w http.ResponseWriter, r *http.Request) {
-	user, err := middleware.CheckAccess(w, r)
-	if err != nil {
-		lib.ErrorJson(w, http.StatusUnauthorized, "Unauthorized", "")
-		return
-	}
-
-	if !user.IsAdmin {
-		lib.ErrorJson(w, http.StatusUnauthorized, "Unauthorized", "")
-		return
-	}
-
+	user, _ := middleware.GetUser(r)
 	var body RequestBody
-	err = lib.ReadJsonFromBody(r, w, &body)
+	err := lib.ReadJsonFromBody(r, w, &body)
 	if err != nil {
 		lib.ErrorJson(w, http.StatusBadRequest, err.Error(), "")
 		return
 	}
 
-	if body.Currency != "INR" && body.Currency != "SOL" {
-		lib.ErrorJson(w, http.StatusUnauthorized, "Invalid currency input", "")
+	gameType := model.GameType{
+		Title:        body.Title,
+		Entry:        int(body.Entry),
+		Winner:       int(body.Winner),
+		Currency:     body.Currency,
+		MaxPlayer:    int(body.MaxPlayer),
+		MinPlayer:    int(body.MinPlayer),
+		LobbyTimeout: int(body.LobbyTimeout),
+		Active:       body.Active == nil || *body.Active,
+		SortOrder:    body.SortOrder,
+	}
+	if err := validateGameType(gameType); err != nil {
+		lib.ErrorJson(w, http.StatusBadRequest, err.Error(), "")
 		return
 	}
 
@@ -47,20 +53,22 @@ func addGameType(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var gameType model.GameType
-	err = lib.Pool.QueryRow(r.Context(), `INSERT INTO public.gametypes (id, title, entry, winner, currency, "maxPlayer") VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, title, entry, winner, currency, "maxPlayer"`, gameTypeId, body.Title, body.Entry, body.Winner, body.Currency, body.MaxPlayer).Scan(&gameType.Id, &gameType.Title, &gameType.Entry, &gameType.Winner, &gameType.Currency, &gameType.MaxPlayer)
+	gameType, err = scanGameType(lib.Pool.QueryRow(r.Context(), `INSERT INTO public.gametypes (id, title, entry, winner, currency, "maxPlayer", "minPlayer", "lobbyTimeout", active, "sortOrder") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING `+gameTypeColumns, gameTypeId, gameType.Title, gameType.Entry, gameType.Winner, gameType.Currency, gameType.MaxPlayer, gameType.MinPlayer, gameType.LobbyTimeout, gameType.Active, gameType.SortOrder))
 	if err != nil {
+		if isUniqueViolation(err) {
+			lib.ErrorJson(w, http.StatusConflict, errGameTypeExists.Error(), "")
+			return
+		}
 		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
 		return
 	}
+
+	event := audit.FromRequest(r, user.Id, "gametype.create", "gametype", gameType.Id)
+	event.After = gameType
+	audit.Log(r.Context(), event)
+
 	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
 		"message": "Game type create successfully",
-		"data": []model.GameType{{
-			Id:       gameTypeId.String(),
-			Title:    body.Title,
-			Entry:    int(body.Entry),
-			Winner:   int(body.Winner),
-			Currency: body.Currency,
-		}},
+		"data":    []model.GameType{gameType},
 	})
 }
@@ -0,0 +1,133 @@
+package gametype
+
+import (
+	"flappy-bird-server/audit"
+	gameManager "flappy-bird-server/game-manager"
+	"flappy-bird-server/lib"
+	"flappy-bird-server/middleware"
+	"flappy-bird-server/model"
+	"log/slog"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+type PatchRequestBody struct {
+	Title        *string `json:"title"`
+	Entry        *uint   `json:"entry"`
+	Winner       *uint   `json:"winner"`
+	Currency     *string `json:"currency"`
+	MaxPlayer    *uint   `json:"maxPlayer"`
+	MinPlayer    *uint   `json:"minPlayer"`
+	LobbyTimeout *uint   `json:"lobbyTimeout"`
+	Active       *bool   `json:"active"`
+	SortOrder    *int    `json:"sortOrder"`
+}
+
+func replaceGameType(w http.ResponseWriter, r *http.Request) {
+	var body RequestBody
+	if err := lib.ReadJsonFromBody(r, w, &body); err != nil {
+		lib.ErrorJson(w, http.StatusBadRequest, err.Error(), "")
+		return
+	}
+	updateGameType(w, r, func(gameType *model.GameType) {
+		gameType.Title = body.Title
+		gameType.Entry = int(body.Entry)
+		gameType.Winner = int(body.Winner)
+		gameType.Currency = body.Currency
+		gameType.MaxPlayer = int(body.MaxPlayer)
+		gameType.MinPlayer = int(body.MinPlayer)
+		gameType.LobbyTimeout = int(body.LobbyTimeout)
+		gameType.SortOrder = body.SortOrder
+		gameType.Active = body.Active == nil || *body.Active
+	})
+}
+
+func patchGameType(w http.ResponseWriter, r *http.Request) {
+	var body PatchRequestBody
+	if err := lib.ReadJsonFromBody(r, w, &body); err != nil {
+		lib.ErrorJson(w, http.StatusBadRequest, err.Error(), "")
+		return
+	}
+	updateGameType(w, r, func(gameType *model.GameType) {
+		if body.Title != nil {
+			gameType.Title = *body.Title
+		}
+		if body.Entry != nil {
+			gameType.Entry = int(*body.Entry)
+		}
+		if body.Winner != nil {
+			gameType.Winner = int(*body.Winner)
+		}
+		if body.Currency != nil {
+			gameType.Currency = *body.Currency
+		}
+		if body.MaxPlayer != nil {
+			gameType.MaxPlayer = int(*body.MaxPlayer)
+		}
+		if body.MinPlayer != nil {
+			gameType.MinPlayer = int(*body.MinPlayer)
+		}
+		if body.LobbyTimeout != nil {
+			gameType.LobbyTimeout = int(*body.LobbyTimeout)
+		}
+		if body.Active != nil {
+			gameType.Active = *body.Active
+		}
+		if body.SortOrder != nil {
+			gameType.SortOrder = *body.SortOrder
+		}
+	})
+}
+
+// updateGameType applies apply to the stored game type, validates the
+// result and saves it. Lobbies already waiting keep the price they were
+// created with.
+func updateGameType(w http.ResponseWriter, r *http.Request, apply func(gameType *model.GameType)) {
+	gameType, err := findGameType(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			lib.ErrorJson(w, http.StatusNotFound, "Game type not found", "")
+			return
+		}
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	if gameType.ArchivedAt != nil {
+		lib.ErrorJson(w, http.StatusBadRequest, "Archived game types can not be edited", "")
+		return
+	}
+
+	before := gameType
+	apply(&gameType)
+	if err := validateGameType(gameType); err != nil {
+		lib.ErrorJson(w, http.StatusBadRequest, err.Error(), "")
+		return
+	}
+
+	gameType, err = scanGameType(lib.Pool.QueryRow(r.Context(), `UPDATE public.gametypes SET title = $2, entry = $3, winner = $4, currency = $5, "maxPlayer" = $6, "minPlayer" = $7, "lobbyTimeout" = $8, active = $9, "sortOrder" = $10, "updatedAt" = NOW() WHERE id = $1 RETURNING `+gameTypeColumns, gameType.Id, gameType.Title, gameType.Entry, gameType.Winner, gameType.Currency, gameType.MaxPlayer, gameType.MinPlayer, gameType.LobbyTimeout, gameType.Active, gameType.SortOrder))
+	if err != nil {
+		if isUniqueViolation(err) {
+			lib.ErrorJson(w, http.StatusConflict, errGameTypeExists.Error(), "")
+			return
+		}
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	user, _ := middleware.GetUser(r)
+	event := audit.FromRequest(r, user.Id, "gametype.update", "gametype", gameType.Id)
+	event.Before = before
+	event.After = gameType
+	audit.Log(r.Context(), event)
+
+	if err := gameManager.GetInstance().InvalidateGameType(r.Context(), gameType.Id); err != nil {
+		slog.ErrorContext(r.Context(), "error invalidating game type cache", "gameTypeId", gameType.Id, "error", err)
+	}
+
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Game type updated successfully",
+		"data":    []model.GameType{gameType},
+	})
+}
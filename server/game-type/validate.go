@@ -0,0 +1,64 @@
+package gametype
+
+import (
+	"context"
+	"errors"
+	"flappy-bird-server/lib"
+	"flappy-bird-server/model"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const gameTypeColumns = `id, title, entry, winner, currency, "maxPlayer", "minPlayer", "lobbyTimeout", active, "sortOrder", "archivedAt"`
+
+var errGameTypeExists = errors.New("a game type with this title and currency already exists")
+
+func scanGameType(row pgx.Row) (model.GameType, error) {
+	var gameType model.GameType
+	err := row.Scan(&gameType.Id, &gameType.Title, &gameType.Entry, &gameType.Winner, &gameType.Currency, &gameType.MaxPlayer, &gameType.MinPlayer, &gameType.LobbyTimeout, &gameType.Active, &gameType.SortOrder, &gameType.ArchivedAt)
+	return gameType, err
+}
+
+func findGameType(ctx context.Context, id string) (model.GameType, error) {
+	return scanGameType(lib.Pool.QueryRow(ctx, `SELECT `+gameTypeColumns+` FROM public.gametypes WHERE id = $1`, id))
+}
+
+// validateGameType enforces the table economics: at least two players and
+// a prize the collected entries can pay for.
+func validateGameType(gameType model.GameType) error {
+	if strings.TrimSpace(gameType.Title) == "" {
+		return errors.New("title is required")
+	}
+	if gameType.Currency != "INR" && gameType.Currency != "SOL" {
+		return errors.New("Invalid currency input")
+	}
+	if gameType.Entry <= 0 {
+		return errors.New("entry should be more than 0")
+	}
+	if gameType.Winner <= 0 {
+		return errors.New("winner should be more than 0")
+	}
+	if gameType.MaxPlayer < 2 {
+		return errors.New("maxPlayer should be at least 2")
+	}
+	if gameType.Winner > gameType.Entry*gameType.MaxPlayer {
+		return errors.New("winner can not be more than entry * maxPlayer")
+	}
+	if gameType.LobbyTimeout < 0 {
+		return errors.New("lobbyTimeout can not be negative")
+	}
+	if gameType.MinPlayer != 0 && (gameType.MinPlayer < 2 || gameType.MinPlayer > gameType.MaxPlayer) {
+		return errors.New("minPlayer should be between 2 and maxPlayer")
+	}
+	if gameType.MinPlayer != 0 && gameType.LobbyTimeout == 0 {
+		return errors.New("minPlayer needs a lobbyTimeout")
+	}
+	return nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
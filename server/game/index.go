@@ -0,0 +1,12 @@
+package game
+
+import (
+	"flappy-bird-server/middleware"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+func Handler(r *mux.Router) {
+	r.Handle("/{id}/replay", middleware.Authenticate(http.HandlerFunc(getReplay))).Methods("GET")
+}
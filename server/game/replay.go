@@ -0,0 +1,77 @@
+package game
+
+import (
+	"bytes"
+	"compress/gzip"
+	"flappy-bird-server/lib"
+	"flappy-bird-server/middleware"
+	"flappy-bird-server/replay"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+// getReplay streams the NDJSON log of a finished game to its participants
+// and to staff with games:read. With verify=true the log is re-run and the
+// recomputed standings are returned instead.
+func getReplay(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.GetUser(r)
+	gameId := mux.Vars(r)["id"]
+
+	if !user.HasPermission("games:read") {
+		var participant bool
+		err := lib.Pool.QueryRow(r.Context(), `SELECT EXISTS (SELECT 1 FROM public.participants WHERE "gameId" = $1 AND "userId" = $2)`, gameId, user.Id).Scan(&participant)
+		if err != nil {
+			lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+			return
+		}
+		if !participant {
+			lib.ErrorJson(w, http.StatusForbidden, "Only participants can see this replay", "")
+			return
+		}
+	}
+
+	var compressed []byte
+	err := lib.Pool.QueryRow(r.Context(), `SELECT log FROM public.replays WHERE "gameId" = $1`, gameId).Scan(&compressed)
+	if err == pgx.ErrNoRows {
+		lib.ErrorJson(w, http.StatusNotFound, "Replay not found", "")
+		return
+	}
+	if err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	log, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	defer log.Close()
+
+	if r.URL.Query().Get("verify") == "true" {
+		events, err := replay.Decode(log)
+		if err != nil {
+			lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+			return
+		}
+		result, err := replay.Verify(events)
+		if err != nil {
+			lib.ErrorJson(w, http.StatusUnprocessableEntity, err.Error(), "")
+			return
+		}
+		lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+			"message": "success",
+			"data":    result,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, log); err != nil {
+		slog.WarnContext(r.Context(), "error streaming replay", "gameId", gameId, "error", err)
+	}
+}
@@ -0,0 +1,75 @@
+package health
+
+import (
+	"context"
+	gameManager "flappy-bird-server/game-manager"
+	"flappy-bird-server/lib"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type Check struct {
+	Ok      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+func Handler(r *mux.Router) {
+	r.HandleFunc("/healthz", liveness).Methods("GET")
+	r.HandleFunc("/readyz", readiness).Methods("GET")
+}
+
+// liveness only says the process is serving requests. Dependencies are
+// covered by readiness so a Redis outage doesn't get the pod restarted.
+func liveness(w http.ResponseWriter, r *http.Request) {
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"status": "ok",
+	})
+}
+
+func errorCheck(err error) Check {
+	if err != nil {
+		return Check{Ok: false, Message: err.Error()}
+	}
+	return Check{Ok: true}
+}
+
+func flagCheck(ok bool, message string) Check {
+	if !ok {
+		return Check{Ok: false, Message: message}
+	}
+	return Check{Ok: true}
+}
+
+// readiness fails when a dependency is down, or while the instance is
+// draining for shutdown or maintenance, so load balancers stop sending it
+// new sockets.
+func readiness(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+	instance := gameManager.GetInstance()
+
+	maintenance := instance.GetMaintenance()
+	checks := map[string]Check{
+		"postgres":     errorCheck(lib.Pool.Ping(ctx)),
+		"redis":        errorCheck(instance.RedisClient.Ping(ctx).Err()),
+		"pubsub":       flagCheck(instance.GlobalPubSubAlive(), "global subscription is not running"),
+		"queueWorkers": flagCheck(instance.RunningQueueWorkers() == gameManager.QueueWorkerCount, "queue workers are not all running"),
+		"draining":     flagCheck(!instance.IsDraining(), "instance is shutting down"),
+		"maintenance":  flagCheck(!maintenance.IsActive(time.Now()), "under maintenance"),
+	}
+
+	ready := true
+	for _, check := range checks {
+		ready = ready && check.Ok
+	}
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+	lib.WriteJson(w, status, map[string]interface{}{
+		"ready":  ready,
+		"checks": checks,
+	})
+}
@@ -0,0 +1,99 @@
+package leaderboard
+
+import (
+	gameManager "flappy-bird-server/game-manager"
+	"flappy-bird-server/lib"
+	"flappy-bird-server/middleware"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const maxLimit = 100
+
+type board struct {
+	scope  string
+	period string
+	metric string
+}
+
+// parseBoard reads gameTypeId (all by default), period (daily, weekly or
+// alltime, default alltime) and metric (wins, winnings or score, default
+// wins).
+func parseBoard(w http.ResponseWriter, query url.Values) (board, bool) {
+	selected := board{scope: query.Get("gameTypeId"), period: query.Get("period"), metric: query.Get("metric")}
+	if selected.scope == "" {
+		selected.scope = gameManager.GlobalScope
+	}
+	if selected.period == "" {
+		selected.period = "alltime"
+	}
+	if selected.metric == "" {
+		selected.metric = "wins"
+	}
+	if !gameManager.ValidLeaderboard(selected.scope, selected.period, selected.metric) {
+		lib.ErrorJson(w, http.StatusBadRequest, "period should be daily, weekly or alltime and metric wins, winnings or score. winnings need a gameTypeId", "")
+		return selected, false
+	}
+	return selected, true
+}
+
+// getLeaderboard serves one page of a leaderboard, paginated with page and
+// limit.
+func getLeaderboard(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	selected, ok := parseBoard(w, query)
+	if !ok {
+		return
+	}
+	page, limit := 1, maxLimit
+	for key, target := range map[string]*int{"page": &page, "limit": &limit} {
+		if value := query.Get(key); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 {
+				lib.ErrorJson(w, http.StatusBadRequest, key+" should be a positive number", "")
+				return
+			}
+			*target = parsed
+		}
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+
+	entries, total, err := gameManager.GetInstance().GetLeaderboard(r.Context(), selected.scope, selected.period, selected.metric, page, limit)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "success",
+		"data":    entries,
+		"page":    page,
+		"limit":   limit,
+		"total":   total,
+	})
+}
+
+// getMyRank looks up the caller on a leaderboard. Players who haven't
+// finished a game in the period get a null rank.
+func getMyRank(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.GetUser(r)
+	selected, ok := parseBoard(w, r.URL.Query())
+	if !ok {
+		return
+	}
+	entry, ranked, err := gameManager.GetInstance().LeaderboardRank(r.Context(), selected.scope, selected.period, selected.metric, user.Id)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	var data interface{}
+	if ranked {
+		data = entry
+	}
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "success",
+		"data":    data,
+	})
+}
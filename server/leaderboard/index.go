@@ -0,0 +1,13 @@
+package leaderboard
+
+import (
+	"flappy-bird-server/middleware"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+func Handler(r *mux.Router) {
+	r.HandleFunc("", getLeaderboard).Methods("GET")
+	r.Handle("/me", middleware.Authenticate(http.HandlerFunc(getMyRank))).Methods("GET")
+}
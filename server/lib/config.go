@@ -0,0 +1,37 @@
+package lib
+
+import (
+	"flappy-bird-server/config"
+	"net"
+)
+
+var settings config.Config
+var proxyNetworks []*net.IPNet
+
+// Configure hands lib the settings its helpers need: the token secret, the
+// frontend url, the Helius key and the argon2 cost. main calls it once right
+// after loading the config.
+func Configure(cfg config.Config) {
+	settings = cfg
+	// Load has already rejected invalid entries.
+	proxyNetworks, _ = cfg.ProxyNetworks()
+}
+
+// TrustedProxy tells whether ip belongs to one of TRUSTED_PROXIES.
+func TrustedProxy(ip net.IP) bool {
+	for _, network := range proxyNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenSecret signs and verifies access tokens and salts HashString.
+func TokenSecret() []byte {
+	return []byte(settings.Secret)
+}
+
+func FrontendUrl() string {
+	return settings.FrontendUrl
+}
@@ -2,24 +2,25 @@ package lib
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"os"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// AdminPublicKey is the treasury wallet that deposits are sent to. Admin
+// rights come from the user_roles table.
 const AdminPublicKey = "CVdndsAGyNj8BvLhtrQBLMtrwEgy53ACXFQmQMfH2MFQ"
 
 var Pool *pgxpool.Pool
-var UnderMaintenance = false
 
-func ConnectDB() {
+func ConnectDB(databaseUrl string) {
 	var err error
-	dsn := os.Getenv("DATABASE_URL")
-	Pool, err = pgxpool.New(context.Background(), dsn)
+	Pool, err = pgxpool.New(context.Background(), databaseUrl)
 	if err != nil {
-		log.Fatalf("Unable to connect to database: %v\n", err)
+		slog.Error("unable to connect to database", "error", err)
+		os.Exit(1)
 	}
 
-	log.Println("Connected to PostgreSQL successfully!")
+	slog.Info("connected to PostgreSQL")
 }
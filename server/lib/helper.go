@@ -1,20 +1,23 @@
 package lib
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"flappy-bird-server/model"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
 	"reflect"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
 )
 
 type jsonResponse struct {
@@ -46,7 +49,7 @@ func SetField(obj interface{}, name string, value interface{}) error {
 }
 
 func ReadJsonFromBody(r *http.Request, w http.ResponseWriter, body any) error {
-	if r.Method != http.MethodPost {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut && r.Method != http.MethodPatch && r.Method != http.MethodDelete {
 		return errors.New("method not allowed")
 	}
 
@@ -92,7 +95,7 @@ func ErrorJson(w http.ResponseWriter, status int, message string, fileName strin
 }
 
 func ErrorJsonWithCode(w http.ResponseWriter, err error, status ...int) {
-	log.Println(err.Error())
+	slog.Debug("request failed", "error", err)
 	statusCode := http.StatusBadRequest
 
 	if len(status) > 0 {
@@ -106,37 +109,40 @@ func ErrorJsonWithCode(w http.ResponseWriter, err error, status ...int) {
 	WriteJson(w, statusCode, payload)
 }
 
+// ErrorLogger logs a failure tagged with the file it used to be appended
+// to. Failures that need to be acted on go to failed_operations instead.
 func ErrorLogger(newLine string, fileName string) {
-	file, err := os.OpenFile(fileName, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
-	if err != nil {
-		fmt.Println("Error opening file:", err)
-		return
-	}
-	defer file.Close()
-
-	_, err = file.WriteString(newLine)
-	if err != nil {
-		fmt.Println("Error writing to file:", err)
-		return
-	}
+	slog.Error(strings.TrimSpace(newLine), "source", strings.TrimSuffix(fileName, ".txt"))
 }
 
 func HashString(text string) string {
 	hash := sha256.New()
-	finalString := os.Getenv("SECRET") + text
+	finalString := settings.Secret + text
 	hash.Write([]byte(finalString))
 	hashedBytes := hash.Sum(nil)
 	hashString := hex.EncodeToString(hashedBytes)
 	return hashString
 }
 
-func GenerateToken(id string) (string, error) {
-	var JWT_SECRET = []byte(os.Getenv("SECRET"))
-	expirationTime := time.Now().Add(60 * 24 * 30 * time.Minute)
+const AccessTokenTTL = 15 * time.Minute
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+func GenerateToken(id string, roles []string, permissions []string) (string, error) {
+	var JWT_SECRET = TokenSecret()
+	tokenId, err := uuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	issuedAt := time.Now()
 	claims := &model.TokenPayload{
-		Id: id,
+		Id:          id,
+		Roles:       roles,
+		Permissions: permissions,
+		IssuedAtMs:  issuedAt.UnixMilli(),
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
+			Id:        tokenId.String(),
+			IssuedAt:  issuedAt.Unix(),
+			ExpiresAt: issuedAt.Add(AccessTokenTTL).Unix(),
 		},
 	}
 
@@ -149,10 +155,26 @@ func GenerateToken(id string) (string, error) {
 	return tokenString, nil
 }
 
+// GenerateRefreshToken returns an opaque token for the client together with
+// the digest that is stored in the database.
+func GenerateRefreshToken() (string, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	return token, HashRefreshToken(token), nil
+}
+
+func HashRefreshToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
 func Stringify(data interface{}) string {
 	jsonString, err := json.Marshal(data)
 	if err != nil {
-		log.Fatal("Something went wrong while stringify ", data)
+		slog.Error("error stringifying data", "error", err)
 	}
 	return string(jsonString)
 }
@@ -0,0 +1,72 @@
+package lib
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+type logAttrsKey struct{}
+
+// InitLogger makes slog write JSON at level (debug, info, warn, error). Attributes added with WithLogAttrs are attached to every
+// record logged with that context, so one request or game can be followed
+// across the websocket, pub/sub and queue logs.
+func InitLogger(level string) {
+	logLevel := slog.LevelInfo
+	switch strings.ToLower(level) {
+	case "debug":
+		logLevel = slog.LevelDebug
+	case "warn":
+		logLevel = slog.LevelWarn
+	case "error":
+		logLevel = slog.LevelError
+	}
+	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel})
+	slog.SetDefault(slog.New(contextHandler{handler}))
+}
+
+// WithLogAttrs returns ctx carrying key/value pairs such as "gameId" and
+// "userId" for later log records. Empty values are skipped.
+func WithLogAttrs(ctx context.Context, args ...string) context.Context {
+	current := LogAttrs(ctx)
+	attrs := make(map[string]string, len(current)+len(args)/2)
+	for key, value := range current {
+		attrs[key] = value
+	}
+	for i := 0; i+1 < len(args); i += 2 {
+		if args[i+1] != "" {
+			attrs[args[i]] = args[i+1]
+		}
+	}
+	return context.WithValue(ctx, logAttrsKey{}, attrs)
+}
+
+// LogAttrs returns the attributes carried by ctx. Queue tasks store them
+// with the task so the worker can restore them.
+func LogAttrs(ctx context.Context) map[string]string {
+	if ctx == nil {
+		return nil
+	}
+	attrs, _ := ctx.Value(logAttrsKey{}).(map[string]string)
+	return attrs
+}
+
+type contextHandler struct {
+	slog.Handler
+}
+
+func (handler contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	for key, value := range LogAttrs(ctx) {
+		record.AddAttrs(slog.String(key, value))
+	}
+	return handler.Handler.Handle(ctx, record)
+}
+
+func (handler contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{handler.Handler.WithAttrs(attrs)}
+}
+
+func (handler contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{handler.Handler.WithGroup(name)}
+}
@@ -0,0 +1,129 @@
+package lib
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	MinPasswordLength = 7
+	// MaxPasswordLength only guards against absurd payloads, argon2 itself
+	// has no practical limit.
+	MaxPasswordLength = 1024
+)
+
+type Argon2Params struct {
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+var errInvalidPasswordHash = errors.New("invalid password hash")
+
+// PasswordParams returns the configured argon2id cost. The config defaults
+// to the OWASP recommended minimums.
+func PasswordParams() Argon2Params {
+	return Argon2Params{
+		Memory:  settings.Argon2Memory,
+		Time:    settings.Argon2Time,
+		Threads: settings.Argon2Threads,
+		SaltLen: 16,
+		KeyLen:  32,
+	}
+}
+
+func ValidatePassword(password string) error {
+	if len(password) < MinPasswordLength {
+		return fmt.Errorf("password length should be at least %d", MinPasswordLength)
+	}
+	if len(password) > MaxPasswordLength {
+		return fmt.Errorf("password length should be at most %d", MaxPasswordLength)
+	}
+	return nil
+}
+
+// HashPassword returns an argon2id hash in the PHC string format, with a
+// random per-user salt and the cost parameters embedded.
+func HashPassword(password string) (string, error) {
+	params := PasswordParams()
+	salt := make([]byte, params.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, params.KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		params.Memory,
+		params.Time,
+		params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func decodePasswordHash(encoded string) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, errInvalidPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errInvalidPasswordHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return params, nil, nil, errInvalidPasswordHash
+	}
+	// argon2 panics on a zero cost, a stored hash should never carry one.
+	if params.Memory == 0 || params.Time == 0 || params.Threads == 0 {
+		return params, nil, nil, errInvalidPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, errInvalidPasswordHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, errInvalidPasswordHash
+	}
+	params.SaltLen = uint32(len(salt))
+	params.KeyLen = uint32(len(key))
+	return params, salt, key, nil
+}
+
+// VerifyPassword compares password against a stored hash. Legacy
+// HashString digests are still accepted, and needsRehash reports whether the
+// caller should replace the stored hash, either because it is legacy or
+// because the configured cost changed since it was written.
+func VerifyPassword(password string, encoded string) (valid bool, needsRehash bool, err error) {
+	if !strings.HasPrefix(encoded, "$argon2id$") {
+		legacy := HashString(password)
+		valid = subtle.ConstantTimeCompare([]byte(legacy), []byte(encoded)) == 1
+		return valid, valid, nil
+	}
+
+	params, salt, key, err := decodePasswordHash(encoded)
+	if err != nil {
+		return false, false, err
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, params.KeyLen)
+	if subtle.ConstantTimeCompare(candidate, key) != 1 {
+		return false, false, nil
+	}
+
+	current := PasswordParams()
+	needsRehash = params.Memory != current.Memory || params.Time != current.Time || params.Threads != current.Threads
+	return true, needsRehash, nil
+}
@@ -0,0 +1,38 @@
+package lib
+
+import (
+	"context"
+)
+
+const RoleAdmin = "admin"
+
+// GetUserRoles loads the roles granted to a user and the union of the
+// permissions those roles carry.
+func GetUserRoles(ctx context.Context, userId string) ([]string, []string, error) {
+	roles := []string{}
+	permissions := []string{}
+
+	rows, err := Pool.Query(ctx, `SELECT ur.role, COALESCE(rp.permission, '') FROM public.user_roles ur LEFT JOIN public.role_permissions rp ON rp.role = ur.role WHERE ur."userId" = $1 ORDER BY ur.role, rp.permission`, userId)
+	if err != nil {
+		return roles, permissions, err
+	}
+	defer rows.Close()
+
+	seenRoles := map[string]bool{}
+	seenPermissions := map[string]bool{}
+	for rows.Next() {
+		var role, permission string
+		if err := rows.Scan(&role, &permission); err != nil {
+			return roles, permissions, err
+		}
+		if !seenRoles[role] {
+			seenRoles[role] = true
+			roles = append(roles, role)
+		}
+		if permission != "" && !seenPermissions[permission] {
+			seenPermissions[permission] = true
+			permissions = append(permissions, permission)
+		}
+	}
+	return roles, permissions, rows.Err()
+}
@@ -0,0 +1,86 @@
+package lib
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/mr-tron/base58/base58"
+)
+
+const SiwsNonceTTL = 5 * time.Minute
+
+type SiwsMessage struct {
+	Domain         string
+	Address        string
+	Statement      string
+	URI            string
+	Version        string
+	ChainId        string
+	Nonce          string
+	IssuedAt       time.Time
+	ExpirationTime time.Time
+}
+
+// String renders the message in the Sign-In With Solana text format, the
+// exact bytes the wallet is asked to sign.
+func (m SiwsMessage) String() string {
+	return fmt.Sprintf("%s wants you to sign in with your Solana account:\n%s\n\n%s\n\nURI: %s\nVersion: %s\nChain ID: %s\nNonce: %s\nIssued At: %s\nExpiration Time: %s",
+		m.Domain,
+		m.Address,
+		m.Statement,
+		m.URI,
+		m.Version,
+		m.ChainId,
+		m.Nonce,
+		m.IssuedAt.UTC().Format(time.RFC3339),
+		m.ExpirationTime.UTC().Format(time.RFC3339),
+	)
+}
+
+func GenerateNonce() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(nonce), nil
+}
+
+func SiwsDomain() string {
+	frontendUrl, err := url.Parse(FrontendUrl())
+	if err != nil || frontendUrl.Host == "" {
+		return FrontendUrl()
+	}
+	return frontendUrl.Host
+}
+
+func NewSiwsMessage(address string, nonce string) SiwsMessage {
+	issuedAt := time.Now()
+	return SiwsMessage{
+		Domain:         SiwsDomain(),
+		Address:        address,
+		Statement:      "Sign in to Mari Arena",
+		URI:            FrontendUrl(),
+		Version:        "1",
+		ChainId:        "devnet",
+		Nonce:          nonce,
+		IssuedAt:       issuedAt,
+		ExpirationTime: issuedAt.Add(SiwsNonceTTL),
+	}
+}
+
+// VerifySiwsSignature checks an ed25519 signature over message against a
+// base58 encoded Solana public key.
+func VerifySiwsSignature(address string, message string, signature []uint8) bool {
+	publicKey, err := base58.Decode(address)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return false
+	}
+	if len(signature) != ed25519.SignatureSize {
+		return false
+	}
+	return ed25519.Verify(publicKey, []byte(message), signature)
+}
@@ -6,9 +6,8 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
 )
 
 type Meta struct {
@@ -46,7 +45,7 @@ type AccountKey struct {
 
 func GetTransaction(signature string) (*SimpleTransaction, error) {
 	// url := fmt.Sprintf("https://solana-devnet.g.alchemy.com/v2/%s", os.Getenv("ALCHEMY_API_KEY"))
-	url := fmt.Sprintf("https://devnet.helius-rpc.com/?api-key=%s", os.Getenv("HELIUS_API_KEY"))
+	url := fmt.Sprintf("https://devnet.helius-rpc.com/?api-key=%s", settings.HeliusApiKey)
 
 	requestBody := map[string]interface{}{
 		"jsonrpc": "2.0",
@@ -66,7 +65,7 @@ func GetTransaction(signature string) (*SimpleTransaction, error) {
 	if err := json.NewDecoder(resp.Body).Decode(&rpcResponse); err != nil {
 		return nil, err
 	}
-	log.Println(rpcResponse)
+	slog.Debug("solana rpc response", "signature", signature, "response", rpcResponse)
 
 	from := rpcResponse.Result.Transaction.Message.AccountKeys[0].Pubkey
 	to := rpcResponse.Result.Transaction.Message.AccountKeys[1].Pubkey
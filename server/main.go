@@ -5,13 +5,20 @@ import (
 	"encoding/json"
 	"flappy-bird-server/admin"
 	"flappy-bird-server/auth"
+	"flappy-bird-server/config"
+	"flappy-bird-server/game"
 	gameManager "flappy-bird-server/game-manager"
 	gametype "flappy-bird-server/game-type"
+	"flappy-bird-server/health"
+	"flappy-bird-server/leaderboard"
 	"flappy-bird-server/lib"
+	"flappy-bird-server/metrics"
+	"flappy-bird-server/middleware"
+	"flappy-bird-server/tournament"
 	"flappy-bird-server/transaction"
 	"flappy-bird-server/user"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -19,10 +26,10 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
-	"github.com/joho/godotenv"
 )
 
 var upgrader = websocket.Upgrader{
@@ -30,40 +37,46 @@ var upgrader = websocket.Upgrader{
 	WriteBufferSize: 1024,
 	CheckOrigin: func(r *http.Request) bool {
 		origin := r.Header.Get("origin")
-		return origin == os.Getenv("FRONTEND_URL")
+		return origin == lib.FrontendUrl()
 	},
 }
 
 func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Println("Failed to upgrade:", err)
+		slog.WarnContext(r.Context(), "failed to upgrade websocket", "error", err)
 		return
 	}
 	defer conn.Close()
+	metrics.WebsocketConnections.Inc()
+	defer metrics.WebsocketConnections.Dec()
+
+	// The session context outlives the upgrade request, so it hangs off the
+	// manager's context and only keeps the ids for logging.
+	sessionCtx := lib.WithLogAttrs(gameManager.GetInstance().Context, "wsSession", uuid.NewString(), "requestId", r.Header.Get("X-Request-Id"))
+	slog.InfoContext(sessionCtx, "websocket connected")
 
 	for {
 		_, message, err := conn.ReadMessage()
 		gameInstance := gameManager.GetInstance()
 		if err != nil {
-			targetUserId, exist := gameInstance.UserConnectionMap[conn]
-			if exist {
-				delete(gameInstance.UserConnectionMap, conn)
-				gameInstance.DeleteUser(targetUserId)
-				// gameInstance.GameQueue.Enqueue(gameInstance.Context, map[string]interface{}{
-				// 	"type": "delete-user",
-				// 	"data": map[string]string{
-				// 		"userId": targetUserId,
-				// 	},
-				// })
-			}
+			slog.InfoContext(sessionCtx, "websocket disconnected", "error", err)
+			gameInstance.StopSpectating(sessionCtx, conn)
+			defer gameManager.ForgetConnection(conn)
+			gameInstance.Disconnect(sessionCtx, conn)
+			// gameInstance.GameQueue.Enqueue(gameInstance.Context, map[string]interface{}{
+			// 	"type": "delete-user",
+			// 	"data": map[string]string{
+			// 		"userId": targetUserId,
+			// 	},
+			// })
 			break
 		}
 
 		m := make(map[string]interface{})
 		err = json.Unmarshal(message, &m)
 		if err != nil {
-			log.Println("Error message:", err.Error())
+			slog.WarnContext(sessionCtx, "invalid websocket message", "error", err)
 			return
 		}
 
@@ -71,90 +84,211 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		messageData, ok := m["data"].(map[string]interface{})
 
 		if !ok {
-			log.Println("Something went wrong while parsing message data.")
+			slog.WarnContext(sessionCtx, "websocket message without data", "messageType", messageType)
 			return
 		}
-		log.Println("messageType", messageType)
+		// A socket acts as the user it signed in as, whatever userId the
+		// message carries.
+		messageUserId, _ := gameInstance.ConnectionUser(conn)
+		messageData["userId"] = messageUserId
+		messageGameId, _ := messageData["gameId"].(string)
+		ctx := lib.WithLogAttrs(sessionCtx, "userId", messageUserId, "gameId", messageGameId)
+		slog.DebugContext(ctx, "websocket message received", "messageType", messageType)
+		switch messageType {
+		case "add-user", "resume", "join-random-game", "create-private-game", "join-private-game", "start-private-game", "leave-lobby", "update-board", "game-over", "spectate", "stop-spectating", "tournament-status":
+			metrics.WebsocketMessages.WithLabelValues(messageType.(string)).Inc()
+		default:
+			metrics.WebsocketMessages.WithLabelValues("unknown").Inc()
+		}
+		switch messageType {
+		case "join-random-game", "create-private-game", "join-private-game", "start-private-game", "leave-lobby", "update-board", "game-over":
+			if messageUserId == "" {
+				slog.WarnContext(ctx, "message from a socket that is not signed in dropped", "messageType", messageType)
+				continue
+			}
+		}
 		switch messageType {
 		case "add-user":
-			gameInstance.AddUser(messageData["userId"].(string), messageData["publicKey"].(string), conn)
+			token, _ := messageData["token"].(string)
+			claims, err := middleware.VerifyToken(ctx, token)
+			if err != nil {
+				slog.InfoContext(ctx, "websocket sign in rejected", "error", err)
+				client := gameManager.User{Ws: conn}
+				client.SendMessage("error", map[string]interface{}{
+					"message": "Unauthorized",
+				})
+				break
+			}
+			sessionCtx = lib.WithLogAttrs(sessionCtx, "userId", claims.Id)
+			publicKey, _ := messageData["publicKey"].(string)
+			gameInstance.AddUser(claims.Id, publicKey, conn)
+		case "resume":
+			token, _ := messageData["token"].(string)
+			if err := gameInstance.Resume(ctx, conn, token); err != nil {
+				slog.InfoContext(ctx, "could not resume session", "error", err)
+				client := gameManager.User{Ws: conn}
+				client.SendMessage("error", map[string]interface{}{
+					"message": err.Error(),
+				})
+			} else {
+				resumedUserId, _ := gameInstance.ConnectionUser(conn)
+				sessionCtx = lib.WithLogAttrs(sessionCtx, "userId", resumedUserId)
+			}
 		case "join-random-game":
-			if lib.UnderMaintenance {
+			if gameInstance.IsDraining() {
+				targetUser, exist := gameInstance.GetUser(messageData["userId"].(string))
+				if exist {
+					targetUser.SendMessage("error", map[string]interface{}{
+						"message": "Server is restarting, please try again in a moment",
+					})
+				}
+			} else if gameInstance.IsUnderMaintenance() {
 				targetUser, exist := gameInstance.GetUser(messageData["userId"].(string))
 				if exist {
 					targetUser.SendMessage("error", map[string]interface{}{
-						"message": "We are under maintenance please try after some time",
+						"message": gameInstance.GetMaintenance().Message,
 					})
 				}
 			} else {
-				log.Println("joining game", messageData["userId"].(string))
-				gameInstance.GameQueue.Enqueue(gameInstance.Context, map[string]interface{}{
+				slog.InfoContext(ctx, "user requested a game", "gameTypeId", messageData["gameTypeId"])
+				gameInstance.GameQueue.Enqueue(ctx, map[string]interface{}{
 					"type": "join-game",
 					"data": messageData,
 				})
 			}
+		case "create-private-game", "join-private-game", "start-private-game":
+			gameInstance.GameQueue.Enqueue(ctx, map[string]interface{}{
+				"type": messageType,
+				"data": messageData,
+			})
+		case "leave-lobby":
+			gameInstance.GameQueue.Enqueue(ctx, map[string]interface{}{
+				"type": "leave-lobby",
+				"data": map[string]interface{}{
+					"userId": messageUserId,
+				},
+			})
+		case "spectate":
+			if err := gameInstance.Spectate(ctx, conn, messageGameId); err != nil {
+				slog.InfoContext(ctx, "could not spectate game", "error", err)
+				spectator := gameManager.User{Ws: conn}
+				spectator.SendMessage("error", map[string]interface{}{
+					"message": err.Error(),
+				})
+			}
+		case "stop-spectating":
+			gameInstance.StopSpectating(ctx, conn)
+		case "tournament-status":
+			tournamentId, _ := messageData["tournamentId"].(string)
+			client := gameManager.User{Ws: conn}
+			if err := gameInstance.SendTournamentStatus(ctx, client, tournamentId); err != nil {
+				slog.InfoContext(ctx, "could not send tournament status", "tournamentId", tournamentId, "error", err)
+				client.SendMessage("error", map[string]interface{}{
+					"message": "Tournament not found",
+				})
+			}
 		case "update-board":
-			gameInstance.RedisClient.Publish(gameInstance.Context, messageData["gameId"].(string), string(message))
+			if !gameInstance.IsPlayer(conn, messageUserId, messageGameId) {
+				slog.WarnContext(ctx, "score update from a non player dropped")
+				break
+			}
+			gameInstance.RecordInput(ctx, messageGameId, messageUserId, "update-board")
+			gameInstance.RecordScore(ctx, messageGameId, messageUserId)
+			payload, _ := json.Marshal(map[string]interface{}{
+				"type": "update-board",
+				"data": messageData,
+			})
+			gameInstance.RedisClient.Publish(gameInstance.Context, messageGameId, string(payload))
 		case "game-over":
+			if !gameInstance.IsPlayer(conn, messageUserId, messageGameId) {
+				slog.WarnContext(ctx, "game over from a non player dropped")
+				break
+			}
+			gameInstance.RecordInput(ctx, messageGameId, messageUserId, "game-over")
 			messageData["pid"] = os.Getpid()
 			payload, _ := json.Marshal(map[string]interface{}{
 				"type": "game-over",
 				"data": messageData,
 			})
-			gameInstance.RedisClient.Publish(gameInstance.Context, messageData["gameId"].(string), string(payload))
+			gameInstance.RedisClient.Publish(gameInstance.Context, messageGameId, string(payload))
 		default:
-			log.Println("Unknown message type:", messageType)
+			slog.WarnContext(ctx, "unknown websocket message type", "messageType", messageType)
 		}
-		log.Println("Message processed")
 	}
 }
 
 func main() {
-	err := godotenv.Load(".env")
+	cfg, args, err := config.Load(os.Args[1:])
 	if err != nil {
-		log.Fatalf("Error loading .env file")
+		slog.Error("invalid configuration", "error", err)
+		os.Exit(2)
 	}
+	lib.InitLogger(cfg.LogLevel)
+	lib.Configure(cfg)
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "config":
+			fmt.Print(cfg)
+			return
+		case "failed-ops":
+			os.Exit(runFailedOps(cfg, args[1:]))
+		}
+	}
+	slog.Info("configuration loaded", "config", cfg)
 
 	var wg sync.WaitGroup
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
+	lib.ConnectDB(cfg.DatabaseUrl)
+
 	ctx, cancel := context.WithCancel(context.Background())
-	gameManager.InitiateInstance(ctx, wg)
+	gameManager.InitiateInstance(ctx, &wg, cfg)
 
 	defer gameManager.GetInstance().RedisClient.Close()
 
-	lib.ConnectDB()
 	r := mux.NewRouter()
 
-	r.HandleFunc("/api/transaction", transaction.Handler)
-	r.HandleFunc("/api/game-types", gametype.Handler)
+	r.HandleFunc("/api/transaction", transaction.Handler(cfg.HeliusSecret))
 	r.HandleFunc("/pid", func(w http.ResponseWriter, r *http.Request) {
-		log.Println(os.Getppid())
+		slog.InfoContext(r.Context(), "pid", "pid", os.Getpid(), "ppid", os.Getppid())
 	})
 
 	r.HandleFunc("/ws", handleWebSocket)
+	health.Handler(r)
+	r.Handle("/metrics", metrics.Handler(cfg.MetricsToken)).Methods("GET")
+	r.Use(metrics.Middleware)
 
 	api := r.PathPrefix("/api").Subrouter()
 	userRouter := api.PathPrefix("/user").Subrouter()
 	authRouter := api.PathPrefix("/auth").Subrouter()
 	adminRouter := api.PathPrefix("/admin").Subrouter()
+	gameTypeRouter := api.PathPrefix("/game-types").Subrouter()
+	gameRouter := api.PathPrefix("/games").Subrouter()
+	leaderboardRouter := api.PathPrefix("/leaderboards").Subrouter()
+	tournamentRouter := api.PathPrefix("/tournaments").Subrouter()
+
+	adminRouter.Use(middleware.Authenticate)
 
 	user.Handler(userRouter)
 	auth.Handler(authRouter)
 	admin.Handler(adminRouter)
+	gametype.Handler(gameTypeRouter)
+	game.Handler(gameRouter)
+	leaderboard.Handler(leaderboardRouter)
+	tournament.Handler(tournamentRouter)
 
 	corsHandler := handlers.CORS(
-		handlers.AllowedOrigins([]string{os.Getenv("FRONTEND_URL")}),
-		handlers.AllowedMethods([]string{"GET", "POST", "OPTIONS"}),
-		handlers.AllowedHeaders([]string{"Origin", "Content-Type", "Authorization"}),
+		handlers.AllowedOrigins([]string{cfg.FrontendUrl}),
+		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}),
+		handlers.AllowedHeaders([]string{"Origin", "Content-Type", "Authorization", "X-Request-Id"}),
+		handlers.ExposedHeaders([]string{"X-Request-Id"}),
 	)(r)
 
-	loggingHandler := handlers.LoggingHandler(os.Stdout, corsHandler)
-
 	server := &http.Server{
-		Addr:    ":8080",
-		Handler: loggingHandler,
+		Addr:    cfg.ListenAddr,
+		Handler: middleware.Logger(corsHandler),
 	}
 
 	wg.Add(1)
@@ -166,27 +300,34 @@ func main() {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		fmt.Println("WebSocket server listening on :8080")
-		if err := server.ListenAndServe(); err != nil {
-			log.Fatal("ListenAndServe error:", err)
+		slog.Info("server listening", "addr", server.Addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("error serving http", "error", err)
+			os.Exit(1)
 		}
 	}()
 
 	<-stop
-	fmt.Println("Shutting down services...")
+	slog.Info("shutting down services")
 
-	cancel()
+	// Games get SHUTDOWN_TIMEOUT to finish, the rest are refunded before the
+	// queue workers drain and stop.
+	gameCtx, gameCancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer gameCancel()
+	gameManager.GetInstance().Shutdown(gameCtx)
 
 	serverCtx, serverCancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer serverCancel()
 	if err := server.Shutdown(serverCtx); err != nil {
-		fmt.Printf("Server forced to shutdown: %v\n", err)
+		slog.Warn("server forced to shutdown", "error", err)
 	} else {
-		fmt.Println("Server gracefully stopped")
+		slog.Info("server gracefully stopped")
 	}
 
+	cancel()
+
 	wg.Wait()
-	fmt.Println("All background tasks completed. Exiting.")
+	slog.Info("all background tasks completed, exiting")
 }
 
 // nodemon --exec go run main.go --signal SIGTERM
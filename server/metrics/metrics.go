@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "mari_arena"
+
+// Labels only ever carry bounded values such as task types, game type ids
+// and route templates, never user ids.
+var (
+	WebsocketConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "websocket_connections",
+		Help:      "Open websocket connections on this instance.",
+	})
+	WebsocketMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_messages_total",
+		Help:      "Websocket messages received, by message type.",
+	}, []string{"type"})
+
+	GamesStarted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "games_started_total",
+		Help:      "Games that filled up and started.",
+	}, []string{"game_type"})
+	GamesFinished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "games_finished_total",
+		Help:      "Games that left this instance, by outcome.",
+	}, []string{"game_type", "outcome"})
+
+	QueueTasks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "queue_tasks_total",
+		Help:      "Queue tasks processed, by result.",
+	}, []string{"queue", "task", "result"})
+	QueueTaskDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "queue_task_duration_seconds",
+		Help:      "Time spent running a queue task.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"queue", "task"})
+
+	BalanceChanges = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "balance_changes_total",
+		Help:      "Committed balance changes, by kind (entry, prize, refund, deposit).",
+	}, []string{"kind"})
+	BalanceAmount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "balance_amount_lamports_total",
+		Help:      "Absolute amount moved by committed balance changes, by kind.",
+	}, []string{"kind"})
+
+	SolanaWebhooks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "solana_webhooks_total",
+		Help:      "Helius deposit webhooks, by result.",
+	}, []string{"result"})
+
+	HttpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests, by route template, method and status code.",
+	}, []string{"route", "method", "code"})
+	HttpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency, by route template and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+)
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	recorder.status = status
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+// Middleware records every routed request under its route template, so
+// /api/admin/games/{id} stays a single series.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		if route == "/ws" {
+			// Websocket handlers run for the whole session.
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		HttpRequests.WithLabelValues(route, r.Method, strconv.Itoa(recorder.status)).Inc()
+		HttpRequestDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// Handler serves the registry in Prometheus text format. When token is set
+// scrapers have to send it as a bearer token.
+func Handler(token string) http.Handler {
+	metricsHandler := promhttp.Handler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+		metricsHandler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"context"
+	gameManager "flappy-bird-server/game-manager"
+	"flappy-bird-server/lib"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const UserCacheTTL = 30 * time.Second
+
+type contextKey string
+
+const userContextKey contextKey = "user"
+
+func GetUser(r *http.Request) (User, bool) {
+	user, ok := r.Context().Value(userContextKey).(User)
+	return user, ok
+}
+
+func WithUser(r *http.Request, user User) *http.Request {
+	ctx := lib.WithLogAttrs(r.Context(), "userId", user.Id)
+	return r.WithContext(context.WithValue(ctx, userContextKey, user))
+}
+
+func userCacheKey(userId string) string {
+	return fmt.Sprintf("mr-user-%s", userId)
+}
+
+// loadUser reads the user record through a short lived Redis cache so that
+// authenticated routes don't hit Postgres on every request. Only the
+// identity is cached, it doesn't change once the account exists. Roles come
+// from the token and balances are left out, handlers that show them read
+// them from Postgres.
+func loadUser(ctx context.Context, userId string) (User, error) {
+	var user User
+	client := gameManager.GetInstance().RedisClient
+	cached, err := client.Get(ctx, userCacheKey(userId)).Result()
+	if err == nil && gameManager.Parse(cached, &user) == nil {
+		return user, nil
+	}
+
+	err = lib.Pool.QueryRow(ctx, `SELECT id, name, email FROM public.users WHERE id = $1`, userId).Scan(&user.Id, &user.Name, &user.Email)
+	if err != nil {
+		return User{}, err
+	}
+	client.Set(ctx, userCacheKey(userId), lib.Stringify(user), UserCacheTTL)
+	return user, nil
+}
+
+func writeAuthError(w http.ResponseWriter, err error) {
+	if err == ErrInternal {
+		lib.ErrorJsonWithCode(w, err, http.StatusInternalServerError)
+		return
+	}
+	lib.ErrorJsonWithCode(w, ErrUnauthorized, http.StatusUnauthorized)
+}
+
+// Authenticate resolves the bearer token once per request and stores the
+// user in the request context for the handlers behind it.
+func Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		user, err := CheckAccess(w, r)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+		next.ServeHTTP(w, WithUser(r, user))
+	})
+}
@@ -1,36 +1,64 @@
 package middleware
 
 import (
+	"context"
 	"errors"
 	"flappy-bird-server/lib"
 	"flappy-bird-server/model"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
 	"strings"
 
 	"github.com/golang-jwt/jwt"
+	"github.com/jackc/pgx/v5"
 )
 
+var ErrUnauthorized = errors.New("unauthorized")
+var ErrInternal = errors.New("internal server error")
+
 type User struct {
-	IsAdmin       bool   `json:"isAdmin"`
-	Id            string `json:"id"`
-	Name          string `json:"name"`
-	Email         string `json:"email"`
-	INRBalance    uint   `json:"inrBalance"`
-	SolanaBalance uint   `json:"solanaBalance"`
+	IsAdmin       bool     `json:"isAdmin"`
+	Id            string   `json:"id"`
+	Name          string   `json:"name"`
+	Email         string   `json:"email"`
+	INRBalance    uint     `json:"inrBalance"`
+	SolanaBalance uint     `json:"solanaBalance"`
+	Roles         []string `json:"roles"`
+	Permissions   []string `json:"permissions"`
 }
 
-func CheckAccess(w http.ResponseWriter, r *http.Request) (User, error) {
+func (user *User) HasRole(role string) bool {
+	for _, r := range user.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (user *User) HasPermission(permission string) bool {
+	for _, p := range user.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func ParseToken(r *http.Request) (*model.TokenPayload, error) {
 	tokenArr := strings.Split(r.Header.Get("Authorization"), " ")
 	if len(tokenArr) < 2 {
-		return User{}, errors.New("unauthorized")
+		return nil, ErrUnauthorized
 	}
-	tokenString := tokenArr[1]
+	return VerifyToken(r.Context(), tokenArr[1])
+}
 
+// VerifyToken checks an access token that didn't come in a header, like
+// the one a websocket signs in with.
+func VerifyToken(ctx context.Context, tokenString string) (*model.TokenPayload, error) {
 	if tokenString == "" {
-		return User{}, errors.New("unauthorized")
+		return nil, ErrUnauthorized
 	}
 
 	claims := &model.TokenPayload{}
@@ -39,23 +67,54 @@ func CheckAccess(w http.ResponseWriter, r *http.Request) (User, error) {
 		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
 		}
-		return []byte(os.Getenv("SECRET")), nil
+		return lib.TokenSecret(), nil
 
 	}))
 	if err != nil {
-		return User{}, err
+		return nil, err
 	}
 	if !token.Valid {
-		return User{}, errors.New("unauthorized")
+		return nil, ErrUnauthorized
+	}
+	// Tokens from before short-lived access tokens carry no id and can't be
+	// revoked one by one, so they are no longer accepted.
+	if claims.StandardClaims.Id == "" {
+		return nil, ErrUnauthorized
 	}
-	var user User
-	err = lib.Pool.QueryRow(r.Context(), `SELECT id, name, email, "inrBalance", "solanaBalance" FROM public.users WHERE id = $1`, claims.Id).Scan(&user.Id, &user.Name, &user.Email, &user.INRBalance, &user.SolanaBalance)
+
+	revoked, err := isTokenRevoked(ctx, claims)
+	if err != nil {
+		slog.ErrorContext(ctx, "error checking token revocation", "error", err)
+		return nil, ErrInternal
+	}
+	if revoked {
+		return nil, ErrUnauthorized
+	}
+	return claims, nil
+}
+
+// CheckAccess returns the user stored by Authenticate, or authenticates the
+// request itself for handlers mounted outside an authenticated router.
+func CheckAccess(w http.ResponseWriter, r *http.Request) (User, error) {
+	if user, ok := GetUser(r); ok {
+		return user, nil
+	}
+
+	claims, err := ParseToken(r)
 	if err != nil {
-		log.Println(err.Error())
-		return User{}, errors.New("internal server error")
+		return User{}, err
+	}
+	user, err := loadUser(r.Context(), claims.Id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// The account was deleted after the token was issued.
+		return User{}, ErrUnauthorized
 	}
-	if user.Email == lib.AdminPublicKey {
-		user.IsAdmin = true
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error loading user", "userId", claims.Id, "error", err)
+		return User{}, ErrInternal
 	}
+	user.Roles = claims.Roles
+	user.Permissions = claims.Permissions
+	user.IsAdmin = user.HasRole(lib.RoleAdmin)
 	return user, nil
 }
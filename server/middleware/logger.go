@@ -1,13 +1,67 @@
 package middleware
 
 import (
-	"log"
+	"bufio"
+	"errors"
+	"flappy-bird-server/lib"
+	"log/slog"
+	"net"
 	"net/http"
+	"time"
+
+	"github.com/google/uuid"
 )
 
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (recorder *responseRecorder) WriteHeader(status int) {
+	recorder.status = status
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+// Hijack lets the websocket upgrade through the recorder.
+func (recorder *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := recorder.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	recorder.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// Logger gives every request an id, reusing X-Request-Id when the proxy
+// already set one, and logs it once it is done. The id is echoed back and
+// carried by the request context.
 func Logger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("%s %s", r.Method, r.URL.Path)
-		next.ServeHTTP(w, r)
+		requestId := r.Header.Get("X-Request-Id")
+		if requestId == "" {
+			requestId = uuid.NewString()
+			r.Header.Set("X-Request-Id", requestId)
+		}
+		w.Header().Set("X-Request-Id", requestId)
+		r = r.WithContext(lib.WithLogAttrs(r.Context(), "requestId", requestId))
+
+		start := time.Now()
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		level := slog.LevelInfo
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			// Probes hit these every few seconds.
+			level = slog.LevelDebug
+		}
+		if recorder.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.Log(r.Context(), level, "http request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.status,
+			"duration", time.Since(start).Milliseconds(),
+		)
 	})
 }
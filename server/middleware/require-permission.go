@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"errors"
+	"flappy-bird-server/lib"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+var ErrForbidden = errors.New("forbidden")
+
+// RequirePermission only lets the request through when the caller's token
+// carries every listed permission.
+func RequirePermission(permissions ...string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := GetUser(r)
+			if !ok {
+				var err error
+				user, err = CheckAccess(w, r)
+				if err != nil {
+					writeAuthError(w, err)
+					return
+				}
+				r = WithUser(r, user)
+			}
+
+			for _, permission := range permissions {
+				if !user.HasPermission(permission) {
+					lib.ErrorJsonWithCode(w, ErrForbidden, http.StatusForbidden)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"context"
+	gameManager "flappy-bird-server/game-manager"
+	"flappy-bird-server/lib"
+	"flappy-bird-server/model"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func denylistKey(tokenId string) string {
+	return fmt.Sprintf("mr-token-denylist-%s", tokenId)
+}
+
+func revokedBeforeKey(userId string) string {
+	return fmt.Sprintf("mr-token-revoked-before-%s", userId)
+}
+
+// RevokeToken denylists a single access token until it would have expired
+// on its own.
+func RevokeToken(ctx context.Context, claims *model.TokenPayload) error {
+	ttl := time.Until(time.Unix(claims.ExpiresAt, 0))
+	if ttl <= 0 || claims.StandardClaims.Id == "" {
+		return nil
+	}
+	return gameManager.GetInstance().RedisClient.Set(ctx, denylistKey(claims.StandardClaims.Id), 1, ttl).Err()
+}
+
+// RevokeAllTokens signs the user out everywhere: every refresh token family
+// is revoked and every access token issued up to now is rejected. The
+// marker only has to outlive the access tokens, ParseToken rejects the
+// legacy ones that carry no id.
+func RevokeAllTokens(ctx context.Context, userId string) error {
+	_, err := lib.Pool.Exec(ctx, `UPDATE public.refresh_tokens SET "revokedAt" = NOW() WHERE "userId" = $1 AND "revokedAt" IS NULL`, userId)
+	if err != nil {
+		return err
+	}
+	return gameManager.GetInstance().RedisClient.Set(ctx, revokedBeforeKey(userId), time.Now().UnixMilli(), lib.AccessTokenTTL).Err()
+}
+
+func isTokenRevoked(ctx context.Context, claims *model.TokenPayload) (bool, error) {
+	client := gameManager.GetInstance().RedisClient
+	if claims.StandardClaims.Id != "" {
+		exists, err := client.Exists(ctx, denylistKey(claims.StandardClaims.Id)).Result()
+		if err != nil {
+			return false, err
+		}
+		if exists > 0 {
+			return true, nil
+		}
+	}
+
+	revokedBefore, err := client.Get(ctx, revokedBeforeKey(claims.Id)).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	timestamp, err := strconv.ParseInt(revokedBefore, 10, 64)
+	if err != nil {
+		return false, nil
+	}
+	return claims.IssuedAtMs <= timestamp, nil
+}
@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 type GameType struct {
 	Id        string `json:"id"`
 	Title     string `json:"title"`
@@ -7,4 +9,12 @@ type GameType struct {
 	Winner    int    `json:"winner"`
 	Currency  string `json:"currency"`
 	MaxPlayer int    `json:"maxPlayer"`
+	// MinPlayer lets a lobby start early with a pro-rated prize once it has
+	// waited LobbyTimeout seconds; lobbies still short of it are closed then.
+	// 0 disables either.
+	MinPlayer    int        `json:"minPlayer"`
+	LobbyTimeout int        `json:"lobbyTimeout"`
+	Active       bool       `json:"active"`
+	SortOrder    int        `json:"sortOrder"`
+	ArchivedAt   *time.Time `json:"archivedAt,omitempty"`
 }
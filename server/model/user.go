@@ -22,6 +22,11 @@ type User struct {
 }
 
 type TokenPayload struct {
-	Id string `json:"id"`
+	Id          string   `json:"id"`
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+	// IssuedAtMs is iat in milliseconds, sign-out-everywhere needs to tell
+	// apart tokens issued in the same second.
+	IssuedAtMs int64 `json:"iatMs"`
 	jwt.StandardClaims
 }
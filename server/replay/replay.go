@@ -0,0 +1,59 @@
+// Package replay defines the log a match leaves behind and re-runs it to
+// recompute the final standings, so disputes can be settled from the record.
+//
+// A log is NDJSON: one Event per line in the order the server saw them. It
+// opens with a start event carrying the seed and the participants and, for
+// games that ended, closes with an end event.
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+const (
+	Start      = "start"
+	Input      = "input"
+	Score      = "score"
+	Eliminated = "eliminated"
+	End        = "end"
+)
+
+// Event is one line of a replay log. At is in unix milliseconds.
+type Event struct {
+	At       int64    `json:"at"`
+	Type     string   `json:"type"`
+	UserId   string   `json:"userId,omitempty"`
+	Seed     int64    `json:"seed,omitempty"`
+	Users    []string `json:"users,omitempty"`
+	Input    string   `json:"input,omitempty"`
+	Points   int      `json:"points,omitempty"`
+	WinnerId string   `json:"winnerId,omitempty"`
+	Reason   string   `json:"reason,omitempty"`
+}
+
+// Encode returns the event as a single log line without the newline.
+func Encode(event Event) string {
+	line, _ := json.Marshal(event)
+	return string(line)
+}
+
+// Decode reads a whole log.
+func Decode(r io.Reader) ([]Event, error) {
+	events := []Event{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		events = append(events, event)
+	}
+	return events, scanner.Err()
+}
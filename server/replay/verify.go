@@ -0,0 +1,135 @@
+package replay
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var ErrNoStart = errors.New("replay does not begin with a start event")
+
+type Standing struct {
+	UserId string `json:"userId"`
+	Points int    `json:"points"`
+	Alive  bool   `json:"alive"`
+	Rank   int    `json:"rank"`
+}
+
+// Result is what a replay recomputes to. Mismatches lists every place the
+// recorded events disagree with the re-run, an empty list means the log is
+// consistent.
+type Result struct {
+	Seed             int64      `json:"seed"`
+	Standings        []Standing `json:"standings"`
+	WinnerId         string     `json:"winnerId"`
+	RecordedWinnerId string     `json:"recordedWinnerId"`
+	EndReason        string     `json:"endReason"`
+	Inputs           int        `json:"inputs"`
+	Mismatches       []string   `json:"mismatches"`
+}
+
+type player struct {
+	points       int
+	alive        bool
+	eliminatedAt int
+}
+
+// Verify re-runs a log with the server's scoring rules: a point only counts
+// for a player still alive and an elimination is final. The winner is the
+// player with the most points, as long as anyone scored at all. Players
+// level on points rank by who stayed in longer.
+func Verify(events []Event) (Result, error) {
+	result := Result{Mismatches: []string{}}
+	if len(events) == 0 || events[0].Type != Start {
+		return result, ErrNoStart
+	}
+	result.Seed = events[0].Seed
+
+	players := map[string]*player{}
+	for _, userId := range events[0].Users {
+		players[userId] = &player{alive: true}
+	}
+	mismatch := func(index int, format string, args ...interface{}) {
+		result.Mismatches = append(result.Mismatches, fmt.Sprintf("event %d: ", index)+fmt.Sprintf(format, args...))
+	}
+
+	ended := false
+	for index, event := range events[1:] {
+		index += 1
+		if ended {
+			mismatch(index, "%s after the end of the game", event.Type)
+			continue
+		}
+		state, known := players[event.UserId]
+		switch event.Type {
+		case Input:
+			result.Inputs++
+			if !known {
+				mismatch(index, "input from %s who is not a participant", event.UserId)
+			}
+		case Score:
+			if !known {
+				mismatch(index, "score for %s who is not a participant", event.UserId)
+				continue
+			}
+			if !state.alive {
+				mismatch(index, "score for %s after their elimination", event.UserId)
+				continue
+			}
+			state.points++
+			if event.Points != state.points {
+				mismatch(index, "%s recorded at %d points, re-run has %d", event.UserId, event.Points, state.points)
+			}
+		case Eliminated:
+			if !known {
+				mismatch(index, "elimination of %s who is not a participant", event.UserId)
+				continue
+			}
+			if !state.alive {
+				mismatch(index, "%s eliminated twice", event.UserId)
+				continue
+			}
+			state.alive = false
+			state.eliminatedAt = index
+		case End:
+			ended = true
+			result.RecordedWinnerId = event.WinnerId
+			result.EndReason = event.Reason
+		default:
+			mismatch(index, "unknown event type %q", event.Type)
+		}
+	}
+
+	for userId, state := range players {
+		result.Standings = append(result.Standings, Standing{UserId: userId, Points: state.points, Alive: state.alive})
+	}
+	sort.Slice(result.Standings, func(i, j int) bool {
+		a, b := result.Standings[i], result.Standings[j]
+		if a.Points != b.Points {
+			return a.Points > b.Points
+		}
+		if a.Alive != b.Alive {
+			return a.Alive
+		}
+		if players[a.UserId].eliminatedAt != players[b.UserId].eliminatedAt {
+			return players[a.UserId].eliminatedAt > players[b.UserId].eliminatedAt
+		}
+		return a.UserId < b.UserId
+	})
+	for i := range result.Standings {
+		result.Standings[i].Rank = i + 1
+	}
+
+	if len(result.Standings) > 0 && result.Standings[0].Points > 0 {
+		result.WinnerId = result.Standings[0].UserId
+		// The server breaks ties between top scorers arbitrarily, any of
+		// them is a valid winner.
+		if recorded, ok := players[result.RecordedWinnerId]; ok && recorded.points == result.Standings[0].Points {
+			result.WinnerId = result.RecordedWinnerId
+		}
+	}
+	if result.EndReason == "finished" && result.RecordedWinnerId != result.WinnerId {
+		mismatch(len(events)-1, "recorded winner %q, re-run has %q", result.RecordedWinnerId, result.WinnerId)
+	}
+	return result, nil
+}
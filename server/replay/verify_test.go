@@ -0,0 +1,59 @@
+package replay
+
+import (
+	"strings"
+	"testing"
+)
+
+const finishedLog = `{"at":1,"type":"start","seed":42,"users":["a","b"]}
+{"at":2,"type":"input","userId":"a","input":"update-board"}
+{"at":2,"type":"score","userId":"a","points":1}
+{"at":3,"type":"score","userId":"b","points":1}
+{"at":4,"type":"score","userId":"a","points":2}
+{"at":5,"type":"eliminated","userId":"b"}
+{"at":6,"type":"eliminated","userId":"a"}
+{"at":6,"type":"end","winnerId":"a","reason":"finished"}
+`
+
+func TestVerifyRecomputesStandings(t *testing.T) {
+	events, err := Decode(strings.NewReader(finishedLog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := Verify(events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Mismatches) != 0 {
+		t.Fatalf("unexpected mismatches: %v", result.Mismatches)
+	}
+	if result.Seed != 42 || result.WinnerId != "a" || result.Inputs != 1 {
+		t.Fatalf("got seed %d, winner %q, %d inputs", result.Seed, result.WinnerId, result.Inputs)
+	}
+	if result.Standings[0].UserId != "a" || result.Standings[0].Points != 2 || result.Standings[1].Rank != 2 {
+		t.Fatalf("unexpected standings: %+v", result.Standings)
+	}
+}
+
+func TestVerifyFlagsTamperedLog(t *testing.T) {
+	tampered := strings.Replace(finishedLog, `{"at":5,"type":"eliminated","userId":"b"}`, `{"at":5,"type":"eliminated","userId":"b"}
+{"at":5,"type":"score","userId":"b","points":2}`, 1)
+	tampered = strings.Replace(tampered, `"winnerId":"a"`, `"winnerId":"b"`, 1)
+	events, err := Decode(strings.NewReader(tampered))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := Verify(events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Mismatches) != 2 {
+		t.Fatalf("expected a late score and a wrong winner, got %v", result.Mismatches)
+	}
+}
+
+func TestVerifyNeedsStart(t *testing.T) {
+	if _, err := Verify([]Event{{Type: Score, UserId: "a", Points: 1}}); err != ErrNoStart {
+		t.Fatalf("expected ErrNoStart, got %v", err)
+	}
+}
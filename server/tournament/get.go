@@ -0,0 +1,52 @@
+package tournament
+
+import (
+	"errors"
+	gameManager "flappy-bird-server/game-manager"
+	"flappy-bird-server/lib"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+var statuses = map[string]bool{"": true, "registration": true, "running": true, "completed": true, "cancelled": true}
+
+// getTournaments lists the tournaments, optionally filtered by status.
+func getTournaments(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if !statuses[status] {
+		lib.ErrorJson(w, http.StatusBadRequest, "status should be registration, running, completed or cancelled", "")
+		return
+	}
+	tournaments, err := gameManager.GetInstance().ListTournaments(r.Context(), status)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "success",
+		"data":    tournaments,
+	})
+}
+
+// getTournament returns a tournament with its bracket: the entries, best
+// placed first, and the games of every round.
+func getTournament(w http.ResponseWriter, r *http.Request) {
+	tournament, entries, games, err := gameManager.GetInstance().GetTournament(r.Context(), mux.Vars(r)["id"])
+	if errors.Is(err, gameManager.ErrTournamentNotFound) {
+		lib.ErrorJson(w, http.StatusNotFound, "Tournament not found", "")
+		return
+	}
+	if err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "success",
+		"data": map[string]interface{}{
+			"tournament": tournament,
+			"entries":    entries,
+			"games":      games,
+		},
+	})
+}
@@ -0,0 +1,15 @@
+package tournament
+
+import (
+	"flappy-bird-server/middleware"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+func Handler(r *mux.Router) {
+	r.HandleFunc("", getTournaments).Methods("GET")
+	r.HandleFunc("/{id}", getTournament).Methods("GET")
+	r.Handle("/{id}/register", middleware.Authenticate(http.HandlerFunc(register))).Methods("POST")
+	r.Handle("/{id}/register", middleware.Authenticate(http.HandlerFunc(unregister))).Methods("DELETE")
+}
@@ -0,0 +1,53 @@
+package tournament
+
+import (
+	"errors"
+	gameManager "flappy-bird-server/game-manager"
+	"flappy-bird-server/lib"
+	"flappy-bird-server/middleware"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+func writeRegistrationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, gameManager.ErrTournamentNotFound):
+		lib.ErrorJson(w, http.StatusNotFound, "Tournament not found", "")
+	case errors.Is(err, gameManager.ErrInsufficientBalance):
+		lib.ErrorJson(w, http.StatusPaymentRequired, err.Error(), "")
+	case errors.Is(err, gameManager.ErrRegistrationClosed), errors.Is(err, gameManager.ErrTournamentFull),
+		errors.Is(err, gameManager.ErrAlreadyRegistered), errors.Is(err, gameManager.ErrNotRegistered):
+		lib.ErrorJson(w, http.StatusConflict, err.Error(), "")
+	default:
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+	}
+}
+
+// register enters the caller and takes the buy-in from their balance.
+func register(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.GetUser(r)
+	tournament, err := gameManager.GetInstance().RegisterTournament(r.Context(), mux.Vars(r)["id"], user.Id)
+	if err != nil {
+		writeRegistrationError(w, err)
+		return
+	}
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Registered successfully",
+		"data":    tournament,
+	})
+}
+
+// unregister withdraws the caller before the start and refunds the buy-in.
+func unregister(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.GetUser(r)
+	tournament, err := gameManager.GetInstance().UnregisterTournament(r.Context(), mux.Vars(r)["id"], user.Id)
+	if err != nil {
+		writeRegistrationError(w, err)
+		return
+	}
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Unregistered successfully",
+		"data":    tournament,
+	})
+}
@@ -9,10 +9,15 @@ import (
 //		gameTypeRoute := api.Group("/transaction")
 //		gameTypeRoute.Post("/", verifyTransaction)
 //	}
-func Handler(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodPost {
-		verifyTransaction(w, r)
-		return
+
+// Handler accepts Helius webhooks that carry webhookSecret in their
+// Authorization header.
+func Handler(webhookSecret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			verifyTransaction(w, r, webhookSecret)
+			return
+		}
+		lib.ErrorJson(w, 405, "Method not allowed", "")
 	}
-	lib.ErrorJson(w, 405, "Method not allowed", "")
 }
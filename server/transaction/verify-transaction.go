@@ -1,12 +1,13 @@
 package transaction
 
 import (
+	"flappy-bird-server/audit"
 	gameManager "flappy-bird-server/game-manager"
 	"flappy-bird-server/lib"
+	"flappy-bird-server/metrics"
 	"flappy-bird-server/model"
 	"fmt"
 	"net/http"
-	"os"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
@@ -24,10 +25,16 @@ type RequestBody []struct {
 	NativeTransfers []NativeTransfers `json:"nativeTransfers"`
 }
 
-func verifyTransaction(w http.ResponseWriter, r *http.Request) {
+func verifyTransaction(w http.ResponseWriter, r *http.Request, webhookSecret string) {
+	result := "error"
+	defer func() {
+		metrics.SolanaWebhooks.WithLabelValues(result).Inc()
+	}()
+
 	token := r.Header.Get("Authorization")
 
-	if token != os.Getenv("HELIUS_WEBHOOK_SECRET") {
+	if token != webhookSecret {
+		result = "unauthorized"
 		lib.ErrorJson(w, http.StatusUnauthorized, "Unauthorized", "")
 		return
 	}
@@ -35,11 +42,13 @@ func verifyTransaction(w http.ResponseWriter, r *http.Request) {
 	var body RequestBody
 	err := lib.ReadJsonFromBody(r, w, &body)
 	if err != nil {
+		result = "invalid"
 		lib.ErrorJson(w, http.StatusBadRequest, err.Error(), "")
 		return
 	}
 
 	if len(body) == 0 {
+		result = "invalid"
 		lib.ErrorJson(w, http.StatusBadRequest, err.Error(), "")
 		return
 	}
@@ -53,6 +62,7 @@ func verifyTransaction(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			if len(transaction.NativeTransfers) == 0 {
+				result = "rejected"
 				lib.ErrorJson(w, 500, newLine+"No native transfer found\n", "transaction.txt")
 				return
 
@@ -60,6 +70,7 @@ func verifyTransaction(w http.ResponseWriter, r *http.Request) {
 			transfer := transaction.NativeTransfers[0]
 			newLine += fmt.Sprintf("-publicKey-%s-", transfer.FromUserAccount)
 			if transfer.ToUserAccount != lib.AdminPublicKey {
+				result = "rejected"
 				lib.ErrorJson(w, 500, newLine+"Invalid transaction: please send solana to "+lib.AdminPublicKey+"\n", "transaction.txt")
 				return
 			}
@@ -77,23 +88,48 @@ func verifyTransaction(w http.ResponseWriter, r *http.Request) {
 				lib.ErrorJson(w, 500, newLine+"Something went wrong while creating transaction id\n", "transaction.txt")
 				return
 			}
-			if err = lib.Pool.QueryRow(r.Context(), `INSERT INTO public.transactions (id, amount, signature, "userId") VALUES ($1, $2, $3, $4) RETURNING amount`, transactionId, transfer.Amount, transaction.Signature, user.Id).Scan(&amount); err != nil {
+			// The transaction row, the credit and its audit record are
+			// written together, a webhook retried after a failure finds
+			// none of them.
+			tx, err := lib.Pool.Begin(r.Context())
+			if err != nil {
+				lib.ErrorJson(w, 500, newLine+err.Error()+"\n", "transaction.txt")
+				return
+			}
+			defer tx.Rollback(r.Context())
+
+			if err = tx.QueryRow(r.Context(), `INSERT INTO public.transactions (id, amount, signature, "userId") VALUES ($1, $2, $3, $4) RETURNING amount`, transactionId, transfer.Amount, transaction.Signature, user.Id).Scan(&amount); err != nil {
 				lib.ErrorJson(w, 500, newLine+"Something went wrong while creating transaction id\n", "transaction.txt")
 				return
 
 			}
-			err = lib.Pool.QueryRow(r.Context(), `UPDATE public.users SET "solanaBalance" = $2 WHERE id = $1 RETURNING "solanaBalance"`, user.Id, user.SolanaBalance+amount).Scan(&updatedBalance)
+			err = tx.QueryRow(r.Context(), `UPDATE public.users SET "solanaBalance" = "solanaBalance" + $2 WHERE id = $1 RETURNING "solanaBalance"`, user.Id, amount).Scan(&updatedBalance)
 			if err != nil {
 				lib.ErrorJson(w, 500, newLine+"Something went wrong while update user solana balance\n", "transaction.txt")
 				return
 
 			}
 			user.SolanaBalance = uint(updatedBalance)
+
+			event := audit.BalanceChange("balance.deposit", user.Id, updatedBalance, int(amount))
+			event.Ip = audit.ClientIp(r)
+			event.RequestId = r.Header.Get("X-Request-Id")
+			event.Details = map[string]interface{}{"signature": transaction.Signature, "transactionId": transactionId.String()}
+			if err := audit.Record(r.Context(), tx, event); err != nil {
+				lib.ErrorJson(w, 500, newLine+err.Error()+"\n", "transaction.txt")
+				return
+			}
+			if err := tx.Commit(r.Context()); err != nil {
+				lib.ErrorJson(w, 500, newLine+err.Error()+"\n", "transaction.txt")
+				return
+			}
+			result = "credited"
 		} else {
 			lib.ErrorJson(w, 500, newLine+"Something went wrong while fetching transaction details\n", "transaction.txt")
 			return
 		}
 	} else {
+		result = "duplicate"
 		err = lib.Pool.QueryRow(r.Context(), `SELECT id, name, email, "inrBalance", "solanaBalance" FROM public.users WHERE id = $1`, transactionAlreadyVerified.UserId).Scan(&user.Id, &user.Name, &user.Email, &user.INRBalance, &user.SolanaBalance)
 		lib.ErrorJson(w, 500, newLine+err.Error()+"\n", "transaction.txt")
 		return
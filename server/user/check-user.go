@@ -2,7 +2,6 @@ package user
 
 import (
 	"flappy-bird-server/lib"
-	"log"
 	"net/http"
 
 	"github.com/gorilla/mux"
@@ -17,14 +16,11 @@ func CheckUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Println(id)
 	var userId string
 	err := lib.Pool.QueryRow(r.Context(), "SELECT id FROM public.users WHERE email = $1", id).Scan(&userId)
 
 	if err != nil {
 		if err == pgx.ErrNoRows {
-			log.Println(err.Error())
-
 			lib.ErrorJson(w, http.StatusNotFound, "User not found", "")
 			return
 		}
@@ -0,0 +1,124 @@
+package user
+
+import (
+	"flappy-bird-server/lib"
+	"flappy-bird-server/middleware"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxGamesLimit = 100
+
+type GameHistoryItem struct {
+	GameId        string    `json:"gameId"`
+	GameTypeId    string    `json:"gameTypeId"`
+	GameType      string    `json:"gameType"`
+	Currency      string    `json:"currency"`
+	Status        string    `json:"status"`
+	Outcome       string    `json:"outcome"`
+	EntryFee      int       `json:"entryFee"`
+	WinningAmount int       `json:"winningAmount"`
+	WinnerId      string    `json:"winnerId"`
+	Score         *int      `json:"score"`
+	Players       int       `json:"players"`
+	HasReplay     bool      `json:"hasReplay"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// outcomeConditions maps the outcome filter to the games it matches, with
+// the caller's id as $1.
+var outcomeConditions = map[string]string{
+	"won":     `g.status = 'completed' AND g."winnerId" = $1`,
+	"lost":    `g.status = 'completed' AND g."winnerId" IS DISTINCT FROM $1`,
+	"aborted": `g.status = 'aborted'`,
+	"ongoing": `g.status = 'ongoing'`,
+}
+
+// getMyGames lists the caller's past and running games, newest first,
+// filtered by gameTypeId and outcome (won, lost, aborted or ongoing) and
+// paginated with page and limit. Lobbies that never started are left out.
+func getMyGames(w http.ResponseWriter, r *http.Request) {
+	user, _ := middleware.GetUser(r)
+	query := r.URL.Query()
+
+	page, limit := 1, maxGamesLimit
+	for key, target := range map[string]*int{"page": &page, "limit": &limit} {
+		if value := query.Get(key); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 {
+				lib.ErrorJson(w, http.StatusBadRequest, key+" should be a positive number", "")
+				return
+			}
+			*target = parsed
+		}
+	}
+	if limit > maxGamesLimit {
+		limit = maxGamesLimit
+	}
+
+	args := []interface{}{user.Id}
+	conditions := []string{`p."userId" = $1`, `g.status <> 'staging'`}
+	if gameTypeId := query.Get("gameTypeId"); gameTypeId != "" {
+		args = append(args, gameTypeId)
+		conditions = append(conditions, fmt.Sprintf(`g."gameTypeId" = $%d`, len(args)))
+	}
+	if outcome := query.Get("outcome"); outcome != "" {
+		condition, ok := outcomeConditions[outcome]
+		if !ok {
+			lib.ErrorJson(w, http.StatusBadRequest, "outcome should be won, lost, aborted or ongoing", "")
+			return
+		}
+		conditions = append(conditions, condition)
+	}
+	from := ` FROM public.participants p JOIN public.games g ON g.id = p."gameId" JOIN public.gametypes t ON t.id = g."gameTypeId" WHERE ` + strings.Join(conditions, " AND ")
+
+	var total int
+	if err := lib.Pool.QueryRow(r.Context(), `SELECT COUNT(*)`+from, args...).Scan(&total); err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	args = append(args, limit, (page-1)*limit)
+	rows, err := lib.Pool.Query(r.Context(), fmt.Sprintf(`SELECT g.id, g."gameTypeId", t.title, t.currency, g.status, g."entryFee", g."winningAmount", COALESCE(g."winnerId", ''), p.score,
+		(SELECT COUNT(*) FROM public.participants o WHERE o."gameId" = g.id),
+		EXISTS (SELECT 1 FROM public.replays rp WHERE rp."gameId" = g.id), g."createdAt"%s
+		ORDER BY g."createdAt" DESC, g.id LIMIT $%d OFFSET $%d`, from, len(args)-1, len(args)), args...)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	defer rows.Close()
+
+	games := []GameHistoryItem{}
+	for rows.Next() {
+		var game GameHistoryItem
+		if err := rows.Scan(&game.GameId, &game.GameTypeId, &game.GameType, &game.Currency, &game.Status, &game.EntryFee, &game.WinningAmount, &game.WinnerId, &game.Score, &game.Players, &game.HasReplay, &game.CreatedAt); err != nil {
+			lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+			return
+		}
+		switch {
+		case game.Status == "completed" && game.WinnerId == user.Id:
+			game.Outcome = "won"
+		case game.Status == "completed":
+			game.Outcome = "lost"
+		default:
+			game.Outcome = game.Status
+		}
+		games = append(games, game)
+	}
+	if err := rows.Err(); err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "success",
+		"data":    games,
+		"page":    page,
+		"limit":   limit,
+		"total":   total,
+	})
+}
@@ -1,12 +1,18 @@
 package user
 
 import (
+	"flappy-bird-server/middleware"
+	"net/http"
+
 	"github.com/gorilla/mux"
 )
 
 func Handler(r *mux.Router) {
-	r.HandleFunc("/me", verifyUser).Methods("GET")
+	r.Handle("/me", middleware.Authenticate(http.HandlerFunc(verifyUser))).Methods("GET")
+	r.Handle("/password", middleware.Authenticate(http.HandlerFunc(updatePassword))).Methods("POST")
+	r.Handle("/me/games", middleware.Authenticate(http.HandlerFunc(getMyGames))).Methods("GET")
 	r.HandleFunc("/{id}", CheckUser).Methods("GET")
+	r.HandleFunc("/{id}/stats", getUserStats).Methods("GET")
 }
 
 // func Handler() {
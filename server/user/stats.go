@@ -0,0 +1,74 @@
+package user
+
+import (
+	gameManager "flappy-bird-server/game-manager"
+	"flappy-bird-server/lib"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+// statsCacheTTL keeps profile pages off Postgres. Stats may lag a finished
+// game by this much.
+const statsCacheTTL = time.Minute
+
+type Stats struct {
+	UserId       string  `json:"userId"`
+	GamesPlayed  int     `json:"gamesPlayed"`
+	Wins         int     `json:"wins"`
+	WinRate      float64 `json:"winRate"`
+	NetSolProfit int     `json:"netSolProfit"`
+	BestScore    int     `json:"bestScore"`
+}
+
+func statsCacheKey(userId string) string {
+	return fmt.Sprintf("mr-stats-%s", userId)
+}
+
+// getUserStats summarises a player's completed games. Aborted games were
+// refunded and don't count, profit only covers games played for SOL.
+func getUserStats(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["id"]
+	client := gameManager.GetInstance().RedisClient
+
+	var stats Stats
+	if cached, err := client.Get(r.Context(), statsCacheKey(userId)).Result(); err == nil && gameManager.Parse(cached, &stats) == nil {
+		lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+			"message": "success",
+			"data":    stats,
+		})
+		return
+	}
+
+	err := lib.Pool.QueryRow(r.Context(), `SELECT u.id,
+		COUNT(g.id),
+		COUNT(g.id) FILTER (WHERE g."winnerId" = u.id),
+		COALESCE(SUM(CASE WHEN g."winnerId" = u.id THEN g."winningAmount" ELSE 0 END - g."entryFee") FILTER (WHERE t.currency = 'SOL'), 0),
+		COALESCE(MAX(p.score) FILTER (WHERE g.id IS NOT NULL), 0)
+		FROM public.users u
+		LEFT JOIN public.participants p ON p."userId" = u.id
+		LEFT JOIN public.games g ON g.id = p."gameId" AND g.status = 'completed'
+		LEFT JOIN public.gametypes t ON t.id = g."gameTypeId"
+		WHERE u.id = $1
+		GROUP BY u.id`, userId).Scan(&stats.UserId, &stats.GamesPlayed, &stats.Wins, &stats.NetSolProfit, &stats.BestScore)
+	if err == pgx.ErrNoRows {
+		lib.ErrorJson(w, http.StatusNotFound, "User not found", "")
+		return
+	}
+	if err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	if stats.GamesPlayed > 0 {
+		stats.WinRate = float64(stats.Wins) / float64(stats.GamesPlayed)
+	}
+	client.Set(r.Context(), statsCacheKey(userId), lib.Stringify(stats), statsCacheTTL)
+
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "success",
+		"data":    stats,
+	})
+}
@@ -1,48 +1,69 @@
 package user
 
-// import (
-// 	"flappy-bird-server/lib"
-// 	"flappy-bird-server/model"
-
-// 	"github.com/gofiber/fiber/v2"
-// )
-
-// type UpdatePasswordRequestBody struct {
-// 	Password string `json:"password"`
-// }
-
-// func updatePassword(c *fiber.Ctx) error {
-// 	user, ok := c.Locals("user").(model.User)
-// 	if !ok {
-// 		return c.Status(fiber.StatusUnauthorized).JSON(map[string]interface{}{
-// 			"message": "Unauthorized",
-// 		})
-// 	}
-
-// 	var body UpdatePasswordRequestBody
-// 	err := c.BodyParser(body)
-// 	if err != nil {
-// 		return c.Status(500).JSON(map[string]interface{}{
-// 			"message": err.Error(),
-// 		})
-// 	}
-
-// 	if len(body.Password) < 8 {
-// 		return c.Status(400).JSON(map[string]interface{}{
-// 			"message": "password length should be more than 7",
-// 		})
-
-// 	}
-
-// 	hashedPassword := lib.HashString(user.Email + body.Password)
-// 	_, err = lib.Pool.Exec(c.Context(), "UPDATE public.users SET password = $2 WHERE id = $1", user.Id, hashedPassword)
-// 	if err != nil {
-// 		return c.Status(500).JSON(map[string]interface{}{
-// 			"message": err.Error(),
-// 		})
-// 	}
-
-// 	return c.Status(fiber.StatusOK).JSON(map[string]interface{}{
-// 		"message": "Password updated successfully",
-// 	})
-// }
+import (
+	"flappy-bird-server/lib"
+	"flappy-bird-server/middleware"
+	"net/http"
+)
+
+type UpdatePasswordRequestBody struct {
+	CurrentPassword string `json:"currentPassword"`
+	Password        string `json:"password"`
+}
+
+func updatePassword(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.CheckAccess(w, r)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusUnauthorized, "Unauthorized", "")
+		return
+	}
+
+	var body UpdatePasswordRequestBody
+	err = lib.ReadJsonFromBody(r, w, &body)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusBadRequest, err.Error(), "")
+		return
+	}
+
+	if err := lib.ValidatePassword(body.Password); err != nil {
+		lib.ErrorJson(w, http.StatusBadRequest, err.Error(), "")
+		return
+	}
+
+	var passwordHash string
+	err = lib.Pool.QueryRow(r.Context(), `SELECT COALESCE(password, '') FROM public.users WHERE id = $1`, user.Id).Scan(&passwordHash)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	// Accounts created through wallet sign-in have no password yet, the
+	// bearer token is enough to set the first one.
+	if passwordHash != "" {
+		valid, _, err := lib.VerifyPassword(body.CurrentPassword, passwordHash)
+		if err != nil {
+			lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+			return
+		}
+		if !valid {
+			lib.ErrorJson(w, http.StatusBadRequest, "invalid current password", "")
+			return
+		}
+	}
+
+	hashedPassword, err := lib.HashPassword(body.Password)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	_, err = lib.Pool.Exec(r.Context(), `UPDATE public.users SET password = $2, "updatedAt" = NOW() WHERE id = $1`, user.Id, hashedPassword)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	lib.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Password updated successfully",
+	})
+}
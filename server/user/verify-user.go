@@ -4,7 +4,6 @@ import (
 	gameManager "flappy-bird-server/game-manager"
 	"flappy-bird-server/lib"
 	"flappy-bird-server/middleware"
-	"fmt"
 	"net/http"
 	"time"
 )
@@ -21,19 +20,30 @@ func verifyUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The authenticated user carries no balances, they are read fresh.
+	err = lib.Pool.QueryRow(r.Context(), `SELECT "inrBalance", "solanaBalance" FROM public.users WHERE id = $1`, user.Id).Scan(&user.INRBalance, &user.SolanaBalance)
+	if err != nil {
+		lib.ErrorJson(w, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
 	response := map[string]interface{}{
 		"message": "success",
 		"data":    []middleware.User{user},
 	}
 
-	gameManager.GetInstance().RedisClient.Set(r.Context(), fmt.Sprintf("mr-balance-%s", user.Id), user.SolanaBalance, 24*time.Hour)
+	gameManager.GetInstance().SetBalance(user.Id, int(user.SolanaBalance))
 
-	if user.Email == lib.AdminPublicKey {
+	if user.IsAdmin {
 		response["isAdmin"] = true
 	}
+	response["roles"] = user.Roles
+	response["permissions"] = user.Permissions
 
-	if lib.UnderMaintenance {
+	gameInstance := gameManager.GetInstance()
+	if gameInstance.IsUnderMaintenance() {
 		response["underMaintenance"] = true
 	}
+	response["maintenance"] = gameInstance.GetMaintenance().Payload(time.Now())
 	lib.WriteJson(w, http.StatusOK, response)
 }
@@ -0,0 +1,71 @@
+-- CreateTable
+CREATE TABLE "roles" (
+    "name" TEXT NOT NULL,
+    "description" TEXT,
+
+    CONSTRAINT "roles_pkey" PRIMARY KEY ("name")
+);
+
+-- CreateTable
+CREATE TABLE "permissions" (
+    "name" TEXT NOT NULL,
+    "description" TEXT,
+
+    CONSTRAINT "permissions_pkey" PRIMARY KEY ("name")
+);
+
+-- CreateTable
+CREATE TABLE "role_permissions" (
+    "role" TEXT NOT NULL,
+    "permission" TEXT NOT NULL,
+
+    CONSTRAINT "role_permissions_pkey" PRIMARY KEY ("role","permission")
+);
+
+-- CreateTable
+CREATE TABLE "user_roles" (
+    "userId" TEXT NOT NULL,
+    "role" TEXT NOT NULL,
+    "grantedBy" TEXT,
+    "createdAt" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "user_roles_pkey" PRIMARY KEY ("userId","role")
+);
+
+-- AddForeignKey
+ALTER TABLE "role_permissions" ADD CONSTRAINT "role_permissions_role_fkey" FOREIGN KEY ("role") REFERENCES "roles"("name") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "role_permissions" ADD CONSTRAINT "role_permissions_permission_fkey" FOREIGN KEY ("permission") REFERENCES "permissions"("name") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "user_roles" ADD CONSTRAINT "user_roles_userId_fkey" FOREIGN KEY ("userId") REFERENCES "users"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "user_roles" ADD CONSTRAINT "user_roles_role_fkey" FOREIGN KEY ("role") REFERENCES "roles"("name") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- Seed
+INSERT INTO "roles" ("name", "description") VALUES
+    ('admin', 'Full access to every privileged action'),
+    ('moderator', 'Watches live games and players'),
+    ('support', 'Looks up players and games to answer tickets'),
+    ('finance', 'Reviews balances, deposits and payouts');
+
+INSERT INTO "permissions" ("name", "description") VALUES
+    ('gametypes:write', 'Create and edit game types'),
+    ('maintenance:write', 'Start and end maintenance'),
+    ('metrics:read', 'View live server metrics'),
+    ('roles:write', 'Grant and revoke roles');
+
+INSERT INTO "role_permissions" ("role", "permission") VALUES
+    ('admin', 'gametypes:write'),
+    ('admin', 'maintenance:write'),
+    ('admin', 'metrics:read'),
+    ('admin', 'roles:write'),
+    ('moderator', 'metrics:read'),
+    ('support', 'metrics:read'),
+    ('finance', 'metrics:read');
+
+-- The treasury wallet was the only admin before roles existed
+INSERT INTO "user_roles" ("userId", "role")
+SELECT "id", 'admin' FROM "users" WHERE "email" = 'CVdndsAGyNj8BvLhtrQBLMtrwEgy53ACXFQmQMfH2MFQ';
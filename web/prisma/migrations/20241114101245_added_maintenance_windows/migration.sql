@@ -0,0 +1,15 @@
+-- CreateTable
+CREATE TABLE "maintenance_windows" (
+    "id" TEXT NOT NULL,
+    "message" TEXT NOT NULL,
+    "startsAt" TIMESTAMP(3) NOT NULL,
+    "endsAt" TIMESTAMP(3),
+    "createdBy" TEXT,
+    "cancelledAt" TIMESTAMP(3),
+    "createdAt" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "maintenance_windows_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX "maintenance_windows_startsAt_idx" ON "maintenance_windows"("startsAt");
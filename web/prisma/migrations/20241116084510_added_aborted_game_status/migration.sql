@@ -0,0 +1,2 @@
+-- AlterEnum
+ALTER TYPE "GameStatus" ADD VALUE 'aborted';
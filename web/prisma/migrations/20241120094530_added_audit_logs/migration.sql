@@ -0,0 +1,30 @@
+-- CreateTable
+CREATE TABLE "audit_logs" (
+    "id" TEXT NOT NULL,
+    "actorId" TEXT,
+    "action" TEXT NOT NULL,
+    "targetType" TEXT NOT NULL,
+    "targetId" TEXT NOT NULL,
+    "details" JSONB,
+    "createdAt" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "audit_logs_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX "audit_logs_targetType_targetId_idx" ON "audit_logs"("targetType", "targetId");
+
+-- CreateIndex
+CREATE INDEX "audit_logs_actorId_idx" ON "audit_logs"("actorId");
+
+-- Seed
+INSERT INTO "permissions" ("name", "description") VALUES
+    ('games:read', 'Inspect live and past games'),
+    ('games:write', 'Force-end, abort games and kick players');
+
+INSERT INTO "role_permissions" ("role", "permission") VALUES
+    ('admin', 'games:read'),
+    ('admin', 'games:write'),
+    ('moderator', 'games:read'),
+    ('moderator', 'games:write'),
+    ('support', 'games:read');
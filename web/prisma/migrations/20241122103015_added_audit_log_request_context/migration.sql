@@ -0,0 +1,28 @@
+-- AlterTable
+ALTER TABLE "audit_logs" ADD COLUMN     "after" JSONB,
+ADD COLUMN     "before" JSONB,
+ADD COLUMN     "ip" TEXT,
+ADD COLUMN     "requestId" TEXT;
+
+-- CreateIndex
+CREATE INDEX "audit_logs_action_idx" ON "audit_logs"("action");
+
+-- CreateIndex
+CREATE INDEX "audit_logs_createdAt_idx" ON "audit_logs"("createdAt");
+
+-- Audit events are never edited or removed
+CREATE FUNCTION "audit_logs_append_only"() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_logs is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER "audit_logs_append_only" BEFORE UPDATE OR DELETE OR TRUNCATE ON "audit_logs" FOR EACH STATEMENT EXECUTE FUNCTION "audit_logs_append_only"();
+
+-- Seed
+INSERT INTO "permissions" ("name", "description") VALUES
+    ('audit:read', 'Browse the audit log');
+
+INSERT INTO "role_permissions" ("role", "permission") VALUES
+    ('admin', 'audit:read'),
+    ('finance', 'audit:read');
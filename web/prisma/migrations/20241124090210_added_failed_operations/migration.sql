@@ -0,0 +1,32 @@
+-- CreateEnum
+CREATE TYPE "FailedOperationStatus" AS ENUM ('pending', 'replaying', 'resolved');
+
+-- CreateTable
+CREATE TABLE "failed_operations" (
+    "id" TEXT NOT NULL,
+    "type" TEXT NOT NULL,
+    "payload" JSONB NOT NULL,
+    "error" TEXT NOT NULL,
+    "source" TEXT NOT NULL,
+    "status" "FailedOperationStatus" NOT NULL DEFAULT 'pending',
+    "attempts" INTEGER NOT NULL DEFAULT 0,
+    "createdAt" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updatedAt" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "resolvedAt" TIMESTAMP(3),
+
+    CONSTRAINT "failed_operations_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX "failed_operations_status_createdAt_idx" ON "failed_operations"("status", "createdAt");
+
+-- Seed
+INSERT INTO "permissions" ("name", "description") VALUES
+    ('operations:read', 'View failed payouts and refunds'),
+    ('operations:write', 'Replay failed payouts and refunds');
+
+INSERT INTO "role_permissions" ("role", "permission") VALUES
+    ('admin', 'operations:read'),
+    ('admin', 'operations:write'),
+    ('finance', 'operations:read'),
+    ('finance', 'operations:write');
@@ -0,0 +1,22 @@
+-- AlterTable
+ALTER TABLE "games" ADD COLUMN "ratedAt" TIMESTAMP(3);
+
+-- CreateTable
+CREATE TABLE "ratings" (
+    "userId" TEXT NOT NULL,
+    "gameTypeId" TEXT NOT NULL,
+    "rating" DOUBLE PRECISION NOT NULL DEFAULT 1500,
+    "gamesPlayed" INTEGER NOT NULL DEFAULT 0,
+    "updatedAt" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "ratings_pkey" PRIMARY KEY ("userId","gameTypeId")
+);
+
+-- CreateIndex
+CREATE INDEX "ratings_gameTypeId_rating_idx" ON "ratings"("gameTypeId", "rating");
+
+-- AddForeignKey
+ALTER TABLE "ratings" ADD CONSTRAINT "ratings_userId_fkey" FOREIGN KEY ("userId") REFERENCES "users"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "ratings" ADD CONSTRAINT "ratings_gameTypeId_fkey" FOREIGN KEY ("gameTypeId") REFERENCES "gametypes"("id") ON DELETE RESTRICT ON UPDATE CASCADE;
@@ -0,0 +1,3 @@
+-- AlterTable
+ALTER TABLE "gametypes" ADD COLUMN "minPlayer" INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN "lobbyTimeout" INTEGER NOT NULL DEFAULT 0;
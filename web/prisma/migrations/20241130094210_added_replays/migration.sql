@@ -0,0 +1,13 @@
+-- CreateTable
+CREATE TABLE "replays" (
+    "gameId" TEXT NOT NULL,
+    "seed" BIGINT NOT NULL,
+    "events" INTEGER NOT NULL,
+    "log" BYTEA NOT NULL,
+    "createdAt" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "replays_pkey" PRIMARY KEY ("gameId")
+);
+
+-- AddForeignKey
+ALTER TABLE "replays" ADD CONSTRAINT "replays_gameId_fkey" FOREIGN KEY ("gameId") REFERENCES "games"("id") ON DELETE CASCADE ON UPDATE CASCADE;
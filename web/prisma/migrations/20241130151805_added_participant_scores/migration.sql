@@ -0,0 +1,11 @@
+-- AlterTable
+ALTER TABLE "participants" ADD COLUMN "score" INTEGER;
+
+-- CreateIndex
+CREATE INDEX "participants_userId_idx" ON "participants"("userId");
+
+-- CreateIndex
+CREATE INDEX "games_winnerId_idx" ON "games"("winnerId");
+
+-- CreateIndex
+CREATE INDEX "games_gameTypeId_status_idx" ON "games"("gameTypeId", "status");
@@ -0,0 +1,12 @@
+-- AlterTable
+ALTER TABLE "games" ADD COLUMN "private" BOOLEAN NOT NULL DEFAULT false;
+
+-- CreateIndex
+CREATE INDEX "games_status_updatedAt_idx" ON "games"("status", "updatedAt");
+
+-- Seed
+INSERT INTO "permissions" ("name", "description") VALUES
+    ('leaderboards:write', 'Rebuild leaderboards from completed games');
+
+INSERT INTO "role_permissions" ("role", "permission") VALUES
+    ('admin', 'leaderboards:write');
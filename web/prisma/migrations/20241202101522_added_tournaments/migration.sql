@@ -0,0 +1,82 @@
+-- CreateEnum
+CREATE TYPE "TournamentStatus" AS ENUM ('registration', 'running', 'completed', 'cancelled');
+
+-- CreateEnum
+CREATE TYPE "TournamentEntryStatus" AS ENUM ('active', 'eliminated');
+
+-- CreateTable
+CREATE TABLE "tournaments" (
+    "id" TEXT NOT NULL,
+    "title" TEXT NOT NULL,
+    "gameTypeId" TEXT NOT NULL,
+    "status" "TournamentStatus" NOT NULL DEFAULT 'registration',
+    "startsAt" TIMESTAMP(3) NOT NULL,
+    "capacity" INTEGER NOT NULL,
+    "buyIn" INTEGER NOT NULL,
+    "prizeTable" INTEGER[],
+    "tableSize" INTEGER NOT NULL,
+    "advance" INTEGER NOT NULL,
+    "round" INTEGER NOT NULL DEFAULT 0,
+    "createdBy" TEXT,
+    "createdAt" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updatedAt" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "tournaments_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateTable
+CREATE TABLE "tournament_entries" (
+    "tournamentId" TEXT NOT NULL,
+    "userId" TEXT NOT NULL,
+    "status" "TournamentEntryStatus" NOT NULL DEFAULT 'active',
+    "round" INTEGER NOT NULL DEFAULT 0,
+    "eliminatedRound" INTEGER,
+    "position" INTEGER,
+    "place" INTEGER,
+    "prize" INTEGER,
+    "createdAt" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "tournament_entries_pkey" PRIMARY KEY ("tournamentId","userId")
+);
+
+-- CreateTable
+CREATE TABLE "tournament_games" (
+    "gameId" TEXT NOT NULL,
+    "tournamentId" TEXT NOT NULL,
+    "round" INTEGER NOT NULL,
+    "players" INTEGER NOT NULL,
+    "startAt" TIMESTAMP(3) NOT NULL,
+    "startedAt" TIMESTAMP(3),
+    "finishedAt" TIMESTAMP(3),
+    "results" TEXT[],
+
+    CONSTRAINT "tournament_games_pkey" PRIMARY KEY ("gameId")
+);
+
+-- CreateIndex
+CREATE INDEX "tournaments_status_startsAt_idx" ON "tournaments"("status", "startsAt");
+
+-- CreateIndex
+CREATE INDEX "tournament_entries_userId_idx" ON "tournament_entries"("userId");
+
+-- CreateIndex
+CREATE INDEX "tournament_games_tournamentId_round_idx" ON "tournament_games"("tournamentId", "round");
+
+-- AddForeignKey
+ALTER TABLE "tournaments" ADD CONSTRAINT "tournaments_gameTypeId_fkey" FOREIGN KEY ("gameTypeId") REFERENCES "gametypes"("id") ON DELETE RESTRICT ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "tournament_entries" ADD CONSTRAINT "tournament_entries_tournamentId_fkey" FOREIGN KEY ("tournamentId") REFERENCES "tournaments"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "tournament_entries" ADD CONSTRAINT "tournament_entries_userId_fkey" FOREIGN KEY ("userId") REFERENCES "users"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "tournament_games" ADD CONSTRAINT "tournament_games_tournamentId_fkey" FOREIGN KEY ("tournamentId") REFERENCES "tournaments"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- Seed
+INSERT INTO "permissions" ("name", "description") VALUES
+    ('tournaments:write', 'Create and cancel tournaments');
+
+INSERT INTO "role_permissions" ("role", "permission") VALUES
+    ('admin', 'tournaments:write');
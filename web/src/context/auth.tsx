@@ -9,7 +9,11 @@ import { TOAST_ERROR_STYLES } from "@/lib/utils";
 import { User } from "@prisma/client";
 import { useWallet } from "@solana/wallet-adapter-react";
 import { useMutation } from "@tanstack/react-query";
-import axios, { AxiosError, AxiosInstance } from "axios";
+import axios, {
+  AxiosError,
+  AxiosInstance,
+  InternalAxiosRequestConfig,
+} from "axios";
 
 import {
   Dispatch,
@@ -53,6 +57,29 @@ const AuthContext = createContext<AuthContextType>({
   loginHandler: () => {},
 });
 
+// Access tokens are refreshed this long before they expire.
+const REFRESH_MARGIN = 60 * 1000;
+
+type Session = { token: string; refreshToken: string };
+
+// tokenExpiry reads the expiry of an access token, in milliseconds.
+function tokenExpiry(token: string) {
+  try {
+    const payload = token.split(".")[1].replace(/-/g, "+").replace(/_/g, "/");
+    return JSON.parse(atob(payload)).exp * 1000;
+  } catch {
+    return 0;
+  }
+}
+
+async function refreshTokens(refreshToken: string): Promise<Session> {
+  const response = await axios.post(
+    `${process.env.NEXT_PUBLIC_API_URL}/api/auth/refresh`,
+    { refreshToken }
+  );
+  return response.data;
+}
+
 async function verifyUser(data: { token: string }): Promise<{
   data: [User];
   message: string;
@@ -84,11 +111,49 @@ export const AuthContextProvider = ({ children }: PropsWithChildren) => {
   const [showPassword, setShowPassword] = useState(false);
   const [newUser, setNewUser] = useState(false);
   const [retry, setRetry] = useState(0);
+  const refreshing = useRef<Promise<string> | null>(null);
 
   const wallet = useWallet();
 
+  const storeSession = (session: Session) => {
+    setToken(session.token);
+    localStorage.setItem("token", session.token);
+    localStorage.setItem("refreshToken", session.refreshToken);
+  };
+
+  // Refresh tokens are single use, a second request with the same one
+  // would revoke the whole session, so concurrent callers share one.
+  const refreshSession = useCallback(() => {
+    if (!refreshing.current) {
+      const refreshToken = localStorage.getItem("refreshToken");
+      refreshing.current = (
+        refreshToken
+          ? refreshTokens(refreshToken)
+          : Promise.reject(new Error("Session expired, please sign in again"))
+      )
+        .then((session) => {
+          storeSession(session);
+          return session.token;
+        })
+        .finally(() => {
+          refreshing.current = null;
+        });
+    }
+    return refreshing.current;
+  }, []);
+
   const verifyUserMut = useMutation({
-    mutationFn: verifyUser,
+    mutationFn: async ({ token }: { token: string }) => {
+      try {
+        return { ...(await verifyUser({ token })), token };
+      } catch (e) {
+        if (!(e instanceof AxiosError) || e.response?.status !== 401) {
+          throw e;
+        }
+        const fresh = await refreshSession();
+        return { ...(await verifyUser({ token: fresh })), token: fresh };
+      }
+    },
     mutationKey: ["verifyUser"],
   });
 
@@ -136,10 +201,48 @@ export const AuthContextProvider = ({ children }: PropsWithChildren) => {
       headers.Authorization = `Bearer ${token}`;
     }
 
-    return axios.create({
+    const client = axios.create({
       baseURL: process.env.NEXT_PUBLIC_API_URL,
       headers,
     });
+    // A request that raced the token's expiry is sent once more with a
+    // refreshed one.
+    client.interceptors.response.use(undefined, async (error) => {
+      const request = error.config as
+        | (InternalAxiosRequestConfig & { retried?: boolean })
+        | undefined;
+      if (
+        !(error instanceof AxiosError) ||
+        error.response?.status !== 401 ||
+        !request ||
+        request.retried
+      ) {
+        throw error;
+      }
+      request.retried = true;
+      request.headers.Authorization = `Bearer ${await refreshSession()}`;
+      return client(request);
+    });
+    return client;
+  }, [token]);
+
+  useEffect(() => {
+    if (!token) {
+      return;
+    }
+    const timer = setTimeout(() => {
+      refreshSession().catch((e) => {
+        wallet.disconnect();
+        localStorage.clear();
+        setUser(null);
+        setToken(null);
+        toast(
+          e instanceof AxiosError ? e.response?.data.message : e.message,
+          TOAST_ERROR_STYLES
+        );
+      });
+    }, Math.max(tokenExpiry(token) - Date.now() - REFRESH_MARGIN, 0));
+    return () => clearTimeout(timer);
   }, [token]);
 
   const sendMessage = useCallback(
@@ -158,10 +261,14 @@ export const AuthContextProvider = ({ children }: PropsWithChildren) => {
 
   useEffect(() => {
     if (socket && user) {
-      sendMessage("add-user", {
-        userId: user.id,
-        publicKey: user.email,
-      });
+      // The socket signs in with the access token, read from storage so a
+      // refreshed one is used without signing in again on every refresh.
+      const signIn = (token: string | null) =>
+        sendMessage("add-user", {
+          token,
+          publicKey: user.email,
+        });
+      signIn(localStorage.getItem("token"));
 
       socket.onmessage = (e) => {
         const { type } = JSON.parse(e.data);
@@ -169,6 +276,19 @@ export const AuthContextProvider = ({ children }: PropsWithChildren) => {
           window.location.reload();
         }
       };
+
+      // A socket that reconnected with an expired token tries once more
+      // with a refreshed one.
+      let retried = false;
+      const onRejected = (e: MessageEvent) => {
+        const { type, data } = JSON.parse(e.data);
+        if (type === "error" && data?.message === "Unauthorized" && !retried) {
+          retried = true;
+          refreshSession().then(signIn, () => {});
+        }
+      };
+      socket.addEventListener("message", onRejected);
+      return () => socket.removeEventListener("message", onRejected);
     }
   }, [socket, user]);
 
@@ -215,7 +335,7 @@ export const AuthContextProvider = ({ children }: PropsWithChildren) => {
             onSuccess: (data) => {
               connectSocket();
               setUser(data.data[0]);
-              setToken(_token);
+              setToken(data.token);
               if (data.isAdmin) {
                 setIsAdmin(true);
               }
@@ -265,8 +385,7 @@ export const AuthContextProvider = ({ children }: PropsWithChildren) => {
         onSuccess: (data) => {
           connectSocket();
           setUser(data.data);
-          setToken(data.token);
-          localStorage.setItem("token", data.token);
+          storeSession(data);
           togglePasswordDialog();
         },
         onError: (e) => {
@@ -320,8 +439,7 @@ export const AuthContextProvider = ({ children }: PropsWithChildren) => {
             togglePasswordDialog();
             connectSocket();
             setUser(data.data);
-            setToken(data.token);
-            localStorage.setItem("token", data.token);
+            storeSession(data);
           },
           onError: (e) => {
             if (e instanceof AxiosError) {
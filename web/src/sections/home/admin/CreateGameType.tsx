@@ -85,7 +85,11 @@ export default function AdminCreateGameType() {
 
   const toggleMaintenance = async () => {
     try {
-      await apiClient.get("/api/admin/maintenance");
+      if (underMaintenance) {
+        await apiClient.delete("/api/admin/maintenance");
+      } else {
+        await apiClient.post("/api/admin/maintenance", {});
+      }
       toggleUnderMaintenance();
     } catch (error) {
       if (error instanceof AxiosError) {